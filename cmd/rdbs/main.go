@@ -2,33 +2,32 @@ package main
 
 import (
 	"bufio"
-	"encoding/csv"
 	"flag"
 	"fmt"
 	"log"
 	"os"
-	"os/user"
+	"path/filepath"
 	"strings"
 	"syscall"
 
 	"golang.org/x/term"
-	"golang.org/x/text/encoding/unicode"
-	"golang.org/x/text/transform"
 
-	"github.com/pkg/errors"
 	"github.com/zmb3/spotify"
 
 	"github.com/r-medina/rdbs"
+	"github.com/r-medina/rdbs/kuvo"
+	"github.com/r-medina/rdbs/playlistfile"
 	"github.com/r-medina/rdbs/rekordbox"
+	"github.com/r-medina/rdbs/traktor"
 )
 
 var (
-	dry            bool
-	useRekordbox   bool
-	uploadAll      bool
-	folderName     string
-	rekordboxDBFmt = "/Users/%s/Library/Pioneer/rekordbox/master.db"
-	manyPlaylists  int
+	dry           bool
+	useRekordbox  bool
+	uploadAll     bool
+	folderName    string
+	manyPlaylists int
+	nmlPlaylist   string
 )
 
 func help() {
@@ -36,7 +35,12 @@ func help() {
 	-d	dry run (only search song names - don't make playlist)
 	-r	read from rekordbox database instead of file
 	-a	upload all rekordbox playlists to spotify
-	-n      number of playlists to upload`)
+	-n      number of playlists to upload
+	-p	playlist name or path inside a Traktor .nml collection
+		(defaults to the spotify playlist name)
+
+<playlist-location> may be a KUVO .txt export, a Traktor .nml collection
+or an .m3u, .m3u8, .pls or .xspf file`)
 }
 
 func init() {
@@ -45,6 +49,7 @@ func init() {
 	flag.BoolVar(&uploadAll, "a", false, "upload all rekordbox playlists to spotify")
 	flag.StringVar(&folderName, "f", "rdbs", "optional folder name to group playlists in spotify")
 	flag.IntVar(&manyPlaylists, "n", 1, "number of playlists to upload")
+	flag.StringVar(&nmlPlaylist, "p", "", "playlist inside a traktor nml collection")
 }
 
 func main() {
@@ -90,17 +95,13 @@ func main() {
 	failIfError("could not get current user", err)
 	log.Printf("user: %s", spotifyUser.DisplayName)
 
-	rekordboxDB := os.Getenv("REKORDBOX_DB")
-	if rekordboxDB == "" {
-		u, err := user.Current()
-		failIfError("getting user for finding rekordbox db", err)
-		rekordboxDB = fmt.Sprintf(rekordboxDBFmt, u.Username)
+	// Playlist files don't need rekordbox installed
+	var db *rekordbox.DB
+	if useRekordbox || uploadAll {
+		db = openRekordbox()
+		defer db.Close()
 	}
 
-	db, err := rekordbox.New(rekordbox.WithDBLocation(rekordboxDB))
-	failIfError("opening rekordbox db", err)
-	defer db.Close()
-
 	if uploadAll {
 		log.Println("uploading all playlists to Spotify - just kidding")
 		// playlists, err := rekordbox.GetAllPlaylists(db)
@@ -117,14 +118,37 @@ func main() {
 		playlistLocation := flag.Args()[1]
 		log.Printf("loading %q into spotify as %q", playlistLocation, playlistName)
 		var tracks []rdbs.Track
-		if !useRekordbox {
-			data, err := readData(playlistLocation)
-			failIfError("could not read the playlist file: %+v", err)
-			tracks, err = listTracks(data)
-			failIfError("could not list tracks", err)
+		if !useRekordbox && strings.EqualFold(filepath.Ext(playlistLocation), ".nml") {
+			nml, err := traktor.ReadFile(playlistLocation)
+			failIfError("could not read the nml collection", err)
+			if nmlPlaylist == "" {
+				nmlPlaylist = playlistName
+			}
+			matches := nml.FindPlaylists(nmlPlaylist)
+			if len(matches) == 0 {
+				log.Fatalf("no playlist %q in %s", nmlPlaylist, playlistLocation)
+			}
+			tracks = matches[0].Tracks()
+		} else if !useRekordbox && playlistfile.IsSupported(playlistLocation) {
+			playlist, err := playlistfile.ReadFile(playlistLocation)
+			failIfError("could not read the playlist file", err)
+			for _, entry := range playlist.Skipped {
+				log.Printf("skipping playlist entry %q: no title found", entry.Location)
+			}
+			tracks = playlist.Tracks
+		} else if !useRekordbox {
+			export, err := kuvo.ReadFile(playlistLocation)
+			failIfError("could not read the playlist file", err)
+			for _, problem := range export.Problems {
+				log.Printf("malformed row in playlist file: %v", problem)
+			}
+			tracks = export.BasicTracks()
 		} else {
 			playlists, err := db.GetPlaylistInfo(playlistLocation)
 			failIfError("getting playlist info", err)
+			if len(playlists) == 0 {
+				log.Fatalf("no rekordbox playlist %q", playlistLocation)
+			}
 			tracks, err = db.GetPlaylistTracks(playlists[0].ID)
 			failIfError("reading playlist tracks", err)
 		}
@@ -132,6 +156,18 @@ func main() {
 	}
 }
 
+// openRekordbox finds and opens the rekordbox database, exiting if it
+// can't.
+func openRekordbox() *rekordbox.DB {
+	install, err := rekordbox.Discover()
+	failIfError("finding rekordbox db", err)
+	log.Printf("rekordbox db: %s (found via %s)", install.Path, install.Source)
+
+	db, err := rekordbox.New(rekordbox.WithDBLocation(install.Path))
+	failIfError("opening rekordbox db", err)
+	return db
+}
+
 func uploadPlaylist(spotifyClient *spotify.Client, userID, playlistName string, tracks []rdbs.Track) {
 	if !dry {
 		playlist, err := spotifyClient.CreatePlaylistForUser(userID, fmt.Sprintf("%s/%s", folderName, playlistName), "exported from rekordbox", false)
@@ -155,49 +191,6 @@ func uploadPlaylist(spotifyClient *spotify.Client, userID, playlistName string,
 	}
 }
 
-func readData(fname string) ([][]string, error) {
-	original, err := os.Open(fname)
-	if err != nil {
-		return nil, errors.WithStack(err)
-	}
-	defer original.Close()
-
-	dec := unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewDecoder()
-	utf8r := transform.NewReader(original, dec)
-	csvr := csv.NewReader(utf8r)
-
-	csvr.Comma = '\t'
-	csvr.FieldsPerRecord = -1
-	records, err := csvr.ReadAll()
-	if err != nil {
-		return nil, errors.WithStack(err)
-	}
-
-	return records, nil
-}
-
-func listTracks(data [][]string) ([]rdbs.Track, error) {
-	var tracks []rdbs.Track
-	var ia int
-	var it int
-	for j, field := range data[0] {
-		if field == "Artist" {
-			ia = j
-		} else if field == "Track Title" {
-			it = j
-		}
-	}
-	for _, d := range data[1:] {
-		if len(d) < 4 {
-			continue
-		}
-		artist := strings.TrimSpace(d[ia])
-		title := strings.TrimSpace(d[it])
-		tracks = append(tracks, rdbs.Track{Artist: artist, Title: title})
-	}
-	return tracks, nil
-}
-
 func failIfError(msg string, err error) {
 	if err == nil {
 		return
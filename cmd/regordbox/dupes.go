@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/r-medina/rdbs/rekordbox"
+)
+
+var dupesCmd = &cobra.Command{
+	Use:   "dupes",
+	Short: "Find duplicate tracks in the collection",
+	Long: `Group tracks that are likely the same recording: ones sharing an ISRC, the
+same file contents (with --hash) or the same artist and title with similar
+lengths. Each copy is listed with the playlists it's in, so you know which
+to keep.`,
+	Args: cobra.NoArgs,
+	RunE: runDupes,
+}
+
+func setupDupesFlags() {
+	dupesCmd.Flags().BoolVar(&config.DupesHash, "hash", false,
+		"Also compare file contents (reads every file whose size matches another)")
+	dupesCmd.Flags().DurationVar(&config.DupesTolerance, "duration-tolerance", rekordbox.DefaultDurationTolerance,
+		"How far apart the lengths of tracks with the same artist and title can be")
+	dupesCmd.Flags().StringVar(&config.ReportPath, "report", "",
+		"Also write the report to this file, as CSV if it ends in .csv and JSON otherwise (- writes JSON to stdout instead of the normal output)")
+}
+
+func setupDupesCommands() {
+	rootCmd.AddCommand(dupesCmd)
+}
+
+type dupesResult struct {
+	Groups []dupeGroup `json:"groups"`
+}
+
+type dupeGroup struct {
+	Reason rekordbox.DuplicateReason `json:"reason"`
+	Key    string                    `json:"key"`
+	Copies []searchHit               `json:"copies"`
+}
+
+func runDupes(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	db, err := initializeDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	groups, err := db.FindDuplicatesContext(ctx, rekordbox.DuplicateOptions{
+		DurationTolerance: config.DupesTolerance,
+		HashFiles:         config.DupesHash,
+	})
+	if err != nil {
+		return newError(codeDatabase, "Failed to find duplicates", err)
+	}
+
+	var tracks []rekordbox.FullTrack
+	for _, g := range groups {
+		tracks = append(tracks, g.Tracks...)
+	}
+	playlists, err := getTrackPlaylists(ctx, db, tracks)
+	if err != nil {
+		return err
+	}
+
+	result := dupesResult{Groups: make([]dupeGroup, len(groups))}
+	for i, g := range groups {
+		group := dupeGroup{Reason: g.Reason, Key: g.Key, Copies: make([]searchHit, len(g.Tracks))}
+		for j, t := range g.Tracks {
+			group.Copies[j] = searchHit{Track: newTrackResult(t), Playlists: playlists[t.ID]}
+		}
+		result.Groups[i] = group
+	}
+
+	if config.ReportPath != "" {
+		if err := writeReport(config.ReportPath, result, dupesCSVHeader, dupesCSVRows(result)); err != nil {
+			return err
+		}
+		if config.ReportPath == "-" {
+			// The report replaces the normal output
+			return nil
+		}
+	}
+
+	return printResult(result, func() { printDupes(result) })
+}
+
+var dupesCSVHeader = []string{
+	"group", "reason", "key", "track_id", "artist", "title", "duration_seconds", "file_type", "path", "playlists",
+}
+
+func dupesCSVRows(result dupesResult) [][]string {
+	var rows [][]string
+	for i, g := range result.Groups {
+		for _, c := range g.Copies {
+			rows = append(rows, []string{
+				strconv.Itoa(i + 1),
+				string(g.Reason),
+				g.Key,
+				c.Track.ID,
+				c.Track.Artist,
+				c.Track.Title,
+				strconv.Itoa(c.Track.DurationSeconds),
+				c.Track.FileType,
+				c.Track.Path,
+				formatPlaylistPaths(c.Playlists, "; "),
+			})
+		}
+	}
+	return rows
+}
+
+// formatPlaylistPaths joins the paths of playlists with sep.
+func formatPlaylistPaths(playlists []playlistResult, sep string) string {
+	paths := make([]string, len(playlists))
+	for i, p := range playlists {
+		paths[i] = rekordbox.FormatPlaylistPath(p.Path)
+	}
+	return strings.Join(paths, sep)
+}
+
+var dupeReasonNames = map[rekordbox.DuplicateReason]string{
+	rekordbox.DuplicateISRC:        "Same ISRC",
+	rekordbox.DuplicateFileHash:    "Same file contents",
+	rekordbox.DuplicateArtistTitle: "Same artist and title",
+}
+
+func printDupes(result dupesResult) {
+	if len(result.Groups) == 0 {
+		fmt.Println("No duplicates found")
+		return
+	}
+
+	copies := 0
+	for _, g := range result.Groups {
+		fmt.Printf("%s: %s\n", dupeReasonNames[g.Reason], g.Key)
+		for _, c := range g.Copies {
+			t := c.Track
+			length := time.Duration(t.DurationSeconds) * time.Second
+			fmt.Printf("  [%s] %s - %s (%s, %s)\n", t.ID, t.Artist, t.Title, length, t.Path)
+			if len(c.Playlists) == 0 {
+				fmt.Println("      in no playlists")
+			} else {
+				fmt.Printf("      in %s\n", formatPlaylistPaths(c.Playlists, ", "))
+			}
+		}
+		fmt.Println()
+		copies += len(g.Copies)
+	}
+
+	fmt.Printf("Total: %d groups, %d tracks\n", len(result.Groups), copies)
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/r-medina/rdbs/engine"
+	"github.com/r-medina/rdbs/export"
+	"github.com/r-medina/rdbs/rekordbox"
+	"github.com/r-medina/rdbs/serato"
+	"github.com/r-medina/rdbs/traktor"
+	"github.com/r-medina/rdbs/virtualdj"
+)
+
+var (
+	exportCmd = &cobra.Command{
+		Use:   "export",
+		Short: "Export Rekordbox playlists to other DJ software",
+		Long:  "Export one or all Rekordbox playlists, with their track metadata, into formats other DJ software can read",
+	}
+	exportTraktorCmd = &cobra.Command{
+		Use:   "traktor",
+		Short: "Export playlists to a Traktor NML collection",
+		Long:  "Write Rekordbox playlists, including BPM, key, cue points and file locations, to a Traktor collection.nml file",
+		RunE:  runExportTraktor,
+	}
+	exportSeratoCmd = &cobra.Command{
+		Use:   "serato",
+		Short: "Export playlists to Serato crates",
+		Long:  "Write Rekordbox playlists as Serato .crate files in a _Serato_ directory under --out, usually the root of a drive",
+		RunE:  runExportSerato,
+	}
+	exportEngineCmd = &cobra.Command{
+		Use:   "engine",
+		Short: "Export playlists to an Engine DJ library",
+		Long:  "Write Rekordbox playlists and track metadata to an Engine DJ m.db library under --out, usually the root of a USB drive. Tracks must be on that drive, or copied to it with --copy-audio",
+		RunE:  runExportEngine,
+	}
+	exportVirtualDJCmd = &cobra.Command{
+		Use:   "virtualdj",
+		Short: "Export playlists to VirtualDJ",
+		Long:  "Write a VirtualDJ database.xml fragment and .vdjfolder playlists, including cue points, under --out",
+		RunE:  runExportVirtualDJ,
+	}
+	exportJSONCmd = &cobra.Command{
+		Use:   "json",
+		Short: "Export playlists or the collection as JSON",
+		Long:  "Dump a playlist, a folder or the whole collection with full track metadata as JSON (use --out - for stdout)",
+		RunE:  runExportJSON,
+	}
+	exportCSVCmd = &cobra.Command{
+		Use:   "csv",
+		Short: "Export playlists or the collection as CSV",
+		Long:  "Dump a playlist, a folder or the whole collection with full track metadata as CSV, one row per track (use --out - for stdout)",
+		RunE:  runExportCSV,
+	}
+	importCmd = &cobra.Command{
+		Use:   "import",
+		Short: "Convert playlists from other DJ software",
+		Long:  "Convert playlists from other DJ software into a Rekordbox XML library that Rekordbox can import",
+	}
+	importTraktorCmd = &cobra.Command{
+		Use:   "traktor <collection.nml>",
+		Short: "Convert a Traktor NML collection to Rekordbox XML",
+		Long:  "Read the playlists in a Traktor collection.nml file and write them as a Rekordbox XML library",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runImportTraktor,
+	}
+)
+
+func setupExportFlags() {
+	exportCmd.PersistentFlags().StringVarP(&config.OutputPath, "out", "o", "",
+		"Output file or directory (required)")
+	exportCmd.MarkPersistentFlagRequired("out")
+
+	exportCmd.PersistentFlags().StringVar(&config.RekordboxPlaylist, "playlist", "",
+		"Name, path (Folder/Playlist) or ID of Rekordbox playlist to export (will prompt if not provided)")
+
+	exportCmd.PersistentFlags().BoolVar(&config.ExportAll, "all", false,
+		"Export every playlist that has tracks")
+
+	exportCmd.PersistentFlags().StringVar(&config.ExportFolder, "folder", "",
+		"Name, path or ID of Rekordbox folder whose playlists to export")
+
+	for _, cmd := range []*cobra.Command{exportJSONCmd, exportCSVCmd} {
+		cmd.Flags().BoolVar(&config.ExportCollection, "collection", false,
+			"Export every track in the collection instead of playlists")
+	}
+
+	exportTraktorCmd.Flags().StringVar(&config.TraktorVolume, "volume", traktor.DefaultVolume,
+		"Traktor volume name of the system disk")
+
+	exportEngineCmd.Flags().BoolVar(&config.EngineCopyAudio, "copy-audio", false,
+		"Copy audio files that aren't on the --out drive into it instead of skipping their tracks")
+
+	importCmd.PersistentFlags().StringVarP(&config.OutputPath, "out", "o", "",
+		"Output file (required)")
+	importCmd.MarkPersistentFlagRequired("out")
+
+	importTraktorCmd.Flags().StringVar(&config.TraktorVolume, "volume", traktor.DefaultVolume,
+		"Traktor volume name of the system disk")
+}
+
+func setupExportCommands() {
+	exportCmd.AddCommand(exportTraktorCmd)
+	exportCmd.AddCommand(exportSeratoCmd)
+	exportCmd.AddCommand(exportEngineCmd)
+	exportCmd.AddCommand(exportVirtualDJCmd)
+	exportCmd.AddCommand(exportJSONCmd)
+	exportCmd.AddCommand(exportCSVCmd)
+	importCmd.AddCommand(importTraktorCmd)
+	rootCmd.AddCommand(exportCmd)
+	rootCmd.AddCommand(importCmd)
+}
+
+// exportResult summarizes an export or import.
+type exportResult struct {
+	Format    string   `json:"format"`
+	Output    string   `json:"output"`
+	Playlists int      `json:"playlists"`
+	Files     []string `json:"files,omitempty"`
+}
+
+func runExportTraktor(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	playlists, err := loadExportPlaylists(ctx, true)
+	if err != nil {
+		return err
+	}
+
+	nml := traktor.New()
+	nml.SystemVolume = config.TraktorVolume
+	for _, playlist := range playlists {
+		nml.AddPlaylist(playlist)
+	}
+
+	if err := nml.WriteFile(config.OutputPath); err != nil {
+		return newError(codeIO, "Failed to write NML collection", err)
+	}
+
+	result := exportResult{"traktor", config.OutputPath, len(playlists), []string{config.OutputPath}}
+	return printResult(result, func() {
+		log.Printf("Exported %d playlists to %s", len(playlists), config.OutputPath)
+	})
+}
+
+func runExportSerato(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	playlists, err := loadExportPlaylists(ctx, false)
+	if err != nil {
+		return err
+	}
+
+	root, err := filepath.Abs(config.OutputPath)
+	if err != nil {
+		return newError(codeIO, "Failed to resolve output directory", err)
+	}
+	volume := serato.Volume(root)
+
+	crates := make([]*serato.Crate, 0, len(playlists))
+	for _, playlist := range playlists {
+		crate, skipped := serato.CrateFromPlaylist(playlist, volume)
+		for _, track := range skipped {
+			log.Printf("Skipping %s - %s in %s: %s is not on %s",
+				track.Artist, track.Title, rekordbox.FormatPlaylistPath(playlist.Path), track.FolderPath, volume)
+		}
+		crates = append(crates, crate)
+	}
+
+	written, err := serato.WriteLibrary(config.OutputPath, crates)
+	if err != nil {
+		return newError(codeIO, "Failed to write Serato crates", err)
+	}
+
+	result := exportResult{"serato", config.OutputPath, len(playlists), written}
+	return printResult(result, func() {
+		log.Printf("Wrote %d crates to %s", len(written), filepath.Join(config.OutputPath, serato.DirName))
+	})
+}
+
+func runExportEngine(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	playlists, err := loadExportPlaylists(ctx, false)
+	if err != nil {
+		return err
+	}
+
+	path, skipped, err := engine.Export(config.OutputPath, playlists, engine.Options{CopyAudio: config.EngineCopyAudio})
+	if err != nil {
+		return newError(codeIO, "Failed to write Engine DJ library", err)
+	}
+	for _, track := range skipped {
+		if config.EngineCopyAudio {
+			log.Printf("Skipping %s - %s: %s not found", track.Artist, track.Title, track.FolderPath)
+		} else {
+			log.Printf("Skipping %s - %s: %s is not under %s (use --copy-audio to copy it)",
+				track.Artist, track.Title, track.FolderPath, config.OutputPath)
+		}
+	}
+
+	result := exportResult{"engine", config.OutputPath, len(playlists), []string{path}}
+	return printResult(result, func() {
+		log.Printf("Exported %d playlists to %s", len(playlists), path)
+	})
+}
+
+func runExportVirtualDJ(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	playlists, err := loadExportPlaylists(ctx, true)
+	if err != nil {
+		return err
+	}
+
+	written, err := virtualdj.Export(config.OutputPath, playlists)
+	if err != nil {
+		return newError(codeIO, "Failed to write VirtualDJ files", err)
+	}
+
+	result := exportResult{"virtualdj", config.OutputPath, len(playlists), written}
+	return printResult(result, func() {
+		log.Printf("Wrote %d files to %s", len(written), config.OutputPath)
+	})
+}
+
+func runExportJSON(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	doc, err := buildExportDocument(ctx)
+	if err != nil {
+		return err
+	}
+	return writeExportDocument("json", doc, doc.WriteJSON)
+}
+
+func runExportCSV(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	doc, err := buildExportDocument(ctx)
+	if err != nil {
+		return err
+	}
+	return writeExportDocument("csv", doc, doc.WriteCSV)
+}
+
+// writeExportDocument writes doc to --out with write. A summary is only
+// printed in JSON mode when the document didn't go to stdout itself.
+func writeExportDocument(format string, doc *export.Document, write func(io.Writer) error) error {
+	out, err := createOutput(config.OutputPath)
+	if err != nil {
+		return newError(codeIO, "Failed to create output file", err)
+	}
+
+	err = write(out)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return newError(codeIO, "Failed to write "+strings.ToUpper(format), err)
+	}
+	if config.OutputPath == "-" {
+		return nil
+	}
+
+	result := exportResult{Format: format, Output: config.OutputPath, Playlists: len(doc.Playlists)}
+	return printResult(result, func() {})
+}
+
+func buildExportDocument(ctx context.Context) (*export.Document, error) {
+	if config.ExportCollection {
+		db, err := initializeDB()
+		if err != nil {
+			return nil, err
+		}
+		defer db.Close()
+
+		tracks, err := db.GetAllTracksContext(ctx)
+		if err != nil {
+			return nil, newError(codeDatabase, "Failed to get collection tracks", err)
+		}
+		return newExportDocument(nil, tracks), nil
+	}
+
+	playlists, err := loadExportPlaylists(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	return newExportDocument(playlists, nil), nil
+}
+
+// newExportDocument builds a document with its keys in --key-notation.
+func newExportDocument(playlists []*rekordbox.FullPlaylist, tracks []rekordbox.FullTrack) *export.Document {
+	doc := export.NewDocument(playlists, tracks)
+	for i := range doc.Tracks {
+		doc.Tracks[i].Key = formatKey(doc.Tracks[i].Key)
+	}
+	for _, p := range doc.Playlists {
+		for i := range p.Tracks {
+			p.Tracks[i].Key = formatKey(p.Tracks[i].Key)
+		}
+	}
+	return doc
+}
+
+// createOutput creates the file at path, or returns stdout for "-".
+func createOutput(path string) (io.WriteCloser, error) {
+	if path == "-" {
+		return nopCloser{os.Stdout}, nil
+	}
+	return os.Create(path)
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+func runImportTraktor(cmd *cobra.Command, args []string) error {
+	nml, err := traktor.ReadFile(args[0])
+	if err != nil {
+		return newError(codeIO, "Failed to read NML collection", err)
+	}
+	nml.SystemVolume = config.TraktorVolume
+
+	playlists := nml.FullPlaylists()
+
+	f, err := os.Create(config.OutputPath)
+	if err != nil {
+		return newError(codeIO, "Failed to create Rekordbox XML file", err)
+	}
+
+	err = rekordbox.WriteXML(f, playlists)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return newError(codeIO, "Failed to write Rekordbox XML", err)
+	}
+
+	result := exportResult{"rekordbox", config.OutputPath, len(playlists), []string{config.OutputPath}}
+	return printResult(result, func() {
+		log.Printf("Converted %d playlists to %s", len(playlists), config.OutputPath)
+	})
+}
+
+// loadExportPlaylists opens the database and returns the playlists selected
+// for export.
+func loadExportPlaylists(ctx context.Context, loadCues bool) ([]*rekordbox.FullPlaylist, error) {
+	db, err := initializeDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return getExportPlaylists(ctx, db, loadCues)
+}
+
+// getExportPlaylists returns the playlists selected for export with
+// their tracks and hierarchy paths loaded, and cue points if loadCues is set.
+func getExportPlaylists(ctx context.Context, db *rekordbox.DB, loadCues bool) ([]*rekordbox.FullPlaylist, error) {
+	hierarchy, err := getPlaylistHierarchy(ctx, db, rekordbox.WithTrackCounts())
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes []*rekordbox.PlaylistNode
+	switch {
+	case config.ExportAll:
+		nodes = collectPlaylistsWithTracks(hierarchy)
+	case config.ExportFolder != "":
+		folder, err := findPlaylistNode(ctx, db, hierarchy, config.ExportFolder)
+		if err != nil {
+			return nil, err
+		}
+		nodes = collectPlaylistsWithTracks(folder)
+	default:
+		node, err := selectRekordboxPlaylistNode(ctx, db, hierarchy)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+
+	playlists := make([]*rekordbox.FullPlaylist, 0, len(nodes))
+	for _, node := range nodes {
+		playlist, err := db.GetFullPlaylistContext(ctx, node.Playlist.ID)
+		if err != nil {
+			return nil, newError(codeDatabase, "Failed to get playlist", err)
+		}
+		if loadCues {
+			if err := db.LoadPlaylistCuesContext(ctx, playlist); err != nil {
+				return nil, newError(codeDatabase, "Failed to get cue points", err)
+			}
+		}
+		playlist.Path = node.Playlist.Path
+		playlists = append(playlists, playlist)
+	}
+
+	return playlists, nil
+}
@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"sort"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/lithammer/fuzzysearch/fuzzy"
 	"github.com/manifoldco/promptui"
@@ -15,6 +18,7 @@ import (
 	"golang.org/x/term"
 
 	"github.com/r-medina/rdbs"
+	"github.com/r-medina/rdbs/export"
 	"github.com/r-medina/rdbs/rekordbox"
 )
 
@@ -25,6 +29,30 @@ type Config struct {
 	SpotifySecret       string
 	SpotifyPlaylistName string
 	RekordboxPlaylist   string
+	OutputPath          string
+	ExportAll           bool
+	ExportFolder        string
+	ExportCollection    bool
+	TraktorVolume       string
+	EngineCopyAudio     bool
+	Output              string
+	NonInteractive      bool
+	SyncConfig          string
+	WatchDebounce       time.Duration
+	SkipInitialSync     bool
+	WatchMark           string
+	Snapshot            bool
+	DBKey               string
+	SearchFilters       rekordbox.SearchFilters
+	SearchAddedAfter    string
+	SearchAddedBefore   string
+	DupesHash           bool
+	DupesTolerance      time.Duration
+	ReportPath          string
+	MissingRoots        []string
+	MissingTags         bool
+	StatsOptions        rekordbox.StatsOptions
+	KeyNotation         string
 }
 
 var config Config
@@ -33,25 +61,34 @@ var (
 	rootCmd = &cobra.Command{
 		Use:   "rdbs",
 		Short: "Rekordbox playlist management tool",
-		Long:  "A CLI tool for managing Rekordbox playlists and syncing them to Spotify",
+		Long:  "A CLI tool for managing Rekordbox playlists and syncing them to Spotify\n\n" + exitCodeHelp,
+
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateOutput(); err != nil {
+				return err
+			}
+			return validateKeyNotation()
+		},
 	}
 	selectCmd = &cobra.Command{
 		Use:   "select",
 		Short: "Select a playlist and display its tracks",
 		Long:  "Interactively select a Rekordbox playlist and display all tracks in it",
-		Run:   runSelect,
+		RunE:  runSelect,
 	}
 	treeCmd = &cobra.Command{
 		Use:   "tree",
 		Short: "Print the Rekordbox playlist directory tree",
 		Long:  "Display the complete Rekordbox playlist hierarchy as a directory tree",
-		Run:   runTree,
+		RunE:  runTree,
 	}
 	spotifyCmd = &cobra.Command{
 		Use:   "spotify",
 		Short: "Sync a Rekordbox playlist to Spotify",
 		Long:  "Create or update a Spotify playlist with tracks from a Rekordbox playlist",
-		Run:   runSpotify,
+		RunE:  runSpotify,
 	}
 )
 
@@ -61,13 +98,39 @@ func main() {
 	setupFlags()
 	setupCommands()
 
-	failIfError("Command execution faile", rootCmd.Execute())
+	// Ctrl-C cancels the context, which stops any running queries. A
+	// second Ctrl-C kills the process as usual.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	context.AfterFunc(ctx, stop)
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
+	if err != nil {
+		os.Exit(reportError(err))
+	}
 }
 
 func setupFlags() {
 	// Global flags
 	rootCmd.PersistentFlags().StringVar(&config.DBLocation, "db", "",
-		"Path to the Rekordbox database file (default: system default)")
+		"Path to the Rekordbox database file (default: $REKORDBOX_DB or found automatically)")
+
+	rootCmd.PersistentFlags().StringVar(&config.Output, "output", outputText,
+		"Output format: text or json")
+
+	rootCmd.PersistentFlags().StringVar(&config.DBKey, "db-key", "",
+		"Key to decrypt the database with (default: $REKORDBOX_DB_KEY or the known Rekordbox keys)")
+
+	rootCmd.PersistentFlags().BoolVar(&config.Snapshot, "snapshot", false,
+		"Read a temporary copy of the database so a running Rekordbox isn't disturbed")
+
+	rootCmd.PersistentFlags().StringVar(&config.KeyNotation, "key-notation", "",
+		"Print keys as musical, camelot or open-key (default: as stored in Rekordbox)")
+
+	rootCmd.PersistentFlags().BoolVar(&config.NonInteractive, "non-interactive", false,
+		"Never prompt; fail instead when input is missing or a playlist name is ambiguous")
+
+	selectCmd.Flags().StringVar(&config.RekordboxPlaylist, "playlist", "",
+		"Name, path (Folder/Playlist) or ID of Rekordbox playlist (will prompt if not provided)")
 
 	// Spotify command flags
 	spotifyCmd.Flags().StringVar(&config.SpotifyClientID, "spotify-client-id", "",
@@ -78,128 +141,357 @@ func setupFlags() {
 		"Spotify client secret (will prompt if not provided)")
 
 	spotifyCmd.Flags().StringVar(&config.SpotifyPlaylistName, "spotify-playlist-name", "",
-		"Name of Spotify playlist (will prompt if not provided)")
+		"Name or ID of Spotify playlist (will prompt if not provided)")
 
 	spotifyCmd.Flags().StringVar(&config.RekordboxPlaylist, "rekordbox-playlist-name", "",
-		"Name of Rekordbox playlist (will prompt if not provided)")
+		"Name, path (Folder/Playlist) or ID of Rekordbox playlist (will prompt if not provided)")
+
+	setupExportFlags()
+	setupSyncFlags()
+	setupWatchFlags()
+	setupSearchFlags()
+	setupDupesFlags()
+	setupMissingFlags()
+	setupStatsFlags()
 }
 
 func setupCommands() {
 	rootCmd.AddCommand(selectCmd)
 	rootCmd.AddCommand(treeCmd)
 	rootCmd.AddCommand(spotifyCmd)
+	setupExportCommands()
+	setupSyncCommands()
+	setupWatchCommands()
+	setupSchemaCommands()
+	setupSearchCommands()
+	setupDupesCommands()
+	setupMissingCommands()
+	setupStatsCommands()
+}
+
+// playlistResult identifies a Rekordbox playlist in JSON output.
+type playlistResult struct {
+	ID   string   `json:"id"`
+	Name string   `json:"name"`
+	Path []string `json:"path"`
+}
+
+func newPlaylistResult(p *rekordbox.FullPlaylist) playlistResult {
+	path := p.Path
+	if len(path) == 0 {
+		path = []string{p.Name}
+	}
+	return playlistResult{ID: p.ID, Name: p.Name, Path: path}
 }
 
-func runSelect(cmd *cobra.Command, args []string) {
-	db := mustInitializeDB()
+type selectResult struct {
+	Playlist playlistResult `json:"playlist"`
+	Tracks   []export.Track `json:"tracks"`
+}
+
+func runSelect(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	db, err := initializeDB()
+	if err != nil {
+		return err
+	}
 	defer db.Close()
 
-	playlist, pathName := mustSelectRekordboxPlaylist(db)
-	tracks := mustGetPlaylistTracks(db, playlist.ID)
+	hierarchy, err := getPlaylistHierarchy(ctx, db, rekordbox.WithTrackCounts())
+	if err != nil {
+		return err
+	}
+	node, err := selectRekordboxPlaylistNode(ctx, db, hierarchy)
+	if err != nil {
+		return err
+	}
+	playlist := node.Playlist
+	pathName := strings.Join(playlist.Path, " > ")
+
+	tracks, err := db.GetPlaylistTracksDetailedContext(ctx, playlist.ID)
+	if err != nil {
+		return newError(codeDatabase, "Failed to get playlist tracks", err)
+	}
 
-	printTrackList(tracks, pathName)
+	result := selectResult{
+		Playlist: newPlaylistResult(playlist),
+		Tracks:   newTrackResults(tracks),
+	}
+	return printResult(result, func() { printTrackList(result.Tracks, pathName) })
+}
+
+// treeNode is a playlist or folder in JSON output.
+type treeNode struct {
+	ID       string      `json:"id"`
+	Name     string      `json:"name"`
+	Kind     string      `json:"kind"`
+	Path     []string    `json:"path"`
+	Children []*treeNode `json:"children,omitempty"`
 }
 
-func runTree(cmd *cobra.Command, args []string) {
-	db := mustInitializeDB()
+func runTree(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	db, err := initializeDB()
+	if err != nil {
+		return err
+	}
 	defer db.Close()
 
-	hierarchy := mustGetPlaylistHierarchy(db)
-	printDirectoryTree(hierarchy)
+	hierarchy, err := getPlaylistHierarchy(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	result := struct {
+		Playlists []*treeNode `json:"playlists"`
+	}{newTreeNodes(hierarchy.Children)}
+	return printResult(result, func() { printDirectoryTree(hierarchy) })
+}
+
+func newTreeNodes(nodes []*rekordbox.PlaylistNode) []*treeNode {
+	out := make([]*treeNode, 0, len(nodes))
+	for _, node := range sortedNodes(nodes) {
+		out = append(out, &treeNode{
+			ID:       node.Playlist.ID,
+			Name:     node.Playlist.Name,
+			Kind:     string(node.Playlist.Kind()),
+			Path:     node.Playlist.Path,
+			Children: newTreeNodes(node.Children),
+		})
+	}
+	return out
+}
+
+// syncResult summarizes a sync to Spotify.
+type syncResult struct {
+	SpotifyPlaylistID   spotify.ID     `json:"spotify_playlist_id"`
+	RekordboxPlaylistID string         `json:"rekordbox_playlist_id"`
+	Searched            int            `json:"searched"`
+	Found               int            `json:"found"`
+	Added               int            `json:"added"`
+	NotFound            []trackResult  `json:"not_found"`
+	Failed              []failedResult `json:"failed"`
+}
+
+type trackResult struct {
+	Artist string `json:"artist"`
+	Title  string `json:"title"`
+}
+
+type failedResult struct {
+	trackResult
+	Error string `json:"error"`
 }
 
-func runSpotify(cmd *cobra.Command, args []string) {
-	db := mustInitializeDB()
+func runSpotify(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	db, err := initializeDB()
+	if err != nil {
+		return err
+	}
 	defer db.Close()
 
 	// Get Spotify credentials and authenticate
-	ensureSpotifySecret()
-	spotifyClient := mustAuthenticateSpotify()
+	if err := ensureSpotifySecret(ctx); err != nil {
+		return err
+	}
+	spotifyClient, err := authenticateSpotify(ctx)
+	if err != nil {
+		return err
+	}
 
 	// Get or create Spotify playlist
-	spotifyUser := mustGetCurrentSpotifyUser(spotifyClient)
-	spotifyPlaylistID := mustGetOrCreateSpotifyPlaylist(spotifyClient, spotifyUser.ID)
+	spotifyUser, err := getCurrentSpotifyUser(spotifyClient)
+	if err != nil {
+		return err
+	}
+	spotifyPlaylistID, err := getOrCreateSpotifyPlaylist(spotifyClient, spotifyUser.ID)
+	if err != nil {
+		return err
+	}
 
 	// Get Rekordbox playlist and tracks
-	rekordboxPlaylistID := mustSelectRekordboxPlaylistID(db)
-	tracks := mustGetPlaylistTracks(db, rekordboxPlaylistID)
+	rekordboxPlaylistID, err := selectRekordboxPlaylistID(ctx, db)
+	if err != nil {
+		return err
+	}
+	tracks, err := getPlaylistTracks(ctx, db, rekordboxPlaylistID)
+	if err != nil {
+		return err
+	}
 
 	// Sync to Spotify
-	syncTracksToSpotify(spotifyClient, spotifyPlaylistID, tracks)
+	result := syncTracksToSpotify(ctx, spotifyClient, spotifyPlaylistID, tracks)
+	if err := ctx.Err(); err != nil {
+		return newError(codeCancelled, fmt.Sprintf("Sync cancelled after adding %d tracks", result.Added), err)
+	}
+	result.RekordboxPlaylistID = rekordboxPlaylistID
+	return printResult(result, func() {
+		log.Printf("Successfully added %d tracks to playlist", result.Added)
+	})
 }
 
 // Database operations
-func mustInitializeDB() *rekordbox.DB {
-	var db *rekordbox.DB
-	var err error
+// initializeDB opens the database given by --db or found by discovery,
+// with any extra options.
+func initializeDB(extra ...rekordbox.Option) (*rekordbox.DB, error) {
+	opts := extra
 
 	if config.DBLocation != "" {
 		log.Printf("Using database: %s", config.DBLocation)
-		db, err = rekordbox.New(rekordbox.WithDBLocation(config.DBLocation))
+		opts = append(opts, rekordbox.WithDBLocation(config.DBLocation))
 	} else {
-		log.Printf("Using system default database location")
-		db, err = rekordbox.New()
+		install, err := rekordbox.Discover()
+		if err != nil {
+			return nil, newError(codeNotFound, "Failed to find the Rekordbox database", err)
+		}
+		version := install.Version
+		if version == "" {
+			version = "unknown version"
+		}
+		log.Printf("Using database: %s (Rekordbox %s, found via %s)", install.Path, version, install.Source)
+		opts = append(opts, rekordbox.WithDBLocation(install.Path))
 	}
 
-	failIfError("Failed to initialize database", err)
+	return openDB(append(opts, dbOptions()...)...)
+}
 
-	return db
+// dbOptions returns the database options set by global flags, other than
+// its location.
+func dbOptions() []rekordbox.Option {
+	var opts []rekordbox.Option
+	if config.Snapshot {
+		opts = append(opts, rekordbox.WithSnapshot())
+	}
+	if config.DBKey != "" {
+		opts = append(opts, rekordbox.WithKey(config.DBKey))
+	}
+	return opts
 }
 
-func mustGetPlaylistHierarchy(db *rekordbox.DB) *rekordbox.PlaylistNode {
-	hierarchy, err := db.GetPlaylistHierarchy()
-	failIfError("Failed to get playlist hierarchy", err)
-	return hierarchy
+// openDB opens a database and logs how it was read.
+func openDB(opts ...rekordbox.Option) (*rekordbox.DB, error) {
+	db, err := rekordbox.New(opts...)
+	if err != nil {
+		return nil, newError(codeDatabase, "Failed to initialize database", err)
+	}
+	if db.Cipher() != rekordbox.KnownCiphers[0] {
+		log.Printf("Opened database with %s", db.Cipher())
+	}
+	if schema := db.Schema(); schema.Version != "" {
+		log.Printf("Database schema version %s", schema.Version)
+	}
+	if variants := db.Schema().Variants; len(variants) > 0 {
+		log.Printf("Adapted queries to schema: %s", strings.Join(variants, ", "))
+	}
+
+	return db, nil
+}
+
+func getPlaylistHierarchy(ctx context.Context, db *rekordbox.DB, opts ...rekordbox.HierarchyOption) (*rekordbox.PlaylistNode, error) {
+	hierarchy, err := db.GetPlaylistHierarchyContext(ctx, opts...)
+	if err != nil {
+		return nil, newError(codeDatabase, "Failed to get playlist hierarchy", err)
+	}
+	return hierarchy, nil
 }
 
-func mustGetPlaylistTracks(db *rekordbox.DB, playlistID string) []rdbs.Track {
-	tracks, err := db.GetPlaylistTracks(playlistID)
-	failIfError("Failed to get playlist tracks", err)
-	return tracks
+func getPlaylistTracks(ctx context.Context, db *rekordbox.DB, playlistID string) ([]rdbs.Track, error) {
+	tracks, err := db.GetPlaylistTracksContext(ctx, playlistID)
+	if err != nil {
+		return nil, newError(codeDatabase, "Failed to get playlist tracks", err)
+	}
+	return tracks, nil
 }
 
 // Playlist selection
-func mustSelectRekordboxPlaylist(db *rekordbox.DB) (*rekordbox.FullPlaylist, string) {
-	hierarchy := mustGetPlaylistHierarchy(db)
-	playlists := collectPlaylistsWithTracks(hierarchy, db)
+// selectRekordboxPlaylistID resolves --playlist to a playlist ID, or
+// prompts for one if it isn't given.
+func selectRekordboxPlaylistID(ctx context.Context, db *rekordbox.DB) (string, error) {
+	hierarchy, err := getPlaylistHierarchy(ctx, db, rekordbox.WithTrackCounts())
+	if err != nil {
+		return "", err
+	}
+	node, err := selectRekordboxPlaylistNode(ctx, db, hierarchy)
+	if err != nil {
+		return "", err
+	}
+	return node.Playlist.ID, nil
+}
 
-	if len(playlists) == 0 {
-		log.Fatal("No playlists with tracks found")
+// selectRekordboxPlaylistNode resolves --playlist in hierarchy, or prompts
+// for one of its playlists with tracks if it isn't given. hierarchy should
+// be loaded with track counts.
+func selectRekordboxPlaylistNode(ctx context.Context, db *rekordbox.DB, hierarchy *rekordbox.PlaylistNode) (*rekordbox.PlaylistNode, error) {
+	if config.RekordboxPlaylist != "" {
+		return findPlaylistNode(ctx, db, hierarchy, config.RekordboxPlaylist)
+	}
+	if config.NonInteractive {
+		return nil, errorf(codeUsage, "No Rekordbox playlist given (required with --non-interactive)")
 	}
 
+	playlists := collectPlaylistsWithTracks(hierarchy)
+	if len(playlists) == 0 {
+		return nil, errorf(codeNotFound, "No playlists with tracks found")
+	}
 	return selectFromPlaylistCollection(playlists)
 }
 
-func mustSelectRekordboxPlaylistID(db *rekordbox.DB) string {
-	if config.RekordboxPlaylist == "" {
-		playlist, _ := mustSelectRekordboxPlaylist(db)
-		return playlist.ID
+// findPlaylistNode resolves ref to a playlist or folder in hierarchy. ref
+// is a path from the root such as "House/Deep/Late Night", a name, or an
+// ID, tried in that order. hierarchy should be loaded with track counts so
+// ambiguous matches can be told apart.
+func findPlaylistNode(ctx context.Context, db *rekordbox.DB, hierarchy *rekordbox.PlaylistNode, ref string) (*rekordbox.PlaylistNode, error) {
+	if rekordbox.IsPlaylistPath(ref) {
+		switch nodes := hierarchy.FindPath(rekordbox.ParsePlaylistPath(ref)); len(nodes) {
+		case 0:
+			// A name can contain the separator too
+		case 1:
+			return nodes[0], nil
+		default:
+			return selectFromMultipleMatches(ref, nodes)
+		}
 	}
 
-	return findPlaylistIDByName(db, config.RekordboxPlaylist)
-}
+	playlists, err := db.GetPlaylistInfoContext(ctx, ref)
+	if err != nil {
+		return nil, newError(codeDatabase, fmt.Sprintf("Failed to get playlist %q info", ref), err)
+	}
 
-func findPlaylistIDByName(db *rekordbox.DB, name string) string {
-	playlists, err := db.GetPlaylistInfo(name)
-	failIfError(fmt.Sprintf("Failed to get playlist %q info", name), err)
+	var nodes []*rekordbox.PlaylistNode
+	for _, p := range playlists {
+		// Skip deleted playlists, which aren't in the hierarchy
+		if node := hierarchy.Find(p.ID); node != nil {
+			nodes = append(nodes, node)
+		}
+	}
 
-	switch len(playlists) {
+	switch len(nodes) {
 	case 0:
-		log.Fatalf("No playlist found with name '%s'", name)
+		if node := hierarchy.Find(ref); node != nil {
+			return node, nil
+		}
+		return nil, errorf(codeNotFound, "No playlist found with name, path or ID '%s'", ref)
 	case 1:
-		return playlists[0].ID
+		return nodes[0], nil
 	default:
-		return selectFromMultipleMatches(db, playlists)
+		return selectFromMultipleMatches(ref, nodes)
 	}
-	return ""
 }
 
-func selectFromMultipleMatches(db *rekordbox.DB, playlists []rekordbox.PlaylistInfo) string {
-	formatted := make([]string, len(playlists))
-	for i, p := range playlists {
-		full, err := db.GetFullPlaylist(p.ID)
-		failIfError("Failed to get full playlist info", err)
-		formatted[i] = strings.Join(full.Path, " > ")
+func selectFromMultipleMatches(ref string, nodes []*rekordbox.PlaylistNode) (*rekordbox.PlaylistNode, error) {
+	formatted := make([]string, len(nodes))
+	for i, node := range nodes {
+		formatted[i] = fmt.Sprintf("%s (%s)", strings.Join(node.Playlist.Path, " > "), describePlaylist(node.Playlist))
+	}
+
+	if config.NonInteractive {
+		candidates := make([]string, len(nodes))
+		for i, node := range nodes {
+			candidates[i] = fmt.Sprintf("%s (ID %s)", rekordbox.FormatPlaylistPath(node.Playlist.Path), node.Playlist.ID)
+		}
+		return nil, errorf(codeAmbiguous, "Playlist '%s' is ambiguous, use a full path or ID instead: %s",
+			ref, strings.Join(candidates, ", "))
 	}
 
 	prompt := promptui.Select{
@@ -210,37 +502,51 @@ func selectFromMultipleMatches(db *rekordbox.DB, playlists []rekordbox.PlaylistI
 	}
 
 	i, _, err := prompt.Run()
-	failIfError("Failed to select playlist", err)
+	if err != nil {
+		return nil, newError(codeUsage, "Failed to select playlist", err)
+	}
 
-	return playlists[i].ID
+	return nodes[i], nil
 }
 
-func collectPlaylistsWithTracks(node *rekordbox.PlaylistNode, db *rekordbox.DB) []*rekordbox.PlaylistNode {
+// describePlaylist describes the kind and size of a playlist from a
+// hierarchy loaded with track counts.
+func describePlaylist(p *rekordbox.FullPlaylist) string {
+	switch p.Kind() {
+	case rekordbox.KindFolder:
+		return "folder"
+	case rekordbox.KindSmart:
+		return "smart playlist"
+	default:
+		return fmt.Sprintf("%d tracks", p.TrackCount)
+	}
+}
+
+// collectPlaylistsWithTracks returns the playlists under node that have
+// tracks. node must come from a hierarchy loaded with track counts.
+func collectPlaylistsWithTracks(node *rekordbox.PlaylistNode) []*rekordbox.PlaylistNode {
 	var playlists []*rekordbox.PlaylistNode
-	collectPlaylistsWithTracksRecursive(node, &playlists, db)
+	collectPlaylistsWithTracksRecursive(node, &playlists)
 	return playlists
 }
 
-func collectPlaylistsWithTracksRecursive(node *rekordbox.PlaylistNode, playlists *[]*rekordbox.PlaylistNode, db *rekordbox.DB) {
-	if node.Playlist != nil {
-		tracks, err := db.GetPlaylistTracks(node.Playlist.ID)
-		if err != nil {
-			log.Printf("Warning: could not get tracks for playlist %s: %v", node.Playlist.Name, err)
-		} else if len(tracks) > 0 {
-			*playlists = append(*playlists, node)
-		}
+func collectPlaylistsWithTracksRecursive(node *rekordbox.PlaylistNode, playlists *[]*rekordbox.PlaylistNode) {
+	if node.Playlist != nil && node.Playlist.TrackCount > 0 {
+		*playlists = append(*playlists, node)
 	}
 
 	for _, child := range node.Children {
-		collectPlaylistsWithTracksRecursive(child, playlists, db)
+		collectPlaylistsWithTracksRecursive(child, playlists)
 	}
 }
 
-func selectFromPlaylistCollection(playlists []*rekordbox.PlaylistNode) (*rekordbox.FullPlaylist, string) {
+func selectFromPlaylistCollection(playlists []*rekordbox.PlaylistNode) (*rekordbox.PlaylistNode, error) {
 	formatted := make([]string, len(playlists))
+	labels := make([]string, len(playlists))
 	for i, p := range playlists {
 		if p.Playlist != nil {
 			formatted[i] = strings.Join(p.Playlist.Path, " > ")
+			labels[i] = fmt.Sprintf("%s (%s)", formatted[i], describePlaylist(p.Playlist))
 		}
 	}
 
@@ -256,7 +562,7 @@ func selectFromPlaylistCollection(playlists []*rekordbox.PlaylistNode) (*rekordb
 
 	prompt := promptui.Select{
 		Label:             "Select a playlist (type to search)",
-		Items:             formatted,
+		Items:             labels,
 		Size:              adjustedHeight,
 		Stdout:            os.Stderr,
 		Searcher:          searcher,
@@ -264,45 +570,90 @@ func selectFromPlaylistCollection(playlists []*rekordbox.PlaylistNode) (*rekordb
 	}
 
 	i, _, err := prompt.Run()
-	failIfError("Failed to select playlist", err)
+	if err != nil {
+		return nil, newError(codeUsage, "Failed to select playlist", err)
+	}
 
-	return playlists[i].Playlist, formatted[i]
+	return playlists[i], nil
 }
 
 // Spotify operations
-func ensureSpotifySecret() {
+func ensureSpotifySecret(ctx context.Context) error {
 	if config.SpotifySecret != "" {
-		return
+		return nil
+	}
+	if config.NonInteractive {
+		return errorf(codeUsage, "--spotify-secret is required with --non-interactive")
 	}
 
-	fmt.Print("Enter your Spotify client secret: ")
-	secretBytes, err := term.ReadPassword(int(syscall.Stdin))
-	failIfError("Failed to read Spotify secret", err)
+	fmt.Fprint(os.Stderr, "Enter your Spotify client secret: ")
+	secretBytes, err := readPassword(ctx)
+	fmt.Fprintln(os.Stderr) // newline after password input
+	if err != nil {
+		return newError(codeUsage, "Failed to read Spotify secret", err)
+	}
 	config.SpotifySecret = string(secretBytes)
-	fmt.Println() // newline after password input
+	return nil
+}
+
+// readPassword reads a line from the terminal without echoing it. Unlike
+// term.ReadPassword it returns once ctx is done, restoring the terminal.
+func readPassword(ctx context.Context) ([]byte, error) {
+	fd := int(syscall.Stdin)
+	state, err := term.GetState(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		password []byte
+		err      error
+	}
+	done := make(chan result, 1)
+	go func() {
+		password, err := term.ReadPassword(fd)
+		done <- result{password, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.password, r.err
+	case <-ctx.Done():
+		term.Restore(fd, state)
+		return nil, ctx.Err()
+	}
 }
 
-func mustAuthenticateSpotify() *spotify.Client {
+func authenticateSpotify(ctx context.Context) (*spotify.Client, error) {
 	log.Println("Opening browser to authenticate with Spotify...")
 
-	client, err := rdbs.SpotifyOAuthClient(config.SpotifyClientID, config.SpotifySecret)
-	failIfError("Spotify OAuth failed: %v", err)
+	client, err := rdbs.SpotifyOAuthClientContext(ctx, config.SpotifyClientID, config.SpotifySecret)
+	if err != nil {
+		return nil, newError(codeSpotify, "Spotify OAuth failed", err)
+	}
 
-	return client
+	return client, nil
 }
 
-func mustGetCurrentSpotifyUser(client *spotify.Client) *spotify.PrivateUser {
+func getCurrentSpotifyUser(client *spotify.Client) (*spotify.PrivateUser, error) {
 	user, err := client.CurrentUser()
-	failIfError("Failed to get current Spotify user", err)
+	if err != nil {
+		return nil, newError(codeSpotify, "Failed to get current Spotify user", err)
+	}
 
 	log.Printf("Authenticated as: %s", user.DisplayName)
-	return user
+	return user, nil
 }
 
-func mustGetOrCreateSpotifyPlaylist(client *spotify.Client, userID string) spotify.ID {
-	ensureSpotifyPlaylistName()
+func getOrCreateSpotifyPlaylist(client *spotify.Client, userID string) (spotify.ID, error) {
+	if err := ensureSpotifyPlaylistName(); err != nil {
+		return "", err
+	}
 
-	playlists := mustGetUserPlaylists(client, userID)
+	playlists, err := getUserPlaylists(client, userID)
+	if err != nil {
+		return "", err
+	}
 	matches := findMatchingPlaylists(playlists, config.SpotifyPlaylistName)
 
 	switch len(matches) {
@@ -310,29 +661,51 @@ func mustGetOrCreateSpotifyPlaylist(client *spotify.Client, userID string) spoti
 		return createNewSpotifyPlaylist(client, userID)
 	case 1:
 		log.Printf("Using existing playlist: %s", matches[0].p.Name)
-		return matches[0].p.ID
+		return matches[0].p.ID, nil
 	default:
 		return selectFromMultipleSpotifyPlaylists(matches)
 	}
 }
 
-func ensureSpotifyPlaylistName() {
+func ensureSpotifyPlaylistName() error {
 	if config.SpotifyPlaylistName != "" {
-		return
+		return nil
+	}
+	if config.NonInteractive {
+		return errorf(codeUsage, "--spotify-playlist-name is required with --non-interactive")
 	}
 
 	prompt := promptui.Prompt{
-		Label: "Enter name for Spotify playlist",
+		Label:  "Enter name for Spotify playlist",
+		Stdout: os.Stderr,
 	}
 	var err error
 	config.SpotifyPlaylistName, err = prompt.Run()
-	failIfError("Failed to get Spotify playlist name", err)
+	if err != nil {
+		return newError(codeUsage, "Failed to get Spotify playlist name", err)
+	}
+	return nil
 }
 
-func mustGetUserPlaylists(client *spotify.Client, userID string) *spotify.SimplePlaylistPage {
-	playlists, err := client.GetPlaylistsForUser(userID)
-	failIfError("Failed to get user playlists", err)
-	return playlists
+// getUserPlaylists returns every playlist of the user, following pages.
+func getUserPlaylists(client *spotify.Client, userID string) ([]spotify.SimplePlaylist, error) {
+	limit := 50
+	page, err := client.GetPlaylistsForUserOpt(userID, &spotify.Options{Limit: &limit})
+	if err != nil {
+		return nil, newError(codeSpotify, "Failed to get user playlists", err)
+	}
+
+	var playlists []spotify.SimplePlaylist
+	for {
+		playlists = append(playlists, page.Playlists...)
+		err := client.NextPage(page)
+		if err == spotify.ErrNoMorePages {
+			return playlists, nil
+		}
+		if err != nil {
+			return nil, newError(codeSpotify, "Failed to get user playlists", err)
+		}
+	}
 }
 
 type playlistMatch struct {
@@ -340,9 +713,17 @@ type playlistMatch struct {
 	p     spotify.SimplePlaylist
 }
 
-func findMatchingPlaylists(playlists *spotify.SimplePlaylistPage, name string) []playlistMatch {
+// findMatchingPlaylists returns the playlist with ID name, or else the
+// playlists called name.
+func findMatchingPlaylists(playlists []spotify.SimplePlaylist, name string) []playlistMatch {
+	for i, p := range playlists {
+		if string(p.ID) == name {
+			return []playlistMatch{{index: i, p: p}}
+		}
+	}
+
 	var matches []playlistMatch
-	for i, p := range playlists.Playlists {
+	for i, p := range playlists {
 		if p.Name == name {
 			matches = append(matches, playlistMatch{index: i, p: p})
 		}
@@ -350,7 +731,7 @@ func findMatchingPlaylists(playlists *spotify.SimplePlaylistPage, name string) [
 	return matches
 }
 
-func createNewSpotifyPlaylist(client *spotify.Client, userID string) spotify.ID {
+func createNewSpotifyPlaylist(client *spotify.Client, userID string) (spotify.ID, error) {
 	log.Printf("Creating new playlist: %s", config.SpotifyPlaylistName)
 
 	playlist, err := client.CreatePlaylistForUser(
@@ -359,17 +740,28 @@ func createNewSpotifyPlaylist(client *spotify.Client, userID string) spotify.ID
 		"Exported from Rekordbox",
 		false, // public
 	)
-	failIfError("Failed to create playlist", err)
+	if err != nil {
+		return "", newError(codeSpotify, "Failed to create playlist", err)
+	}
 
-	return playlist.ID
+	return playlist.ID, nil
 }
 
-func selectFromMultipleSpotifyPlaylists(matches []playlistMatch) spotify.ID {
+func selectFromMultipleSpotifyPlaylists(matches []playlistMatch) (spotify.ID, error) {
 	formatted := make([]string, len(matches))
 	for i, match := range matches {
 		formatted[i] = fmt.Sprintf("%s (%d tracks)", match.p.Name, match.p.Tracks.Total)
 	}
 
+	if config.NonInteractive {
+		candidates := make([]string, len(matches))
+		for i, match := range matches {
+			candidates[i] = fmt.Sprintf("%s (ID %s)", formatted[i], match.p.ID)
+		}
+		return "", errorf(codeAmbiguous, "Spotify playlist '%s' is ambiguous, use its ID instead: %s",
+			config.SpotifyPlaylistName, strings.Join(candidates, ", "))
+	}
+
 	prompt := promptui.Select{
 		Label:             "Multiple playlists found, select one",
 		Items:             formatted,
@@ -378,42 +770,91 @@ func selectFromMultipleSpotifyPlaylists(matches []playlistMatch) spotify.ID {
 	}
 
 	i, _, err := prompt.Run()
-	failIfError("Failed to select playlist", err)
+	if err != nil {
+		return "", newError(codeUsage, "Failed to select playlist", err)
+	}
 
-	return matches[i].p.ID
+	return matches[i].p.ID, nil
 }
 
-func syncTracksToSpotify(client *spotify.Client, playlistID spotify.ID, tracks []rdbs.Track) {
-	log.Printf("Searching for %d tracks on Spotify...", len(tracks))
-
-	spotifyTracks, err := rdbs.SpotifySearch(client, tracks)
-	failIfError("Failed to search tracks on Spotify", err)
+// syncTracksToSpotify searches for tracks and adds the ones found to the
+// playlist. Tracks that can't be found or added are reported in the result
+// rather than failing the sync. It stops early once ctx is done.
+func syncTracksToSpotify(ctx context.Context, client *spotify.Client, playlistID spotify.ID, tracks []rdbs.Track) *syncResult {
+	found, result := searchSpotifyTracks(ctx, client, tracks)
+	result.SpotifyPlaylistID = playlistID
 
 	log.Println("Adding tracks to playlist...")
-	addedCount := 0
-	for _, track := range spotifyTracks {
-		if track.ID == "" {
-			continue
+	for _, track := range found {
+		if ctx.Err() != nil {
+			break
 		}
-
 		_, err := client.AddTracksToPlaylist(playlistID, track.ID)
 		if err != nil {
 			log.Printf("Failed to add track '%s': %v", track.Name, err)
+			result.Failed = append(result.Failed, failedResult{
+				trackResult{Artist: artistNames(track.Artists), Title: track.Name},
+				err.Error(),
+			})
 		} else {
-			addedCount++
+			result.Added++
+		}
+	}
+
+	return result
+}
+
+// searchSpotifyTracks searches Spotify for tracks and returns the matches
+// in order, along with a result counting what was and wasn't found.
+func searchSpotifyTracks(ctx context.Context, client *spotify.Client, tracks []rdbs.Track) ([]spotify.FullTrack, *syncResult) {
+	log.Printf("Searching for %d tracks on Spotify...", len(tracks))
+
+	result := &syncResult{
+		Searched: len(tracks),
+		NotFound: []trackResult{},
+		Failed:   []failedResult{},
+	}
+
+	var found []spotify.FullTrack
+	for _, r := range rdbs.SpotifySearchResultsContext(ctx, client, tracks) {
+		track := trackResult{Artist: r.Track.Artist, Title: r.Track.Title}
+		switch {
+		case r.Err != nil:
+			log.Printf("Spotify search failed for '%s - %s': %v", track.Artist, track.Title, r.Err)
+			result.Failed = append(result.Failed, failedResult{track, r.Err.Error()})
+		case r.Match == nil || r.Match.ID == "":
+			log.Printf("Could not find '%s - %s'", track.Artist, track.Title)
+			result.NotFound = append(result.NotFound, track)
+		default:
+			found = append(found, *r.Match)
 		}
 	}
+	result.Found = len(found)
 
-	log.Printf("Successfully added %d tracks to playlist", addedCount)
+	return found, result
+}
+
+func artistNames(artists []spotify.SimpleArtist) string {
+	names := make([]string, len(artists))
+	for i, a := range artists {
+		names[i] = a.Name
+	}
+	return strings.Join(names, ", ")
 }
 
 // Display functions
-func printTrackList(tracks []rdbs.Track, playlistName string) {
+// printTrackList prints tracks converted for output, with their keys
+// already in --key-notation.
+func printTrackList(tracks []export.Track, playlistName string) {
 	fmt.Printf("\nTracks in %s:\n", playlistName)
 	fmt.Println(strings.Repeat("=", len(playlistName)+11))
 
 	for i, track := range tracks {
-		fmt.Printf("%3d. %s - %s\n", i+1, track.Artist, track.Title)
+		details := []string{fmt.Sprintf("%.2f BPM", track.BPM)}
+		if track.Key != "" {
+			details = append(details, track.Key)
+		}
+		fmt.Printf("%3d. %s - %s (%s)\n", i+1, track.Artist, track.Title, strings.Join(details, ", "))
 	}
 
 	fmt.Printf("\nTotal: %d tracks\n", len(tracks))
@@ -445,13 +886,7 @@ func printDirectoryTreeRecursive(node *rekordbox.PlaylistNode, prefix string, is
 }
 
 func printDirectoryChildren(node *rekordbox.PlaylistNode, prefix string) {
-	children := make([]*rekordbox.PlaylistNode, len(node.Children))
-	copy(children, node.Children)
-
-	// Sort children alphabetically
-	sort.Slice(children, func(i, j int) bool {
-		return strings.Compare(children[i].Playlist.Name, children[j].Playlist.Name) < 0
-	})
+	children := sortedNodes(node.Children)
 
 	for i, child := range children {
 		isLast := i == len(children)-1
@@ -476,9 +911,12 @@ func max(a, b int) int {
 	return b
 }
 
-func failIfError(msg string, err error) {
-	if err == nil {
-		return
-	}
-	log.Fatalf("%s: %v", msg, err)
+// sortedNodes returns a copy of nodes sorted alphabetically by name.
+func sortedNodes(nodes []*rekordbox.PlaylistNode) []*rekordbox.PlaylistNode {
+	sorted := make([]*rekordbox.PlaylistNode, len(nodes))
+	copy(sorted, nodes)
+	sort.Slice(sorted, func(i, j int) bool {
+		return strings.Compare(sorted[i].Playlist.Name, sorted[j].Playlist.Name) < 0
+	})
+	return sorted
 }
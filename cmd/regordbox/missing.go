@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/r-medina/rdbs/export"
+	"github.com/r-medina/rdbs/rekordbox"
+)
+
+var missingCmd = &cobra.Command{
+	Use:   "missing",
+	Short: "Find tracks whose audio file is missing",
+	Long: `Check that the file of every track in the collection exists and list the
+ones that don't with the playlists they're in. With --search, directories
+are searched for files with the same name or size (or tags, with --tags)
+to suggest where missing files were moved.`,
+	Args: cobra.NoArgs,
+	RunE: runMissing,
+}
+
+func setupMissingFlags() {
+	missingCmd.Flags().StringArrayVar(&config.MissingRoots, "search", nil,
+		"Directory to search for moved files (can be repeated)")
+	missingCmd.Flags().BoolVar(&config.MissingTags, "tags", false,
+		"Also match files by their artist and title tags (reads every audio file under --search)")
+	missingCmd.Flags().StringVar(&config.ReportPath, "report", "",
+		"Also write the report to this file, as CSV if it ends in .csv and JSON otherwise (- writes JSON to stdout instead of the normal output)")
+}
+
+func setupMissingCommands() {
+	rootCmd.AddCommand(missingCmd)
+}
+
+type missingResult struct {
+	Checked int            `json:"checked"`
+	Missing []missingTrack `json:"missing"`
+}
+
+type missingTrack struct {
+	Track       export.Track       `json:"track"`
+	Playlists   []playlistResult   `json:"playlists"`
+	Relocations []relocationResult `json:"relocations,omitempty"`
+}
+
+type relocationResult struct {
+	Path    string   `json:"path"`
+	Matches []string `json:"matches"`
+}
+
+func runMissing(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	db, err := initializeDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tracks, err := db.GetAllTracksContext(ctx)
+	if err != nil {
+		return newError(codeDatabase, "Failed to get tracks", err)
+	}
+	missing, err := rekordbox.MissingFiles(ctx, tracks)
+	if err != nil {
+		return newError(codeIO, "Failed to check files", err)
+	}
+
+	playlists, err := getTrackPlaylists(ctx, db, missing)
+	if err != nil {
+		return err
+	}
+
+	var relocations map[string][]rekordbox.Relocation
+	if len(config.MissingRoots) > 0 && len(missing) > 0 {
+		relocations, err = rekordbox.FindRelocations(ctx, missing, rekordbox.RelocateOptions{
+			Roots:    config.MissingRoots,
+			ReadTags: config.MissingTags,
+		})
+		if err != nil {
+			return newError(codeIO, "Failed to search for moved files", err)
+		}
+	}
+
+	result := missingResult{Checked: len(tracks), Missing: make([]missingTrack, len(missing))}
+	for i, t := range missing {
+		m := missingTrack{Track: newTrackResult(t), Playlists: playlists[t.ID]}
+		for _, r := range relocations[t.ID] {
+			m.Relocations = append(m.Relocations, relocationResult{Path: r.Path, Matches: r.Matches})
+		}
+		result.Missing[i] = m
+	}
+
+	if config.ReportPath != "" {
+		if err := writeReport(config.ReportPath, result, missingCSVHeader, missingCSVRows(result)); err != nil {
+			return err
+		}
+		if config.ReportPath == "-" {
+			// The report replaces the normal output
+			return nil
+		}
+	}
+
+	return printResult(result, func() { printMissing(result) })
+}
+
+var missingCSVHeader = []string{
+	"track_id", "artist", "title", "path", "playlists", "suggested_path", "matches",
+}
+
+// missingCSVRows writes a row per missing track, with its best relocation
+// if there is one.
+func missingCSVRows(result missingResult) [][]string {
+	rows := make([][]string, len(result.Missing))
+	for i, m := range result.Missing {
+		var suggested, matches string
+		if len(m.Relocations) > 0 {
+			suggested = m.Relocations[0].Path
+			matches = strings.Join(m.Relocations[0].Matches, "; ")
+		}
+		rows[i] = []string{
+			m.Track.ID,
+			m.Track.Artist,
+			m.Track.Title,
+			m.Track.Path,
+			formatPlaylistPaths(m.Playlists, "; "),
+			suggested,
+			matches,
+		}
+	}
+	return rows
+}
+
+func printMissing(result missingResult) {
+	if len(result.Missing) == 0 {
+		fmt.Printf("All %d files found\n", result.Checked)
+		return
+	}
+
+	for _, m := range result.Missing {
+		t := m.Track
+		fmt.Printf("[%s] %s - %s\n", t.ID, t.Artist, t.Title)
+		fmt.Printf("    missing: %s\n", t.Path)
+		if len(m.Playlists) == 0 {
+			fmt.Println("    in no playlists")
+		} else {
+			fmt.Printf("    in %s\n", formatPlaylistPaths(m.Playlists, ", "))
+		}
+		for _, r := range m.Relocations {
+			fmt.Printf("    maybe: %s (%s)\n", r.Path, strings.Join(r.Matches, ", "))
+		}
+	}
+
+	fmt.Printf("\nTotal: %d of %d files missing\n", len(result.Missing), result.Checked)
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/manifoldco/promptui"
+
+	"github.com/r-medina/rdbs/export"
+	"github.com/r-medina/rdbs/key"
+	"github.com/r-medina/rdbs/rekordbox"
+)
+
+// Output formats selectable with --output.
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// errorCode classifies failures so scripts can react to them. Each code
+// maps to its own process exit code.
+type errorCode string
+
+const (
+	codeInternal  errorCode = "internal"
+	codeUsage     errorCode = "usage"
+	codeDatabase  errorCode = "database"
+	codeNotFound  errorCode = "not_found"
+	codeSpotify   errorCode = "spotify"
+	codeIO        errorCode = "io"
+	codeAmbiguous errorCode = "ambiguous"
+	codeCancelled errorCode = "cancelled"
+)
+
+var exitCodes = map[errorCode]int{
+	codeInternal:  1,
+	codeUsage:     2,
+	codeDatabase:  3,
+	codeNotFound:  4,
+	codeSpotify:   5,
+	codeIO:        6,
+	codeAmbiguous: 7,
+	codeCancelled: 130,
+}
+
+const exitCodeHelp = `Exit codes:
+  0    success
+  1    internal error
+  2    invalid usage
+  3    Rekordbox database error
+  4    playlist or file not found
+  5    Spotify error
+  6    file read or write error
+  7    ambiguous playlist name (with --non-interactive)
+  130  cancelled`
+
+// cliError is an error with a code describing its class.
+type cliError struct {
+	Code    errorCode
+	Message string
+	Err     error
+}
+
+func (e *cliError) Error() string {
+	if e.Err == nil {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %v", e.Message, e.Err)
+}
+
+func (e *cliError) Unwrap() error {
+	return e.Err
+}
+
+// newError wraps err with a code and message. Errors that already carry a
+// code keep it, so the most specific classification wins. Interrupted
+// prompts are always reported as cancelled.
+func newError(code errorCode, msg string, err error) error {
+	if errors.Is(err, promptui.ErrInterrupt) || errors.Is(err, promptui.ErrEOF) || errors.Is(err, context.Canceled) {
+		code = codeCancelled
+	}
+	var existing *cliError
+	if errors.As(err, &existing) {
+		code = existing.Code
+	}
+	return &cliError{Code: code, Message: msg, Err: err}
+}
+
+// errorf returns a coded error without an underlying cause.
+func errorf(code errorCode, format string, args ...interface{}) error {
+	return &cliError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+func validateOutput() error {
+	switch config.Output {
+	case outputText, outputJSON:
+		return nil
+	default:
+		return errorf(codeUsage, "unknown output format %q (expected %q or %q)", config.Output, outputText, outputJSON)
+	}
+}
+
+func validateKeyNotation() error {
+	if config.KeyNotation == "" {
+		return nil
+	}
+	n, err := key.ParseNotation(config.KeyNotation)
+	if err != nil {
+		return errorf(codeUsage, "unknown key notation %q (expected %q, %q or %q)",
+			config.KeyNotation, key.Musical, key.Camelot, key.OpenKey)
+	}
+	config.KeyNotation = string(n)
+	return nil
+}
+
+// formatKey writes a key in the --key-notation notation, leaving it as
+// Rekordbox stores it if the flag isn't set or the key can't be parsed.
+func formatKey(name string) string {
+	if config.KeyNotation == "" {
+		return name
+	}
+	return key.Convert(name, key.Notation(config.KeyNotation))
+}
+
+// newTrackResult converts t for output, with its key in --key-notation.
+func newTrackResult(t rekordbox.FullTrack) export.Track {
+	track := export.NewTrack(t)
+	track.Key = formatKey(track.Key)
+	return track
+}
+
+// newTrackResults converts tracks for output, with their keys in
+// --key-notation.
+func newTrackResults(tracks []rekordbox.FullTrack) []export.Track {
+	out := make([]export.Track, len(tracks))
+	for i, t := range tracks {
+		out[i] = newTrackResult(t)
+	}
+	return out
+}
+
+func jsonOutput() bool {
+	return config.Output == outputJSON
+}
+
+// printResult prints v as JSON in JSON mode and calls text otherwise.
+func printResult(v interface{}, text func()) error {
+	if !jsonOutput() {
+		text()
+		return nil
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return newError(codeIO, "Failed to write output", err)
+	}
+	return nil
+}
+
+type errorResponse struct {
+	Error errorBody `json:"error"`
+}
+
+type errorBody struct {
+	Code     errorCode `json:"code"`
+	Message  string    `json:"message"`
+	ExitCode int       `json:"exit_code"`
+}
+
+// reportError prints err in the selected output format and returns the
+// process exit code for it. Errors without a code come from cobra's flag
+// and argument parsing and are reported as usage errors.
+func reportError(err error) int {
+	var cliErr *cliError
+	if !errors.As(err, &cliErr) {
+		cliErr = &cliError{Code: codeUsage, Message: "Invalid usage", Err: err}
+	}
+
+	exitCode, ok := exitCodes[cliErr.Code]
+	if !ok {
+		exitCode = exitCodes[codeInternal]
+	}
+
+	if jsonOutput() {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(errorResponse{Error: errorBody{
+			Code:     cliErr.Code,
+			Message:  cliErr.Error(),
+			ExitCode: exitCode,
+		}})
+	} else {
+		log.Print(cliErr.Error())
+	}
+
+	return exitCode
+}
+
+// writeReport writes a report to path ("-" for stdout): as CSV, with a
+// header and rows, if path ends in .csv and as JSON otherwise.
+func writeReport(path string, v interface{}, header []string, rows [][]string) error {
+	w, err := createOutput(path)
+	if err != nil {
+		return newError(codeIO, "Failed to create report", err)
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		cw := csv.NewWriter(w)
+		cw.Write(header)
+		cw.WriteAll(rows)
+		err = cw.Error()
+	} else {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(v)
+	}
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return newError(codeIO, "Failed to write report", err)
+	}
+
+	if path != "-" {
+		log.Printf("Wrote report to %s", path)
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/r-medina/rdbs/rekordbox"
+)
+
+var (
+	schemaCmd = &cobra.Command{
+		Use:   "schema",
+		Short: "Describe the Rekordbox database schema",
+		Long:  "List the tables of the Rekordbox database with their columns, types, indexes and row counts",
+		Args:  cobra.NoArgs,
+		RunE:  runSchema,
+	}
+	schemaDiffCmd = &cobra.Command{
+		Use:   "diff <old.db> <new.db>",
+		Short: "Compare the schemas of two Rekordbox databases",
+		Long:  "Report the tables, columns and indexes added, removed or changed between two Rekordbox database files, such as before and after a Rekordbox update",
+		Args:  cobra.ExactArgs(2),
+		RunE:  runSchemaDiff,
+	}
+)
+
+func setupSchemaCommands() {
+	schemaCmd.AddCommand(schemaDiffCmd)
+	rootCmd.AddCommand(schemaCmd)
+}
+
+type schemaResult struct {
+	Path    string            `json:"path"`
+	Version string            `json:"version"`
+	Tables  []rekordbox.Table `json:"tables"`
+}
+
+func runSchema(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	db, err := initializeDB(rekordbox.WithAnySchema())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	result, err := describeSchema(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	return printResult(result, func() { printSchema(result) })
+}
+
+type schemaDiffResult struct {
+	Old schemaVersion `json:"old"`
+	New schemaVersion `json:"new"`
+	*rekordbox.SchemaDiff
+}
+
+type schemaVersion struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+}
+
+func runSchemaDiff(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	var schemas []*schemaResult
+	for _, path := range args {
+		log.Printf("Using database: %s", path)
+		db, err := openDB(append(dbOptions(), rekordbox.WithDBLocation(path), rekordbox.WithAnySchema())...)
+		if err != nil {
+			return err
+		}
+		schema, err := describeSchema(ctx, db)
+		db.Close()
+		if err != nil {
+			return err
+		}
+		schemas = append(schemas, schema)
+	}
+
+	before, after := schemas[0], schemas[1]
+	result := schemaDiffResult{
+		Old:        schemaVersion{before.Path, before.Version},
+		New:        schemaVersion{after.Path, after.Version},
+		SchemaDiff: rekordbox.DiffTables(before.Tables, after.Tables),
+	}
+
+	return printResult(result, func() { printSchemaDiff(result) })
+}
+
+func describeSchema(ctx context.Context, db *rekordbox.DB) (*schemaResult, error) {
+	tables, err := db.TablesContext(ctx)
+	if err != nil {
+		return nil, newError(codeDatabase, "Failed to read schema", err)
+	}
+	return &schemaResult{Path: db.Path(), Version: db.Schema().Version, Tables: tables}, nil
+}
+
+func printSchema(result *schemaResult) {
+	fmt.Printf("Schema of %s", result.Path)
+	if result.Version != "" {
+		fmt.Printf(" (version %s)", result.Version)
+	}
+	fmt.Println()
+
+	for _, t := range result.Tables {
+		fmt.Printf("\n%s (%d rows)\n", t.Name, t.RowCount)
+		for _, c := range t.Columns {
+			fmt.Printf("  %s\n", formatColumn(c))
+		}
+		for _, i := range t.Indexes {
+			fmt.Printf("  %s\n", formatIndex(i))
+		}
+	}
+}
+
+func printSchemaDiff(result schemaDiffResult) {
+	fmt.Printf("Comparing %s (version %s) to %s (version %s)\n",
+		result.Old.Path, orUnknown(result.Old.Version), result.New.Path, orUnknown(result.New.Version))
+
+	if result.Empty() {
+		fmt.Println("\nSchemas are identical")
+		return
+	}
+
+	for _, t := range result.AddedTables {
+		fmt.Printf("\n+ table %s\n", t.Name)
+		for _, c := range t.Columns {
+			fmt.Printf("    %s\n", formatColumn(c))
+		}
+	}
+	for _, t := range result.RemovedTables {
+		fmt.Printf("\n- table %s\n", t.Name)
+	}
+	for _, t := range result.ChangedTables {
+		fmt.Printf("\n~ table %s\n", t.Name)
+		for _, c := range t.AddedColumns {
+			fmt.Printf("  + %s\n", formatColumn(c))
+		}
+		for _, c := range t.RemovedColumns {
+			fmt.Printf("  - %s\n", formatColumn(c))
+		}
+		for _, c := range t.ChangedColumns {
+			fmt.Printf("  ~ %s -> %s\n", formatColumn(c.Old), formatColumn(c.New))
+		}
+		for _, i := range t.AddedIndexes {
+			fmt.Printf("  + %s\n", formatIndex(i))
+		}
+		for _, i := range t.RemovedIndexes {
+			fmt.Printf("  - %s\n", formatIndex(i))
+		}
+	}
+}
+
+func formatColumn(c rekordbox.Column) string {
+	parts := []string{c.Name}
+	if c.Type != "" {
+		parts = append(parts, c.Type)
+	}
+	if c.PrimaryKey {
+		parts = append(parts, "PRIMARY KEY")
+	}
+	if c.NotNull {
+		parts = append(parts, "NOT NULL")
+	}
+	if c.Default != "" {
+		parts = append(parts, "DEFAULT "+c.Default)
+	}
+	return strings.Join(parts, " ")
+}
+
+func formatIndex(i rekordbox.Index) string {
+	kind := "index"
+	if i.Unique {
+		kind = "unique index"
+	}
+	return fmt.Sprintf("%s %s (%s)", kind, i.Name, strings.Join(i.Columns, ", "))
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/manifoldco/promptui"
+	"github.com/spf13/cobra"
+
+	"github.com/r-medina/rdbs/export"
+	"github.com/r-medina/rdbs/rekordbox"
+)
+
+var searchCmd = &cobra.Command{
+	Use:   "search [query...]",
+	Short: "Search the collection for tracks",
+	Long: `Find tracks whose title, artist, album, label, genre or comments contain
+every word of the query, optionally filtered by BPM, key, rating and date
+added, and show the playlists each one is in.`,
+	RunE: runSearch,
+}
+
+var whereCmd = &cobra.Command{
+	Use:   "where <track>",
+	Short: "List the playlists a track is in",
+	Long: `Show every playlist containing a track, given by its ID, the path of its
+audio file, or a search query matching it.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runWhere,
+}
+
+func setupSearchFlags() {
+	f := &config.SearchFilters
+	searchCmd.Flags().Float64Var(&f.MinBPM, "min-bpm", 0, "Only tracks at least this fast")
+	searchCmd.Flags().Float64Var(&f.MaxBPM, "max-bpm", 0, "Only tracks at most this fast")
+	searchCmd.Flags().StringVar(&f.Key, "key", "", "Only tracks in this key, like Am, 8A or 1m")
+	searchCmd.Flags().BoolVar(&f.HarmonicKey, "harmonic", false,
+		"With --key, also tracks in keys that mix harmonically with it")
+	searchCmd.Flags().IntVar(&f.MinRating, "min-rating", 0, "Only tracks rated at least this many stars")
+	searchCmd.Flags().StringVar(&config.SearchAddedAfter, "added-after", "",
+		"Only tracks added on or after this date (YYYY-MM-DD)")
+	searchCmd.Flags().StringVar(&config.SearchAddedBefore, "added-before", "",
+		"Only tracks added before this date (YYYY-MM-DD)")
+	searchCmd.Flags().IntVar(&f.Limit, "limit", 50, "Maximum number of results (0 for all)")
+}
+
+func setupSearchCommands() {
+	rootCmd.AddCommand(searchCmd)
+	rootCmd.AddCommand(whereCmd)
+}
+
+type searchHit struct {
+	Track     export.Track     `json:"track"`
+	Playlists []playlistResult `json:"playlists"`
+}
+
+type searchResult struct {
+	Query   string      `json:"query"`
+	Results []searchHit `json:"results"`
+}
+
+func runSearch(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	filters := config.SearchFilters
+	var err error
+	if filters.AddedAfter, err = parseDateFlag("added-after", config.SearchAddedAfter); err != nil {
+		return err
+	}
+	if filters.AddedBefore, err = parseDateFlag("added-before", config.SearchAddedBefore); err != nil {
+		return err
+	}
+
+	db, err := initializeDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	query := strings.Join(args, " ")
+	tracks, err := db.SearchTracksContext(ctx, query, filters)
+	if err != nil {
+		return newError(codeDatabase, "Failed to search tracks", err)
+	}
+
+	playlists, err := getTrackPlaylists(ctx, db, tracks)
+	if err != nil {
+		return err
+	}
+
+	result := searchResult{Query: query, Results: make([]searchHit, len(tracks))}
+	for i, t := range tracks {
+		result.Results[i] = searchHit{Track: newTrackResult(t), Playlists: playlists[t.ID]}
+	}
+
+	return printResult(result, func() { printSearchResults(result) })
+}
+
+// getTrackPlaylists maps the IDs of tracks to the playlists containing
+// them.
+func getTrackPlaylists(ctx context.Context, db *rekordbox.DB, tracks []rekordbox.FullTrack) (map[string][]playlistResult, error) {
+	ids := make([]string, len(tracks))
+	for i, t := range tracks {
+		ids[i] = t.ID
+	}
+	found, err := db.GetPlaylistsForTracksContext(ctx, ids)
+	if err != nil {
+		return nil, newError(codeDatabase, "Failed to get playlists for tracks", err)
+	}
+
+	playlists := make(map[string][]playlistResult)
+	for _, id := range ids {
+		playlists[id] = newPlaylistResults(found[id])
+	}
+	return playlists, nil
+}
+
+func newPlaylistResults(playlists []*rekordbox.FullPlaylist) []playlistResult {
+	out := make([]playlistResult, len(playlists))
+	for i, p := range playlists {
+		out[i] = newPlaylistResult(p)
+	}
+	return out
+}
+
+// parseDateFlag parses a YYYY-MM-DD flag value, returning the zero time
+// for an empty one.
+func parseDateFlag(name, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return t, errorf(codeUsage, "Invalid --%s date %q (expected YYYY-MM-DD)", name, value)
+	}
+	return t, nil
+}
+
+func printSearchResults(result searchResult) {
+	if len(result.Results) == 0 {
+		fmt.Println("No tracks found")
+		return
+	}
+
+	for i, hit := range result.Results {
+		t := hit.Track
+		details := []string{fmt.Sprintf("%.2f BPM", t.BPM)}
+		if t.Key != "" {
+			details = append(details, t.Key)
+		}
+		fmt.Printf("%3d. %s - %s (%s)\n", i+1, t.Artist, t.Title, strings.Join(details, ", "))
+
+		paths := make([]string, len(hit.Playlists))
+		for j, p := range hit.Playlists {
+			paths[j] = strings.Join(p.Path, " > ")
+		}
+		if len(paths) == 0 {
+			paths = []string{"(no playlists)"}
+		}
+		fmt.Printf("     %s\n", strings.Join(paths, ", "))
+	}
+
+	fmt.Printf("\nTotal: %d tracks\n", len(result.Results))
+}
+
+type whereResult struct {
+	Track     export.Track     `json:"track"`
+	Playlists []playlistResult `json:"playlists"`
+}
+
+func runWhere(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	db, err := initializeDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	track, err := findTrack(ctx, db, strings.Join(args, " "))
+	if err != nil {
+		return err
+	}
+
+	playlists, err := db.GetPlaylistsForTrackContext(ctx, track.ID)
+	if err != nil {
+		return newError(codeDatabase, "Failed to get playlists for track", err)
+	}
+
+	result := whereResult{Track: newTrackResult(*track), Playlists: newPlaylistResults(playlists)}
+	return printResult(result, func() { printWhere(result) })
+}
+
+// findTrack resolves ref to a track. ref is a track ID, the path of an
+// audio file or a search query, tried in that order.
+func findTrack(ctx context.Context, db *rekordbox.DB, ref string) (*rekordbox.FullTrack, error) {
+	track, err := db.GetFullTrackInfoContext(ctx, ref)
+	switch {
+	case err == nil:
+		return track, nil
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, newError(codeDatabase, "Failed to get track", err)
+	}
+
+	matches, err := db.GetTracksByPathContext(ctx, ref)
+	if err != nil {
+		return nil, newError(codeDatabase, "Failed to get tracks by path", err)
+	}
+	if len(matches) == 0 {
+		matches, err = db.SearchTracksContext(ctx, ref, rekordbox.SearchFilters{})
+		if err != nil {
+			return nil, newError(codeDatabase, "Failed to search tracks", err)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, errorf(codeNotFound, "No track found with ID, path or matching '%s'", ref)
+	case 1:
+		return &matches[0], nil
+	}
+
+	formatted := make([]string, len(matches))
+	for i, t := range matches {
+		formatted[i] = fmt.Sprintf("%s - %s (ID %s)", t.Artist, t.Title, t.ID)
+	}
+
+	if config.NonInteractive {
+		return nil, errorf(codeAmbiguous, "Track '%s' is ambiguous, use an ID or file path instead: %s",
+			ref, strings.Join(formatted, ", "))
+	}
+
+	prompt := promptui.Select{
+		Label:             "Multiple tracks found, select one",
+		Items:             formatted,
+		Stdout:            os.Stderr,
+		StartInSearchMode: true,
+	}
+	i, _, err := prompt.Run()
+	if err != nil {
+		return nil, newError(codeUsage, "Failed to select track", err)
+	}
+	return &matches[i], nil
+}
+
+func printWhere(result whereResult) {
+	fmt.Printf("%s - %s (ID %s)\n", result.Track.Artist, result.Track.Title, result.Track.ID)
+	if len(result.Playlists) == 0 {
+		fmt.Println("Not in any playlist")
+		return
+	}
+	for _, p := range result.Playlists {
+		fmt.Printf("  %s\n", strings.Join(p.Path, " > "))
+	}
+}
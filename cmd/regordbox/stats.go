@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/r-medina/rdbs/rekordbox"
+)
+
+var statsCmd = &cobra.Command{
+	Use:   "stats [playlist or folder]",
+	Short: "Summarize a playlist, folder or the whole collection",
+	Long: `Print track count, total length, BPM histogram, key distribution, top
+genres, labels and artists, file types, ratings and tracks added per month.
+
+The playlist or folder is given by name, path (Folder/Playlist) or ID. A
+folder covers every playlist in it, counting each track once. Without one,
+the whole collection is summarized.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runStats,
+}
+
+func setupStatsFlags() {
+	statsCmd.Flags().IntVar(&config.StatsOptions.Top, "top", rekordbox.DefaultStatsTop,
+		"Number of genres, labels and artists to list (-1 for all)")
+	statsCmd.Flags().Float64Var(&config.StatsOptions.BPMStep, "bpm-step", rekordbox.DefaultBPMStep,
+		"Width of the BPM histogram buckets")
+}
+
+func setupStatsCommands() {
+	rootCmd.AddCommand(statsCmd)
+}
+
+type statsResult struct {
+	Scope string          `json:"scope"` // Playlist path, or "collection"
+	Stats rekordbox.Stats `json:"stats"`
+}
+
+func runStats(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	db, err := initializeDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	scope := "collection"
+	var tracks []rekordbox.FullTrack
+	if len(args) == 0 {
+		tracks, err = db.GetAllTracksContext(ctx)
+		if err != nil {
+			return newError(codeDatabase, "Failed to get tracks", err)
+		}
+	} else {
+		hierarchy, err := getPlaylistHierarchy(ctx, db, rekordbox.WithTrackCounts())
+		if err != nil {
+			return err
+		}
+		node, err := findPlaylistNode(ctx, db, hierarchy, args[0])
+		if err != nil {
+			return err
+		}
+		scope = rekordbox.FormatPlaylistPath(node.Playlist.Path)
+		tracks, err = getNodeTracks(ctx, db, node, make(map[string]bool))
+		if err != nil {
+			return err
+		}
+	}
+
+	result := statsResult{Scope: scope, Stats: rekordbox.NewStats(tracks, config.StatsOptions)}
+	for i, c := range result.Stats.Keys {
+		result.Stats.Keys[i].Name = formatKey(c.Name)
+	}
+	return printResult(result, func() { printStats(result) })
+}
+
+// getNodeTracks returns the tracks of a playlist or smart playlist, or of
+// every playlist in a folder, skipping tracks already in seen.
+func getNodeTracks(ctx context.Context, db *rekordbox.DB, node *rekordbox.PlaylistNode, seen map[string]bool) ([]rekordbox.FullTrack, error) {
+	var tracks []rekordbox.FullTrack
+	if node.Playlist != nil {
+		var playlistTracks []rekordbox.FullTrack
+		var err error
+		switch node.Playlist.Kind() {
+		case rekordbox.KindSmart:
+			playlistTracks, err = db.GetSmartPlaylistTracksContext(ctx, node.Playlist.ID)
+		case rekordbox.KindPlaylist:
+			playlistTracks, err = db.GetPlaylistTracksDetailedContext(ctx, node.Playlist.ID)
+		}
+		if err != nil {
+			return nil, newError(codeDatabase, "Failed to get playlist tracks", err)
+		}
+		for _, t := range playlistTracks {
+			if !seen[t.ID] {
+				seen[t.ID] = true
+				tracks = append(tracks, t)
+			}
+		}
+	}
+
+	for _, child := range node.Children {
+		childTracks, err := getNodeTracks(ctx, db, child, seen)
+		if err != nil {
+			return nil, err
+		}
+		tracks = append(tracks, childTracks...)
+	}
+	return tracks, nil
+}
+
+// statsBarWidth is the length of the longest bar in printed histograms.
+const statsBarWidth = 40
+
+func printStats(result statsResult) {
+	s := result.Stats
+	fmt.Printf("%s: %d tracks, %s\n", result.Scope, s.Tracks, s.Duration())
+	if s.Tracks == 0 {
+		return
+	}
+
+	buckets := make([]rekordbox.Count, len(s.BPM))
+	for i, b := range s.BPM {
+		buckets[i] = rekordbox.Count{Name: fmt.Sprintf("%g-%g", b.Min, b.Max), Count: b.Count}
+	}
+	if s.NoBPM > 0 {
+		buckets = append(buckets, rekordbox.Count{Name: "none", Count: s.NoBPM})
+	}
+	printCounts("BPM", buckets)
+
+	printCounts("Keys", s.Keys)
+	printCounts("Genres", s.Genres)
+	printCounts("Labels", s.Labels)
+	printCounts("Artists", s.Artists)
+	printCounts("File types", s.FileTypes)
+
+	ratings := make([]rekordbox.Count, len(s.Ratings))
+	for stars, n := range s.Ratings {
+		ratings[stars] = rekordbox.Count{Name: strings.Repeat("*", stars), Count: n}
+	}
+	ratings[0].Name = "unrated"
+	printCounts("Ratings", ratings)
+
+	printCounts("Added per month", s.AddedPerMonth)
+}
+
+// printCounts prints counts under title as a bar chart.
+func printCounts(title string, counts []rekordbox.Count) {
+	if len(counts) == 0 {
+		return
+	}
+
+	nameWidth, max := 0, 0
+	for _, c := range counts {
+		if len(c.Name) > nameWidth {
+			nameWidth = len(c.Name)
+		}
+		if c.Count > max {
+			max = c.Count
+		}
+	}
+
+	fmt.Printf("\n%s:\n", title)
+	for _, c := range counts {
+		bar := 0
+		if max > 0 {
+			bar = (c.Count*statsBarWidth + max - 1) / max
+		}
+		line := fmt.Sprintf("  %-*s %5d %s", nameWidth, c.Name, c.Count, strings.Repeat("#", bar))
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+}
@@ -0,0 +1,523 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/zmb3/spotify"
+
+	"github.com/r-medina/rdbs"
+	"github.com/r-medina/rdbs/rekordbox"
+	"github.com/r-medina/rdbs/syncconfig"
+)
+
+// spotifyBatchSize is the most tracks Spotify adds or removes per request.
+const spotifyBatchSize = 100
+
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Sync the playlists listed in a config file to Spotify",
+	Long: `Process every mapping in a YAML or TOML sync config, creating or updating
+one Spotify playlist per Rekordbox playlist, folder member, My Tag or smart
+playlist, and report the result of each mapping.
+
+Tracks already in a Spotify playlist are not added again. With prune set,
+tracks no longer in the Rekordbox source are removed.`,
+	RunE: runSync,
+}
+
+func setupSyncFlags() {
+	syncCmd.Flags().StringVar(&config.SyncConfig, "config", "",
+		"Path to the sync config file (required)")
+	syncCmd.MarkFlagRequired("config")
+
+	syncCmd.Flags().StringVar(&config.SpotifyClientID, "spotify-client-id", "",
+		"Spotify client ID (default: $SPOTIFY_ID or the config file)")
+
+	syncCmd.Flags().StringVar(&config.SpotifySecret, "spotify-secret", "",
+		"Spotify client secret (default: $SPOTIFY_SECRET or the config file, will prompt if not set)")
+}
+
+func setupSyncCommands() {
+	rootCmd.AddCommand(syncCmd)
+}
+
+// syncSource is a set of Rekordbox tracks and the Spotify playlist they
+// are synced to.
+type syncSource struct {
+	Kind   string // Source kind from syncconfig, folders resolve to playlists
+	Path   string // Path of the Rekordbox playlist or My Tag
+	ID     string
+	Tracks []rekordbox.FullTrack // Set by loadSourceTracks
+	Data   syncconfig.NameData
+}
+
+// mappingResult reports the outcome of one config mapping.
+type mappingResult struct {
+	Source       string               `json:"source"`
+	Destinations []*destinationResult `json:"destinations"`
+	Error        string               `json:"error,omitempty"`
+
+	err error
+}
+
+// destinationResult reports the sync of one Spotify playlist.
+type destinationResult struct {
+	Name    string `json:"name"`
+	Source  string `json:"source"`
+	Created bool   `json:"created"`
+	Removed int    `json:"removed"`
+	*syncResult
+	Error string `json:"error,omitempty"`
+
+	err error
+}
+
+func runSync(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	cfg, err := syncconfig.Load(config.SyncConfig)
+	if err != nil {
+		return newError(codeUsage, "Failed to load sync config", err)
+	}
+
+	db, err := initializeDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	hierarchy, err := getPlaylistHierarchy(ctx, db, rekordbox.WithTrackCounts())
+	if err != nil {
+		return err
+	}
+
+	// Resolve every source before touching Spotify so config mistakes
+	// show up without waiting for authentication.
+	results := make([]*mappingResult, len(cfg.Mappings))
+	sources := make([][]syncSource, len(cfg.Mappings))
+	for i, m := range cfg.Mappings {
+		results[i] = &mappingResult{Source: m.String(), Destinations: []*destinationResult{}}
+		sources[i], results[i].err = resolveSyncSources(ctx, db, hierarchy, m)
+		for j := range sources[i] {
+			if results[i].err == nil {
+				results[i].err = loadSourceTracks(ctx, db, &sources[i][j])
+			}
+		}
+	}
+
+	client, userID, err := authenticateSyncSpotify(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	playlists, err := getUserPlaylists(client, userID)
+	if err != nil {
+		return err
+	}
+
+	for i, m := range cfg.Mappings {
+		if results[i].err != nil {
+			continue
+		}
+
+		resolved := cfg.Resolve(m)
+		for _, source := range sources[i] {
+			if err := ctx.Err(); err != nil {
+				return newError(codeCancelled, "Sync cancelled", err)
+			}
+			dest := syncSourceToSpotify(ctx, client, userID, &playlists, resolved, source)
+			results[i].Destinations = append(results[i].Destinations, dest)
+			if dest.err != nil && results[i].err == nil {
+				results[i].err = dest.err
+			}
+		}
+	}
+
+	var failed []*mappingResult
+	for _, r := range results {
+		if r.err != nil {
+			r.Error = r.err.Error()
+			failed = append(failed, r)
+		}
+	}
+
+	out := struct {
+		Mappings []*mappingResult `json:"mappings"`
+	}{results}
+	if err := printResult(out, func() { printSyncResults(results) }); err != nil {
+		return err
+	}
+
+	if len(failed) > 0 {
+		// The first failure's code is kept, so a config mistake exits
+		// with usage and a missing source with not found.
+		return newError(codeUsage, fmt.Sprintf("%d of %d mappings failed", len(failed), len(results)), failed[0].err)
+	}
+	return nil
+}
+
+// authenticateSyncSpotify authenticates with credentials from flags, the
+// environment or the config, in that order.
+func authenticateSyncSpotify(ctx context.Context, cfg *syncconfig.Config) (*spotify.Client, string, error) {
+	config.SpotifyClientID = firstNonEmpty(config.SpotifyClientID, os.Getenv("SPOTIFY_ID"), cfg.Spotify.ClientID)
+	config.SpotifySecret = firstNonEmpty(config.SpotifySecret, os.Getenv("SPOTIFY_SECRET"), cfg.Spotify.Secret)
+	if config.SpotifyClientID == "" {
+		return nil, "", errorf(codeUsage, "No Spotify client ID given (use --spotify-client-id, $SPOTIFY_ID or spotify.client_id)")
+	}
+
+	if err := ensureSpotifySecret(ctx); err != nil {
+		return nil, "", err
+	}
+	client, err := authenticateSpotify(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	user, err := getCurrentSpotifyUser(client)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return client, user.ID, nil
+}
+
+// resolveSyncSources returns the track sets a mapping syncs, without
+// their tracks. Folders yield one source per playlist below them.
+// Playlists are looked up in hierarchy.
+func resolveSyncSources(ctx context.Context, db *rekordbox.DB, hierarchy *rekordbox.PlaylistNode, m syncconfig.Mapping) ([]syncSource, error) {
+	kind, value := m.Source()
+	if kind == syncconfig.SourceMyTag {
+		source, err := resolveMyTagSource(ctx, db, value)
+		if err != nil {
+			return nil, err
+		}
+		return []syncSource{source}, nil
+	}
+
+	node, err := findPlaylistNode(ctx, db, hierarchy, value)
+	if err != nil {
+		return nil, err
+	}
+
+	isFolder := node.Playlist.Kind() == rekordbox.KindFolder
+	switch {
+	case kind == syncconfig.SourceFolder && !isFolder:
+		return nil, errorf(codeUsage, "'%s' is not a folder", value)
+	case kind != syncconfig.SourceFolder && isFolder:
+		return nil, errorf(codeUsage, "'%s' is a folder, use folder instead of %s", value, kind)
+	case kind == syncconfig.SourceSmartPlaylist && node.Playlist.Kind() != rekordbox.KindSmart:
+		return nil, errorf(codeUsage, "'%s' is not a smart playlist", value)
+	}
+
+	var nodes []*rekordbox.PlaylistNode
+	if isFolder {
+		nodes = collectPlaylists(node)
+	} else {
+		nodes = append(nodes, node)
+	}
+
+	sources := make([]syncSource, 0, len(nodes))
+	for _, n := range nodes {
+		kind := syncconfig.SourcePlaylist
+		if n.Playlist.Kind() == rekordbox.KindSmart {
+			kind = syncconfig.SourceSmartPlaylist
+		}
+		path := n.Playlist.Path
+		sources = append(sources, syncSource{
+			Kind: kind,
+			Path: rekordbox.FormatPlaylistPath(path),
+			ID:   n.Playlist.ID,
+			Data: syncconfig.NameData{
+				Name:   n.Playlist.Name,
+				Path:   rekordbox.FormatPlaylistPath(path),
+				Folder: rekordbox.FormatPlaylistPath(path[:len(path)-1]),
+			},
+		})
+	}
+	return sources, nil
+}
+
+// collectPlaylists returns every playlist and smart playlist below node,
+// skipping folders.
+func collectPlaylists(node *rekordbox.PlaylistNode) []*rekordbox.PlaylistNode {
+	var playlists []*rekordbox.PlaylistNode
+	for _, child := range sortedNodes(node.Children) {
+		if child.Playlist.Kind() == rekordbox.KindFolder {
+			playlists = append(playlists, collectPlaylists(child)...)
+		} else {
+			playlists = append(playlists, child)
+		}
+	}
+	return playlists
+}
+
+// loadSourceTracks sets the tracks of source, evaluating smart playlists
+// against the collection.
+func loadSourceTracks(ctx context.Context, db *rekordbox.DB, source *syncSource) error {
+	var err error
+	switch source.Kind {
+	case syncconfig.SourceSmartPlaylist:
+		source.Tracks, err = db.GetSmartPlaylistTracksContext(ctx, source.ID)
+	case syncconfig.SourceMyTag:
+		source.Tracks, err = db.GetMyTagTracksContext(ctx, source.ID)
+	default:
+		source.Tracks, err = db.GetPlaylistTracksDetailedContext(ctx, source.ID)
+	}
+	if err != nil {
+		return newError(codeDatabase, fmt.Sprintf("Failed to get tracks of '%s'", source.Path), err)
+	}
+	return nil
+}
+
+// resolveMyTagSource finds a My Tag by name or "Group/Name".
+func resolveMyTagSource(ctx context.Context, db *rekordbox.DB, ref string) (syncSource, error) {
+	tags, err := db.GetMyTagsContext(ctx)
+	if err != nil {
+		return syncSource{}, newError(codeDatabase, "Failed to get My Tags", err)
+	}
+
+	path := rekordbox.ParsePlaylistPath(ref)
+	var matches []rekordbox.MyTag
+	for _, tag := range tags {
+		if tag.GroupName == "" {
+			continue // Groups can't be assigned to tracks
+		}
+		switch {
+		case len(path) == 1 && tag.Name == path[0],
+			len(path) == 2 && tag.GroupName == path[0] && tag.Name == path[1]:
+			matches = append(matches, tag)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return syncSource{}, errorf(codeNotFound, "No My Tag found with name '%s'", ref)
+	case 1:
+	default:
+		candidates := make([]string, len(matches))
+		for i, tag := range matches {
+			candidates[i] = rekordbox.FormatPlaylistPath([]string{tag.GroupName, tag.Name})
+		}
+		return syncSource{}, errorf(codeAmbiguous, "My Tag '%s' is ambiguous, use one of: %s",
+			ref, strings.Join(candidates, ", "))
+	}
+
+	tag := matches[0]
+	path = []string{tag.GroupName, tag.Name}
+	return syncSource{
+		Kind: syncconfig.SourceMyTag,
+		Path: rekordbox.FormatPlaylistPath(path),
+		ID:   tag.ID,
+		Data: syncconfig.NameData{
+			Name:   tag.Name,
+			Path:   rekordbox.FormatPlaylistPath(path),
+			Folder: tag.GroupName,
+		},
+	}, nil
+}
+
+// syncSourceToSpotify brings the Spotify playlist for source up to date,
+// creating it if needed. New playlists are appended to playlists. It stops
+// between requests once ctx is done.
+func syncSourceToSpotify(
+	ctx context.Context,
+	client *spotify.Client,
+	userID string,
+	playlists *[]spotify.SimplePlaylist,
+	mapping syncconfig.Resolved,
+	source syncSource,
+) *destinationResult {
+	result := &destinationResult{Source: source.Path}
+	fail := func(err error) *destinationResult {
+		result.err = err
+		result.Error = err.Error()
+		log.Printf("Failed to sync %s: %v", source.Path, err)
+		return result
+	}
+
+	name, err := mapping.DestinationName(source.Data)
+	if err != nil {
+		return fail(newError(codeUsage, "Invalid name template", err))
+	}
+	result.Name = name
+
+	var playlistID spotify.ID
+	switch matches := findMatchingPlaylists(*playlists, name); len(matches) {
+	case 0:
+		log.Printf("Creating new playlist: %s", name)
+		created, err := client.CreatePlaylistForUser(userID, name, mapping.Description, mapping.Public)
+		if err != nil {
+			return fail(newError(codeSpotify, fmt.Sprintf("Failed to create playlist %q", name), err))
+		}
+		*playlists = append(*playlists, created.SimplePlaylist)
+		playlistID = created.ID
+		result.Created = true
+	case 1:
+		existing := matches[0].p
+		playlistID = existing.ID
+		if existing.IsPublic != mapping.Public {
+			if err := client.ChangePlaylistAccess(playlistID, mapping.Public); err != nil {
+				return fail(newError(codeSpotify, fmt.Sprintf("Failed to change access of %q", name), err))
+			}
+		}
+		if err := updatePlaylistDescription(client, playlistID, mapping.Description); err != nil {
+			return fail(newError(codeSpotify, fmt.Sprintf("Failed to change description of %q", name), err))
+		}
+	default:
+		return fail(errorf(codeAmbiguous, "%d Spotify playlists are called %q", len(matches), name))
+	}
+
+	current, err := getSpotifyPlaylistTrackIDs(client, playlistID)
+	if err != nil {
+		return fail(newError(codeSpotify, fmt.Sprintf("Failed to get tracks of %q", name), err))
+	}
+
+	tracks := make([]rdbs.Track, len(source.Tracks))
+	for i, t := range source.Tracks {
+		tracks[i] = rdbs.Track{Artist: t.Artist, Title: t.Title}
+	}
+	found, sync := searchSpotifyTracks(ctx, client, tracks)
+	if err := ctx.Err(); err != nil {
+		return fail(newError(codeCancelled, "Sync cancelled", err))
+	}
+	sync.SpotifyPlaylistID = playlistID
+	sync.RekordboxPlaylistID = source.ID
+	result.syncResult = sync
+
+	wanted := make(map[spotify.ID]bool)
+	var add []spotify.ID
+	for _, track := range found {
+		if wanted[track.ID] {
+			continue
+		}
+		wanted[track.ID] = true
+		if !current[track.ID] {
+			add = append(add, track.ID)
+		}
+	}
+
+	for _, batch := range batchIDs(add) {
+		if err := ctx.Err(); err != nil {
+			return fail(newError(codeCancelled, "Sync cancelled", err))
+		}
+		if _, err := client.AddTracksToPlaylist(playlistID, batch...); err != nil {
+			return fail(newError(codeSpotify, fmt.Sprintf("Failed to add tracks to %q", name), err))
+		}
+		sync.Added += len(batch)
+	}
+
+	if !mapping.Prune {
+		return result
+	}
+	if len(sync.Failed) > 0 {
+		// A failed search doesn't mean the track left the source
+		log.Printf("Not pruning %s because %d searches failed", name, len(sync.Failed))
+		return result
+	}
+
+	var remove []spotify.ID
+	for id := range current {
+		if !wanted[id] {
+			remove = append(remove, id)
+		}
+	}
+	for _, batch := range batchIDs(remove) {
+		if err := ctx.Err(); err != nil {
+			return fail(newError(codeCancelled, "Sync cancelled", err))
+		}
+		if _, err := client.RemoveTracksFromPlaylist(playlistID, batch...); err != nil {
+			return fail(newError(codeSpotify, fmt.Sprintf("Failed to remove tracks from %q", name), err))
+		}
+		result.Removed += len(batch)
+	}
+
+	return result
+}
+
+// getSpotifyPlaylistTrackIDs returns the IDs of the tracks in a playlist.
+func getSpotifyPlaylistTrackIDs(client *spotify.Client, playlistID spotify.ID) (map[spotify.ID]bool, error) {
+	limit := 100
+	page, err := client.GetPlaylistTracksOpt(playlistID, &spotify.Options{Limit: &limit}, "items(track(id)),next")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get playlist tracks: %w", err)
+	}
+
+	ids := make(map[spotify.ID]bool)
+	for {
+		for _, item := range page.Tracks {
+			if item.Track.ID != "" { // Local files have no ID
+				ids[item.Track.ID] = true
+			}
+		}
+		err := client.NextPage(page)
+		if err == spotify.ErrNoMorePages {
+			return ids, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get playlist tracks: %w", err)
+		}
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func batchIDs(ids []spotify.ID) [][]spotify.ID {
+	var batches [][]spotify.ID
+	for len(ids) > 0 {
+		n := len(ids)
+		if n > spotifyBatchSize {
+			n = spotifyBatchSize
+		}
+		batches = append(batches, ids[:n])
+		ids = ids[n:]
+	}
+	return batches
+}
+
+func printSyncResults(results []*mappingResult) {
+	for _, r := range results {
+		if len(r.Destinations) == 0 && r.err != nil {
+			fmt.Printf("%s: FAILED: %v\n", r.Source, r.err)
+			continue
+		}
+
+		fmt.Printf("%s:\n", r.Source)
+		for _, d := range r.Destinations {
+			switch {
+			case d.Error != "":
+				fmt.Printf("  %s -> %s: FAILED: %s\n", d.Source, d.Name, d.Error)
+			default:
+				status := "updated"
+				if d.Created {
+					status = "created"
+				}
+				fmt.Printf("  %s -> %s (%s): %d/%d found, %d added, %d removed\n",
+					d.Source, d.Name, status, d.Found, d.Searched, d.Added, d.Removed)
+			}
+		}
+	}
+}
+
+// updatePlaylistDescription sets the description of a playlist unless it
+// already has it.
+func updatePlaylistDescription(client *spotify.Client, playlistID spotify.ID, description string) error {
+	playlist, err := client.GetPlaylistOpt(playlistID, "description")
+	if err != nil {
+		return err
+	}
+	// Spotify returns descriptions HTML escaped
+	if html.UnescapeString(playlist.Description) == description {
+		return nil
+	}
+	return client.ChangePlaylistDescription(playlistID, description)
+}
@@ -0,0 +1,507 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/cobra"
+	"github.com/zmb3/spotify"
+
+	"github.com/r-medina/rdbs/rekordbox"
+	"github.com/r-medina/rdbs/syncconfig"
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Re-sync configured playlists whenever the Rekordbox database changes",
+	Long: `Watch the Rekordbox database and its write-ahead log and, once changes
+settle, sync the playlists from the --config sync config that changed since
+the last sync. Runs until interrupted.
+
+Where the last sync got to is saved in a mark file, next to the config by
+default, so after a restart only playlists changed in the meantime are
+synced.`,
+	RunE: runWatch,
+}
+
+func setupWatchFlags() {
+	watchCmd.Flags().StringVar(&config.SyncConfig, "config", "",
+		"Path to the sync config file (required)")
+	watchCmd.MarkFlagRequired("config")
+
+	watchCmd.Flags().StringVar(&config.SpotifyClientID, "spotify-client-id", "",
+		"Spotify client ID (default: $SPOTIFY_ID or the config file)")
+
+	watchCmd.Flags().StringVar(&config.SpotifySecret, "spotify-secret", "",
+		"Spotify client secret (default: $SPOTIFY_SECRET or the config file, will prompt if not set)")
+
+	watchCmd.Flags().DurationVar(&config.WatchDebounce, "debounce", 5*time.Second,
+		"How long the database must be quiet before syncing")
+
+	watchCmd.Flags().BoolVar(&config.SkipInitialSync, "skip-initial-sync", false,
+		"Don't sync everything on startup, only later changes")
+
+	watchCmd.Flags().StringVar(&config.WatchMark, "mark", "",
+		"File that records the last sync (default: the config path with a .mark extension)")
+}
+
+func setupWatchCommands() {
+	rootCmd.AddCommand(watchCmd)
+}
+
+// watcher syncs the sources of a config whose version changed.
+type watcher struct {
+	cfg       *syncconfig.Config
+	client    *spotify.Client
+	userID    string
+	playlists []spotify.SimplePlaylist
+	// synced maps a mapping index and source ID to what was last synced
+	// successfully.
+	synced map[string]syncedSource
+	// mark is where the database was when every source was last in sync,
+	// saved to markPath.
+	mark     rekordbox.Mark
+	markPath string
+}
+
+func runWatch(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	cfg, err := syncconfig.Load(config.SyncConfig)
+	if err != nil {
+		return newError(codeUsage, "Failed to load sync config", err)
+	}
+
+	db, err := initializeDB()
+	if err != nil {
+		return err
+	}
+	dbPath := db.Path()
+	db.Close()
+
+	client, userID, err := authenticateSyncSpotify(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	playlists, err := getUserPlaylists(client, userID)
+	if err != nil {
+		return err
+	}
+
+	markPath := config.WatchMark
+	if markPath == "" {
+		markPath = strings.TrimSuffix(config.SyncConfig, filepath.Ext(config.SyncConfig)) + ".mark"
+	}
+	mark, err := rekordbox.LoadMark(markPath)
+	if err != nil {
+		return newError(codeIO, "Failed to load mark", err)
+	}
+
+	w := &watcher{
+		cfg:       cfg,
+		client:    client,
+		userID:    userID,
+		playlists: playlists,
+		synced:    make(map[string]syncedSource),
+		mark:      mark,
+		markPath:  markPath,
+	}
+
+	// Watch the directory rather than the files: Rekordbox creates and
+	// removes the -wal file, and may replace master.db.
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return newError(codeIO, "Failed to watch database", err)
+	}
+	defer fsw.Close()
+	if err := fsw.Add(filepath.Dir(dbPath)); err != nil {
+		return newError(codeIO, "Failed to watch database", err)
+	}
+
+	// With a mark from an earlier run, only what changed since is synced.
+	switch {
+	case config.SkipInitialSync:
+		err = w.record(ctx)
+	case mark.USN > 0:
+		log.Printf("Syncing changes since USN %d", mark.USN)
+		err = w.cycle(ctx, false)
+	default:
+		err = w.cycle(ctx, true)
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("Watching %s for changes", dbPath)
+
+	watched := map[string]bool{
+		filepath.Base(dbPath):          true,
+		filepath.Base(dbPath) + "-wal": true,
+	}
+	debounce := time.NewTimer(0)
+	if !debounce.Stop() {
+		<-debounce.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Stopped watching")
+			return nil
+		case event, ok := <-fsw.Events:
+			if !ok {
+				return nil
+			}
+			if watched[filepath.Base(event.Name)] && !event.Has(fsnotify.Chmod) {
+				debounce.Reset(config.WatchDebounce)
+			}
+		case err, ok := <-fsw.Errors:
+			if !ok {
+				return nil
+			}
+			log.Printf("Watch error: %v", err)
+		case <-debounce.C:
+			if err := w.cycle(ctx, false); err != nil {
+				log.Printf("Sync failed: %v", err)
+			}
+		}
+	}
+}
+
+// watchSource is a sync source with the version of what it would sync.
+type watchSource struct {
+	syncSource
+	mapping int
+	key     string // Identifies the source within its mapping
+	version string
+}
+
+// syncedSource is what a source was last synced with.
+type syncedSource struct {
+	version string
+	digest  uint64          // trackDigest of its tracks
+	tracks  map[string]bool // IDs of its tracks
+}
+
+// record marks every source as synced at its current version without
+// syncing it, so only later changes are synced.
+func (w *watcher) record(ctx context.Context) error {
+	db, err := initializeDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	changes, err := db.ChangesSinceContext(ctx, w.mark)
+	if err != nil {
+		return newError(codeDatabase, "Failed to get database changes", err)
+	}
+	versions, err := getSourceVersions(ctx, db)
+	if err != nil {
+		return err
+	}
+	sources, failed, err := w.sources(ctx, db, versions)
+	if err != nil {
+		return err
+	}
+	recorded := 0
+	for _, source := range sources {
+		if err := loadSourceTracks(ctx, db, &source.syncSource); err != nil {
+			failed = append(failed, failedMapping(w.cfg.Mappings[source.mapping], err))
+			continue
+		}
+		w.remember(source)
+		recorded++
+	}
+	if len(failed) == 0 {
+		if err := w.saveMark(changes.Mark()); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Skipped initial sync of %d sources", recorded)
+	for _, r := range failed {
+		log.Printf("Failed to resolve %s: %v", r.Source, r.err)
+	}
+	return nil
+}
+
+// cycle syncs every source that changed since it was last synced, or all
+// of them if force is set. It only fails when the database can't be read;
+// failed mappings are reported and retried on the next cycle.
+func (w *watcher) cycle(ctx context.Context, force bool) error {
+	db, err := initializeDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// Skip the per-source queries when nothing at all was written.
+	usn, err := db.CurrentUSNContext(ctx)
+	if err != nil {
+		return newError(codeDatabase, "Failed to get database USN", err)
+	}
+	if !force && usn == w.mark.USN {
+		log.Println("No database changes to sync")
+		return nil
+	}
+
+	changes, err := db.ChangesSinceContext(ctx, w.mark)
+	if err != nil {
+		return newError(codeDatabase, "Failed to get database changes", err)
+	}
+	versions, err := getSourceVersions(ctx, db)
+	if err != nil {
+		return err
+	}
+	sources, results, err := w.sources(ctx, db, versions)
+	if err != nil {
+		return err
+	}
+
+	byMapping := make(map[int]*mappingResult)
+	resultOf := func(source watchSource) *mappingResult {
+		result := byMapping[source.mapping]
+		if result == nil {
+			m := w.cfg.Mappings[source.mapping]
+			result = &mappingResult{Source: m.String(), Destinations: []*destinationResult{}}
+			byMapping[source.mapping] = result
+			results = append(results, result)
+		}
+		return result
+	}
+
+	for _, source := range sources {
+		// Tracks are only loaded for sources the changes may affect.
+		if !force && !w.mayHaveChanged(source, changes, versions) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return newError(codeCancelled, "Sync cancelled", err)
+		}
+		if err := loadSourceTracks(ctx, db, &source.syncSource); err != nil {
+			if result := resultOf(source); result.err == nil {
+				result.err = err
+				result.Error = err.Error()
+			}
+			continue
+		}
+		if !force && !w.changed(source, changes, versions) {
+			// Still what was synced, so later cycles can compare with it.
+			w.remember(source)
+			continue
+		}
+
+		m := w.cfg.Mappings[source.mapping]
+		result := resultOf(source)
+
+		log.Printf("Syncing %s", source.Path)
+		dest := syncSourceToSpotify(ctx, w.client, w.userID, &w.playlists, w.cfg.Resolve(m), source.syncSource)
+		result.Destinations = append(result.Destinations, dest)
+		if dest.err == nil {
+			w.remember(source)
+		} else if result.err == nil {
+			result.err = dest.err
+			result.Error = dest.Error
+		}
+	}
+
+	failed := false
+	for _, r := range results {
+		failed = failed || r.err != nil
+	}
+	if !failed {
+		if err := w.saveMark(changes.Mark()); err != nil {
+			return err
+		}
+	}
+
+	if len(results) == 0 {
+		log.Println("No playlist changes to sync")
+		return nil
+	}
+
+	out := struct {
+		SyncedAt time.Time        `json:"synced_at"`
+		Mappings []*mappingResult `json:"mappings"`
+	}{time.Now().UTC(), results}
+	return printResult(out, func() { printSyncResults(results) })
+}
+
+// sources resolves the sources of every mapping, without their tracks.
+// Mappings that fail to resolve are returned as failed results.
+func (w *watcher) sources(ctx context.Context, db *rekordbox.DB, versions *sourceVersions) ([]watchSource, []*mappingResult, error) {
+	hierarchy, err := getPlaylistHierarchy(ctx, db, rekordbox.WithTrackCounts())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var sources []watchSource
+	var failed []*mappingResult
+	for i, m := range w.cfg.Mappings {
+		resolved, err := resolveSyncSources(ctx, db, hierarchy, m)
+		if err != nil {
+			failed = append(failed, failedMapping(m, err))
+			continue
+		}
+
+		for _, source := range resolved {
+			sources = append(sources, watchSource{
+				syncSource: source,
+				mapping:    i,
+				key:        fmt.Sprintf("%d/%s/%s", i, source.Kind, source.ID),
+				version:    versions.of(source),
+			})
+		}
+	}
+	return sources, failed, nil
+}
+
+// failedMapping returns the result of a mapping that failed with err.
+func failedMapping(m syncconfig.Mapping, err error) *mappingResult {
+	return &mappingResult{
+		Source:       m.String(),
+		Destinations: []*destinationResult{},
+		Error:        err.Error(),
+		err:          err,
+	}
+}
+
+// remember records source, with its tracks loaded, as synced.
+func (w *watcher) remember(source watchSource) {
+	tracks := make(map[string]bool, len(source.Tracks))
+	for _, t := range source.Tracks {
+		tracks[t.ID] = true
+	}
+	w.synced[source.key] = syncedSource{
+		version: source.version,
+		digest:  trackDigest(source.Tracks),
+		tracks:  tracks,
+	}
+}
+
+// mayHaveChanged reports whether the changes since the saved mark may
+// affect source, before its tracks are loaded. Changed tracks are matched
+// against the tracks it was last synced with; sources not synced by this
+// process, and smart playlists, which can start matching any track, may be
+// affected by every changed track.
+func (w *watcher) mayHaveChanged(source watchSource, changes *rekordbox.Changes, versions *sourceVersions) bool {
+	synced, ok := w.synced[source.key]
+	if ok && synced.version != source.version {
+		return true
+	}
+
+	for _, change := range changes.Tracks {
+		if !ok || synced.tracks[change.Track.ID] || source.Kind == syncconfig.SourceSmartPlaylist {
+			return true
+		}
+	}
+	return rowsChanged(source, changes, versions)
+}
+
+// changed reports whether source, with its tracks loaded, needs syncing.
+// Sources synced by this process are compared with what was synced, so
+// writes to track columns a sync doesn't use don't cause a resync. Others,
+// after a restart, are checked against the changes since the saved mark.
+func (w *watcher) changed(source watchSource, changes *rekordbox.Changes, versions *sourceVersions) bool {
+	if synced, ok := w.synced[source.key]; ok {
+		return synced.version != source.version || synced.digest != trackDigest(source.Tracks)
+	}
+
+	tracks := make(map[string]bool, len(source.Tracks))
+	for _, t := range source.Tracks {
+		tracks[t.ID] = true
+	}
+	for _, change := range changes.Tracks {
+		// Smart playlists can start matching any changed track
+		if tracks[change.Track.ID] || source.Kind == syncconfig.SourceSmartPlaylist {
+			return true
+		}
+	}
+
+	return rowsChanged(source, changes, versions)
+}
+
+// rowsChanged reports whether the playlist or My Tag rows source is read
+// from changed since the saved mark.
+func rowsChanged(source watchSource, changes *rekordbox.Changes, versions *sourceVersions) bool {
+	if source.Kind == syncconfig.SourceMyTag {
+		// Changes don't cover My Tags, but their rows carry a USN
+		return versions.myTags[source.ID].USN > changes.Since.USN
+	}
+	for _, change := range changes.Playlists {
+		if change.ID == source.ID {
+			return true
+		}
+	}
+	for _, change := range changes.Memberships {
+		if change.PlaylistID == source.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// saveMark records mark as the point every source is in sync with.
+func (w *watcher) saveMark(mark rekordbox.Mark) error {
+	if err := mark.Save(w.markPath); err != nil {
+		return newError(codeIO, "Failed to save mark", err)
+	}
+	w.mark = mark
+	return nil
+}
+
+// sourceVersions holds the versions of the playlist and My Tag rows a
+// sync source is read from.
+type sourceVersions struct {
+	playlists map[string]rekordbox.Version
+	myTags    map[string]rekordbox.Version
+}
+
+func getSourceVersions(ctx context.Context, db *rekordbox.DB) (*sourceVersions, error) {
+	var v sourceVersions
+	var err error
+	if v.playlists, err = db.GetPlaylistVersionsContext(ctx); err != nil {
+		return nil, newError(codeDatabase, "Failed to get playlist versions", err)
+	}
+	if v.myTags, err = db.GetMyTagVersionsContext(ctx); err != nil {
+		return nil, newError(codeDatabase, "Failed to get My Tag versions", err)
+	}
+	return &v, nil
+}
+
+// of returns the version of the playlist or My Tag row a source is read
+// from. Its tracks are compared separately, with trackDigest.
+func (v *sourceVersions) of(source syncSource) string {
+	var row rekordbox.Version
+	if source.Kind == syncconfig.SourceMyTag {
+		row = v.myTags[source.ID]
+	} else {
+		row = v.playlists[source.ID]
+	}
+	return fmt.Sprintf("%v/%s", row, source.Path)
+}
+
+// trackDigest hashes the IDs, artists and titles of tracks, in any order.
+// These are the only track columns a sync uses, so writes like play counts
+// don't cause a resync.
+func trackDigest(tracks []rekordbox.FullTrack) uint64 {
+	keys := make([]string, len(tracks))
+	for i, t := range tracks {
+		keys[i] = strings.Join([]string{t.ID, t.Artist, t.Title}, "\x1f")
+	}
+	sort.Strings(keys)
+
+	h := fnv.New64a()
+	for _, key := range keys {
+		io.WriteString(h, key)
+		h.Write([]byte{0x1e})
+	}
+	return h.Sum64()
+}
@@ -0,0 +1,564 @@
+// Package engine writes Engine DJ (Denon) libraries.
+//
+// Engine OS reads its library from "Engine Library/Database2/m.db" at the
+// root of a drive. Track paths in the database are relative to the
+// Database2 directory, so every track has to be on the same drive.
+package engine
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "github.com/mutecomm/go-sqlcipher/v4"
+
+	"github.com/r-medina/rdbs/rekordbox"
+)
+
+// LibraryDir is the path of the database directory relative to a drive root.
+var LibraryDir = filepath.Join("Engine Library", "Database2")
+
+// DBName is the file name of the main library database.
+const DBName = "m.db"
+
+// MusicDir is where Export copies audio files to, relative to the root.
+var MusicDir = filepath.Join("Engine Library", "Music")
+
+// Options configure Export.
+type Options struct {
+	// CopyAudio copies the files of tracks that aren't under the root into
+	// MusicDir. Otherwise those tracks are skipped, since Engine can't
+	// reach files on other drives.
+	CopyAudio bool
+}
+
+// Schema version written to the Information table (Engine DJ 2.x).
+const (
+	SchemaVersionMajor = 2
+	SchemaVersionMinor = 18
+	SchemaVersionPatch = 0
+)
+
+var schema = []string{
+	`CREATE TABLE Information (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		uuid TEXT,
+		schemaVersionMajor INTEGER,
+		schemaVersionMinor INTEGER,
+		schemaVersionPatch INTEGER,
+		currentPlayedIndiciator INTEGER,
+		lastRekordBoxLibraryImportReadCounter INTEGER)`,
+	`CREATE TABLE Track (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		playOrder INTEGER,
+		length INTEGER,
+		bpm INTEGER,
+		year INTEGER,
+		path TEXT,
+		filename TEXT,
+		bitrate INTEGER,
+		bpmAnalyzed REAL,
+		albumArtId INTEGER,
+		fileBytes INTEGER,
+		title TEXT,
+		artist TEXT,
+		album TEXT,
+		genre TEXT,
+		comment TEXT,
+		label TEXT,
+		composer TEXT,
+		remixer TEXT,
+		key INTEGER,
+		rating INTEGER,
+		albumArt TEXT,
+		timeLastPlayed DATETIME,
+		isPlayed BOOLEAN,
+		fileType TEXT,
+		isAnalyzed BOOLEAN,
+		dateCreated DATETIME,
+		dateAdded DATETIME,
+		isAvailable BOOLEAN,
+		isMetadataOfPackedTrackChanged BOOLEAN,
+		isPerfomanceDataOfPackedTrackChanged BOOLEAN,
+		playedIndicator INTEGER,
+		isMetadataImported BOOLEAN,
+		pdbImportKey INTEGER,
+		streamingSource TEXT,
+		uri TEXT,
+		isBeatGridLocked BOOLEAN,
+		originDatabaseUuid TEXT,
+		originTrackId INTEGER,
+		trackData BLOB,
+		overviewWaveFormData BLOB,
+		beatData BLOB,
+		quickCues BLOB,
+		loops BLOB,
+		thirdPartySourceId INTEGER,
+		streamingFlags INTEGER,
+		explicitLyrics BOOLEAN,
+		activeOnLoadLoops INTEGER,
+		lastEditTime DATETIME)`,
+	`CREATE TABLE Playlist (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		title TEXT,
+		parentListId INTEGER,
+		isPersisted BOOLEAN,
+		nextListId INTEGER,
+		lastEditTime DATETIME,
+		isExplicitlyExported BOOLEAN,
+		CONSTRAINT C_NAME_UNIQUE_FOR_PARENT UNIQUE (title, parentListId))`,
+	`CREATE TABLE PlaylistEntity (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		listId INTEGER,
+		trackId INTEGER,
+		databaseUuid TEXT,
+		nextEntityId INTEGER,
+		membershipReference INTEGER,
+		CONSTRAINT C_NAME_UNIQUE_FOR_LIST UNIQUE (listId, databaseUuid, trackId),
+		FOREIGN KEY (listId) REFERENCES Playlist (id) ON DELETE CASCADE)`,
+	`CREATE INDEX index_Track_path ON Track (path)`,
+	`CREATE INDEX index_Playlist_parentListId ON Playlist (parentListId)`,
+	`CREATE INDEX index_PlaylistEntity_listId ON PlaylistEntity (listId)`,
+}
+
+// Library is an Engine DJ library being written.
+type Library struct {
+	root   string // Drive root the library is on
+	dir    string // Directory containing m.db
+	opts   Options
+	uuid   string
+	sqlDB  *sql.DB
+	tracks map[string]int64 // Track IDs by file path
+	// Playlist IDs by listKey. Rekordbox allows a folder and a playlist,
+	// or two playlists, with the same name under one parent.
+	lists  map[string]int64
+	titles map[int64]map[string]bool // Titles in use under each parent
+
+	// Skipped are the tracks left out of playlists because their file
+	// isn't on the drive or, with CopyAudio, doesn't exist.
+	Skipped []rekordbox.FullTrack
+	skipped map[string]bool
+}
+
+// Create creates a new library database at path, which is LibraryDir under
+// the drive root. It fails if path exists.
+func Create(path string, opts Options) (*Library, error) {
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("engine library %s already exists", path)
+	}
+
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+
+	uuid, err := newUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	sqlDB, err := sql.Open("sqlite3", "file:"+path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open engine library %s: %w", path, err)
+	}
+
+	lib := &Library{
+		root:    filepath.Dir(filepath.Dir(dir)),
+		dir:     dir,
+		opts:    opts,
+		uuid:    uuid,
+		sqlDB:   sqlDB,
+		tracks:  make(map[string]int64),
+		lists:   make(map[string]int64),
+		titles:  make(map[int64]map[string]bool),
+		skipped: make(map[string]bool),
+	}
+
+	for _, stmt := range schema {
+		if _, err := sqlDB.Exec(stmt); err != nil {
+			sqlDB.Close()
+			return nil, fmt.Errorf("failed to create engine schema: %w", err)
+		}
+	}
+
+	_, err = sqlDB.Exec(`
+		INSERT INTO Information (
+			uuid,
+			schemaVersionMajor,
+			schemaVersionMinor,
+			schemaVersionPatch,
+			currentPlayedIndiciator,
+			lastRekordBoxLibraryImportReadCounter
+		) VALUES (?, ?, ?, ?, 0, 0)`,
+		lib.uuid, SchemaVersionMajor, SchemaVersionMinor, SchemaVersionPatch,
+	)
+	if err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("failed to write engine information: %w", err)
+	}
+
+	return lib, nil
+}
+
+// Close closes the library database.
+func (l *Library) Close() error {
+	return l.sqlDB.Close()
+}
+
+// AddPlaylists writes playlists, their folders and their tracks in a single
+// transaction. Each playlist's Path places it in the folder hierarchy.
+// Tracks without a file location are left out, and ones that can't be
+// put on the drive are added to Skipped.
+func (l *Library) AddPlaylists(playlists []*rekordbox.FullPlaylist) error {
+	tx, err := l.sqlDB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, playlist := range playlists {
+		listID, err := l.ensureList(tx, playlist)
+		if err != nil {
+			return err
+		}
+
+		var trackIDs []int64
+		seen := make(map[int64]bool)
+		for _, track := range playlist.Tracks {
+			if track.FolderPath == "" {
+				continue
+			}
+			trackID, ok, err := l.ensureTrack(tx, track)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			// Engine playlists cannot reference a track twice.
+			if seen[trackID] {
+				continue
+			}
+			seen[trackID] = true
+			trackIDs = append(trackIDs, trackID)
+		}
+
+		if err := l.addEntities(tx, listID, trackIDs); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit engine library: %w", err)
+	}
+	return nil
+}
+
+// ensureList returns the ID of the list for playlist, creating it and the
+// folders on its Path as needed. Siblings are kept in the linked list
+// Engine uses for ordering via nextListId.
+func (l *Library) ensureList(tx *sql.Tx, playlist *rekordbox.FullPlaylist) (int64, error) {
+	path := playlist.Path
+	if len(path) == 0 {
+		path = []string{playlist.Name}
+	}
+
+	var parentID int64
+	for i := range path {
+		key := listKey(playlist, path[:i+1])
+		if id, exists := l.lists[key]; exists {
+			parentID = id
+			continue
+		}
+
+		title := l.uniqueTitle(parentID, path[i])
+		res, err := tx.Exec(`
+			INSERT INTO Playlist (title, parentListId, isPersisted, nextListId, lastEditTime, isExplicitlyExported)
+			VALUES (?, ?, 1, 0, ?, 1)`,
+			title, parentID, time.Now().Unix(),
+		)
+		if err != nil {
+			return 0, fmt.Errorf("failed to create engine playlist %q: %w", title, err)
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return 0, fmt.Errorf("failed to get engine playlist ID: %w", err)
+		}
+
+		_, err = tx.Exec(`
+			UPDATE Playlist SET nextListId = ?
+			WHERE parentListId = ? AND nextListId = 0 AND id != ?`,
+			id, parentID, id,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("failed to link engine playlist %q: %w", title, err)
+		}
+
+		l.lists[key] = id
+		parentID = id
+	}
+	return parentID, nil
+}
+
+// listKey identifies the list at path, which is playlist itself or one of
+// the folders above it. Playlists are told apart by their Rekordbox ID,
+// folders by their path.
+func listKey(playlist *rekordbox.FullPlaylist, path []string) string {
+	if len(path) == len(playlist.Path) || len(playlist.Path) == 0 {
+		return "playlist\x00" + playlist.ID
+	}
+	return "folder\x00" + strings.Join(path, "\x00")
+}
+
+// uniqueTitle returns title, with a number added if another list under
+// parentID already has it. Engine requires titles to be unique per parent.
+func (l *Library) uniqueTitle(parentID int64, title string) string {
+	used := l.titles[parentID]
+	if used == nil {
+		used = make(map[string]bool)
+		l.titles[parentID] = used
+	}
+
+	unique := title
+	for n := 2; used[unique]; n++ {
+		unique = fmt.Sprintf("%s (%d)", title, n)
+	}
+	used[unique] = true
+	return unique
+}
+
+// ensureTrack returns the ID of track, writing it if needed. It is false
+// if the track was skipped.
+func (l *Library) ensureTrack(tx *sql.Tx, track rekordbox.FullTrack) (int64, bool, error) {
+	if id, exists := l.tracks[track.FolderPath]; exists {
+		return id, true, nil
+	}
+	if l.skipped[track.FolderPath] {
+		return 0, false, nil
+	}
+
+	file, ok, err := l.placeFile(track.FolderPath)
+	if err != nil {
+		return 0, false, err
+	}
+	if !ok {
+		l.skipped[track.FolderPath] = true
+		l.Skipped = append(l.Skipped, track)
+		return 0, false, nil
+	}
+	rel, err := filepath.Rel(l.dir, file)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to locate %s: %w", file, err)
+	}
+
+	var key interface{}
+	if k, ok := keyIndex(track.Key); ok {
+		key = k
+	}
+
+	var fileBytes int64
+	if info, err := os.Stat(file); err == nil {
+		fileBytes = info.Size()
+	}
+
+	var dateAdded int64
+	if !track.DateCreated.IsZero() {
+		dateAdded = track.DateCreated.Unix()
+	}
+
+	res, err := tx.Exec(`
+		INSERT INTO Track (
+			playOrder, length, bpm, year, path, filename, bpmAnalyzed, fileBytes,
+			title, artist, album, genre, label, key, rating, fileType,
+			isAnalyzed, dateCreated, dateAdded, isAvailable,
+			isMetadataOfPackedTrackChanged, isPerfomanceDataOfPackedTrackChanged,
+			isMetadataImported, isBeatGridLocked, originDatabaseUuid, originTrackId,
+			streamingFlags, explicitLyrics, lastEditTime
+		) VALUES (
+			?, ?, ?, ?, ?, ?, ?, ?,
+			?, ?, ?, ?, ?, ?, ?, ?,
+			0, ?, ?, 1,
+			0, 0,
+			1, 0, ?, 0,
+			0, 0, ?
+		)`,
+		track.TrackNumber, track.Length, int(track.Tempo()+0.5), track.Year,
+		filepath.ToSlash(rel), filepath.Base(file), track.Tempo(), fileBytes,
+		track.Title, track.Artist, track.Album, track.Genre, track.Label, key, ratingPercent(track.Rating),
+		strings.TrimPrefix(strings.ToLower(filepath.Ext(track.FolderPath)), "."),
+		dateAdded, dateAdded,
+		l.uuid,
+		time.Now().Unix(),
+	)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to write engine track %q: %w", track.Title, err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get engine track ID: %w", err)
+	}
+
+	// Engine expects originTrackId to be the track's own ID for local tracks.
+	if _, err := tx.Exec(`UPDATE Track SET originTrackId = ? WHERE id = ?`, id, id); err != nil {
+		return 0, false, fmt.Errorf("failed to update engine track %q: %w", track.Title, err)
+	}
+
+	l.tracks[track.FolderPath] = id
+	return id, true, nil
+}
+
+// addEntities adds tracks to a playlist, linking them in order through
+// nextEntityId.
+func (l *Library) addEntities(tx *sql.Tx, listID int64, trackIDs []int64) error {
+	var prevID int64
+	for _, trackID := range trackIDs {
+		res, err := tx.Exec(`
+			INSERT INTO PlaylistEntity (listId, trackId, databaseUuid, nextEntityId, membershipReference)
+			VALUES (?, ?, ?, 0, 0)`,
+			listID, trackID, l.uuid,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to add track %d to engine playlist %d: %w", trackID, listID, err)
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to get engine playlist entity ID: %w", err)
+		}
+
+		if prevID != 0 {
+			if _, err := tx.Exec(`UPDATE PlaylistEntity SET nextEntityId = ? WHERE id = ?`, id, prevID); err != nil {
+				return fmt.Errorf("failed to link engine playlist entity: %w", err)
+			}
+		}
+		prevID = id
+	}
+	return nil
+}
+
+// placeFile returns where the library finds file: file itself if it is
+// under the root, or a copy in MusicDir with CopyAudio. It is false if the
+// file can't be put on the drive.
+func (l *Library) placeFile(file string) (string, bool, error) {
+	file, err := filepath.Abs(file)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to resolve %s: %w", file, err)
+	}
+	if within(l.root, file) {
+		return file, true, nil
+	}
+	if !l.opts.CopyAudio {
+		return "", false, nil
+	}
+
+	dest, err := l.copyAudio(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return dest, true, nil
+}
+
+// within reports whether file is inside dir.
+func within(dir, file string) bool {
+	rel, err := filepath.Rel(dir, file)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// copyAudio copies file into MusicDir. A file of the same name and size
+// already there is taken to be an earlier copy; files that only share the
+// name get a number added.
+func (l *Library) copyAudio(file string) (string, error) {
+	src, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(l.root, MusicDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+
+	ext := filepath.Ext(file)
+	base := strings.TrimSuffix(filepath.Base(file), ext)
+	dest := filepath.Join(dir, base+ext)
+	for n := 2; ; n++ {
+		existing, err := os.Stat(dest)
+		if errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		if err == nil && existing.Size() == info.Size() {
+			return dest, nil
+		}
+		dest = filepath.Join(dir, fmt.Sprintf("%s (%d)%s", base, n, ext))
+	}
+
+	dst, err := os.Create(dest)
+	if err != nil {
+		return "", fmt.Errorf("failed to copy %s: %w", file, err)
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return "", fmt.Errorf("failed to copy %s: %w", file, err)
+	}
+	if err := dst.Close(); err != nil {
+		return "", fmt.Errorf("failed to copy %s: %w", file, err)
+	}
+	return dest, nil
+}
+
+// Export creates a library under root, normally the root of a drive, and
+// writes playlists into it. It returns the path of the database and the
+// tracks that were skipped.
+func Export(root string, playlists []*rekordbox.FullPlaylist, opts Options) (string, []rekordbox.FullTrack, error) {
+	path := filepath.Join(root, LibraryDir, DBName)
+
+	lib, err := Create(path, opts)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if err := lib.AddPlaylists(playlists); err != nil {
+		lib.Close()
+		return "", nil, err
+	}
+
+	return path, lib.Skipped, lib.Close()
+}
+
+func ratingPercent(stars int) int {
+	switch {
+	case stars < 0:
+		return 0
+	case stars > 5:
+		return 100
+	default:
+		return stars * 20
+	}
+}
+
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("failed to generate library UUID: %w", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
@@ -0,0 +1,183 @@
+package engine
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/r-medina/rdbs/rekordbox"
+)
+
+// audioFile creates an empty audio file at path.
+func audioFile(t *testing.T, path string) rekordbox.FullTrack {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("audio"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Base(path)
+	return rekordbox.FullTrack{ID: name, Title: name, FolderPath: path, BPM: 12400, Key: "Am"}
+}
+
+func TestExport(t *testing.T) {
+	root := t.TempDir()
+	a := audioFile(t, filepath.Join(root, "Music", "a.mp3"))
+	b := audioFile(t, filepath.Join(root, "Music", "b.mp3"))
+	elsewhere := audioFile(t, filepath.Join(t.TempDir(), "c.mp3"))
+
+	playlists := []*rekordbox.FullPlaylist{
+		{ID: "1", Name: "Set", Path: []string{"Mix", "Set"}, Tracks: []rekordbox.FullTrack{a, b, a}},
+		// A playlist named like the folder next to it
+		{ID: "2", Name: "Mix", Path: []string{"Mix"}, Tracks: []rekordbox.FullTrack{b}},
+		// A playlist named like its sibling
+		{ID: "3", Name: "Set", Path: []string{"Mix", "Set"}, Tracks: []rekordbox.FullTrack{elsewhere, a}},
+	}
+
+	path, skipped, err := Export(root, playlists, Options{})
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if want := filepath.Join(root, LibraryDir, DBName); path != want {
+		t.Errorf("path = %s, want %s", path, want)
+	}
+	if len(skipped) != 1 || skipped[0].ID != elsewhere.ID {
+		t.Errorf("skipped = %v, want only %s", skipped, elsewhere.ID)
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	tables := queryStrings(t, db, `
+		SELECT name FROM sqlite_master
+		WHERE type = 'table' AND name NOT LIKE 'sqlite_%'
+		ORDER BY name`)
+	if want := []string{"Information", "Playlist", "PlaylistEntity", "Track"}; !reflect.DeepEqual(tables, want) {
+		t.Errorf("tables = %q, want %q", tables, want)
+	}
+
+	var uuid string
+	var major, minor int
+	err = db.QueryRow(`SELECT uuid, schemaVersionMajor, schemaVersionMinor FROM Information`).Scan(&uuid, &major, &minor)
+	if err != nil {
+		t.Fatalf("reading Information: %v", err)
+	}
+	if uuid == "" || major != SchemaVersionMajor || minor != SchemaVersionMinor {
+		t.Errorf("Information = %s %d.%d, want a UUID and %d.%d", uuid, major, minor, SchemaVersionMajor, SchemaVersionMinor)
+	}
+
+	// id, title, parent and next sibling of every list
+	lists := queryStrings(t, db, `
+		SELECT id || ' ' || title || ' ' || parentListId || ' ' || nextListId
+		FROM Playlist ORDER BY id`)
+	wantLists := []string{
+		"1 Mix 0 3",
+		"2 Set 1 4",
+		"3 Mix (2) 0 0",
+		"4 Set (2) 1 0",
+	}
+	if !reflect.DeepEqual(lists, wantLists) {
+		t.Errorf("lists = %q, want %q", lists, wantLists)
+	}
+
+	tracks := queryStrings(t, db, `
+		SELECT path || ' ' || bpm || ' ' || originDatabaseUuid || ' ' || (originTrackId = id)
+		FROM Track ORDER BY id`)
+	wantTracks := []string{
+		"../../Music/a.mp3 124 " + uuid + " 1",
+		"../../Music/b.mp3 124 " + uuid + " 1",
+	}
+	if !reflect.DeepEqual(tracks, wantTracks) {
+		t.Errorf("tracks = %q, want %q", tracks, wantTracks)
+	}
+
+	// Entities of each list in nextEntityId order
+	for _, tt := range []struct {
+		list int
+		want []string
+	}{
+		{2, []string{"a.mp3", "b.mp3"}},
+		{3, []string{"b.mp3"}},
+		{4, []string{"a.mp3"}},
+	} {
+		got := queryStrings(t, db, `
+			WITH RECURSIVE entities(id, trackId, next) AS (
+				SELECT id, trackId, nextEntityId FROM PlaylistEntity
+				WHERE listId = ?1 AND id NOT IN (SELECT nextEntityId FROM PlaylistEntity WHERE listId = ?1)
+				UNION ALL
+				SELECT e.id, e.trackId, e.nextEntityId FROM PlaylistEntity e JOIN entities ON e.id = entities.next
+			)
+			SELECT Track.filename FROM entities JOIN Track ON Track.id = entities.trackId`, tt.list)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("list %d = %q, want %q", tt.list, got, tt.want)
+		}
+	}
+}
+
+func TestExportCopyAudio(t *testing.T) {
+	root := t.TempDir()
+	elsewhere := audioFile(t, filepath.Join(t.TempDir(), "c.mp3"))
+	missing := rekordbox.FullTrack{ID: "gone", FolderPath: filepath.Join(t.TempDir(), "gone.mp3")}
+
+	playlists := []*rekordbox.FullPlaylist{
+		{ID: "1", Name: "Set", Path: []string{"Set"}, Tracks: []rekordbox.FullTrack{elsewhere, missing}},
+	}
+	path, skipped, err := Export(root, playlists, Options{CopyAudio: true})
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if len(skipped) != 1 || skipped[0].ID != missing.ID {
+		t.Errorf("skipped = %v, want only %s", skipped, missing.ID)
+	}
+	if _, err := os.Stat(filepath.Join(root, MusicDir, "c.mp3")); err != nil {
+		t.Errorf("audio wasn't copied: %v", err)
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	paths := queryStrings(t, db, `SELECT path FROM Track`)
+	if want := []string{"../Music/c.mp3"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("paths = %q, want %q", paths, want)
+	}
+}
+
+func TestCreateExisting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DBName)
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Create(path, Options{}); err == nil {
+		t.Error("Create overwrote an existing library")
+	}
+}
+
+func queryStrings(t *testing.T, db *sql.DB, query string, args ...interface{}) []string {
+	t.Helper()
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	defer rows.Close()
+
+	var out []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			t.Fatalf("scan: %v", err)
+		}
+		out = append(out, s)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	return out
+}
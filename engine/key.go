@@ -0,0 +1,19 @@
+package engine
+
+import "github.com/r-medina/rdbs/key"
+
+// keyIndex converts a Rekordbox key name into Engine's key index, which
+// walks the Camelot wheel from 8B with the relative minor following each
+// major key.
+func keyIndex(name string) (int, bool) {
+	k, err := key.Parse(name)
+	if err != nil {
+		return 0, false
+	}
+
+	index := ((k.CamelotNumber() - 8 + 12) % 12) * 2
+	if k.Minor() {
+		index++
+	}
+	return index, true
+}
@@ -0,0 +1,267 @@
+// Package export defines the stable JSON and CSV schema used to dump
+// Rekordbox playlists and tracks for other tools.
+//
+// Fields are only ever added to these types. Renaming or removing a field,
+// or changing its meaning, bumps SchemaVersion.
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/r-medina/rdbs/rekordbox"
+)
+
+// SchemaVersion is the version of the schema described by this package.
+const SchemaVersion = 1
+
+// Document is the top level JSON object.
+type Document struct {
+	SchemaVersion int       `json:"schema_version"`
+	ExportedAt    time.Time `json:"exported_at"`
+	// Playlists is filled when exporting playlists or folders and is
+	// empty, never null, otherwise.
+	Playlists []Playlist `json:"playlists"`
+	// Tracks is filled when exporting the whole collection and is empty,
+	// never null, otherwise.
+	Tracks []Track `json:"tracks"`
+}
+
+// Playlist is a Rekordbox playlist.
+type Playlist struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name"`
+	Path   []string `json:"path"` // Folder names from the root down, ending with Name
+	Tracks []Track  `json:"tracks"`
+}
+
+// Track is a track in the Rekordbox collection.
+type Track struct {
+	ID              string  `json:"id"`
+	Title           string  `json:"title"`
+	Artist          string  `json:"artist"`
+	Album           string  `json:"album"`
+	AlbumArtist     string  `json:"album_artist"`
+	Genre           string  `json:"genre"`
+	Label           string  `json:"label"`
+	Year            int     `json:"year"`
+	TrackNumber     int     `json:"track_number"`
+	DiscNumber      int     `json:"disc_number"`
+	BPM             float64 `json:"bpm"`
+	DurationSeconds int     `json:"duration_seconds"`
+	Key             string  `json:"key"`
+	Rating          int     `json:"rating"` // 0-5 stars
+	ISRC            string  `json:"isrc"`
+	FileType        string  `json:"file_type"` // One of the FileType constants
+	Path            string  `json:"path"`      // Location of the audio file
+	FileSize        int64   `json:"file_size"`
+	Comments        string  `json:"comments"`
+	DateAdded       string  `json:"date_added"` // YYYY-MM-DD, empty when unknown
+}
+
+// File types in Track.FileType.
+const (
+	FileTypeMP3     = "mp3"
+	FileTypeM4A     = "m4a"
+	FileTypeFLAC    = "flac"
+	FileTypeWAV     = "wav"
+	FileTypeAIFF    = "aiff"
+	FileTypeUnknown = "unknown"
+)
+
+// rekordboxFileTypes maps djmdContent.FileType codes to file types.
+var rekordboxFileTypes = map[string]string{
+	"1":  FileTypeMP3,
+	"4":  FileTypeM4A,
+	"5":  FileTypeFLAC,
+	"11": FileTypeWAV,
+	"12": FileTypeAIFF,
+}
+
+// fileExtensionTypes maps file extensions to file types, for codes that
+// aren't known.
+var fileExtensionTypes = map[string]string{
+	".mp3":  FileTypeMP3,
+	".m4a":  FileTypeM4A,
+	".mp4":  FileTypeM4A,
+	".flac": FileTypeFLAC,
+	".wav":  FileTypeWAV,
+	".aif":  FileTypeAIFF,
+	".aiff": FileTypeAIFF,
+}
+
+func fileType(t rekordbox.FullTrack) string {
+	if ft, ok := rekordboxFileTypes[t.FileType]; ok {
+		return ft
+	}
+	if ft, ok := fileExtensionTypes[strings.ToLower(filepath.Ext(t.FolderPath))]; ok {
+		return ft
+	}
+	return FileTypeUnknown
+}
+
+// CSVHeader lists the CSV columns in order. Every row describes one track;
+// playlist_* columns are empty when exporting the whole collection.
+var CSVHeader = []string{
+	"playlist_id",
+	"playlist_path",
+	"position",
+	"id",
+	"title",
+	"artist",
+	"album",
+	"album_artist",
+	"genre",
+	"label",
+	"year",
+	"track_number",
+	"disc_number",
+	"bpm",
+	"duration_seconds",
+	"key",
+	"rating",
+	"isrc",
+	"file_type",
+	"path",
+	"file_size",
+	"comments",
+	"date_added",
+}
+
+// PathSeparator joins playlist path elements in the playlist_path CSV column.
+const PathSeparator = " > "
+
+// NewTrack converts a Rekordbox track.
+func NewTrack(t rekordbox.FullTrack) Track {
+	track := Track{
+		ID:              t.ID,
+		Title:           t.Title,
+		Artist:          t.Artist,
+		Album:           t.Album,
+		AlbumArtist:     t.AlbumArtist,
+		Genre:           t.Genre,
+		Label:           t.Label,
+		Year:            t.Year,
+		TrackNumber:     t.TrackNumber,
+		DiscNumber:      t.DiscNumber,
+		BPM:             t.Tempo(),
+		DurationSeconds: t.Length,
+		Key:             t.Key,
+		Rating:          t.Rating,
+		ISRC:            t.ISRC,
+		FileType:        fileType(t),
+		Path:            t.FolderPath,
+		FileSize:        t.FileSize,
+		Comments:        t.Comments,
+	}
+	if !t.DateCreated.IsZero() {
+		track.DateAdded = t.DateCreated.Format("2006-01-02")
+	}
+	return track
+}
+
+// NewTracks converts Rekordbox tracks.
+func NewTracks(tracks []rekordbox.FullTrack) []Track {
+	out := make([]Track, 0, len(tracks))
+	for _, t := range tracks {
+		out = append(out, NewTrack(t))
+	}
+	return out
+}
+
+// NewPlaylist converts a Rekordbox playlist with its tracks.
+func NewPlaylist(p *rekordbox.FullPlaylist) Playlist {
+	path := p.Path
+	if len(path) == 0 {
+		path = []string{p.Name}
+	}
+	return Playlist{
+		ID:     p.ID,
+		Name:   p.Name,
+		Path:   path,
+		Tracks: NewTracks(p.Tracks),
+	}
+}
+
+// NewDocument builds a document from playlists and collection tracks.
+// Either may be empty.
+func NewDocument(playlists []*rekordbox.FullPlaylist, tracks []rekordbox.FullTrack) *Document {
+	doc := &Document{
+		SchemaVersion: SchemaVersion,
+		ExportedAt:    time.Now().UTC(),
+		Playlists:     make([]Playlist, 0, len(playlists)),
+		Tracks:        NewTracks(tracks),
+	}
+	for _, p := range playlists {
+		doc.Playlists = append(doc.Playlists, NewPlaylist(p))
+	}
+	return doc
+}
+
+// WriteJSON writes the document as indented JSON.
+func (d *Document) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(d); err != nil {
+		return fmt.Errorf("failed to encode json: %w", err)
+	}
+	return nil
+}
+
+// WriteCSV writes the document as CSV with CSVHeader as the first row.
+func (d *Document) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(CSVHeader); err != nil {
+		return fmt.Errorf("failed to write csv header: %w", err)
+	}
+
+	for _, p := range d.Playlists {
+		for i, t := range p.Tracks {
+			if err := cw.Write(csvRow(p.ID, strings.Join(p.Path, PathSeparator), strconv.Itoa(i+1), t)); err != nil {
+				return fmt.Errorf("failed to write csv row: %w", err)
+			}
+		}
+	}
+	for _, t := range d.Tracks {
+		if err := cw.Write(csvRow("", "", "", t)); err != nil {
+			return fmt.Errorf("failed to write csv row: %w", err)
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func csvRow(playlistID, playlistPath, position string, t Track) []string {
+	return []string{
+		playlistID,
+		playlistPath,
+		position,
+		t.ID,
+		t.Title,
+		t.Artist,
+		t.Album,
+		t.AlbumArtist,
+		t.Genre,
+		t.Label,
+		strconv.Itoa(t.Year),
+		strconv.Itoa(t.TrackNumber),
+		strconv.Itoa(t.DiscNumber),
+		strconv.FormatFloat(t.BPM, 'f', 2, 64),
+		strconv.Itoa(t.DurationSeconds),
+		t.Key,
+		strconv.Itoa(t.Rating),
+		t.ISRC,
+		t.FileType,
+		t.Path,
+		strconv.FormatInt(t.FileSize, 10),
+		t.Comments,
+		t.DateAdded,
+	}
+}
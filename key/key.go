@@ -0,0 +1,255 @@
+// Package key parses and converts musical keys between the notations DJ
+// software uses, and finds the keys that mix harmonically with one another.
+//
+// Three notations are understood:
+//
+//   - Musical: "Am", "F#m", "Eb", "Bbmin", "C major"
+//   - Camelot: "8A" for A minor, "8B" for C major
+//   - Open Key: "1m" for A minor, "1d" for C major
+//
+// Camelot and Open Key both number the circle of fifths so that adjacent
+// numbers, and the two modes of a number, mix well.
+package key
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Key is a musical key.
+type Key struct {
+	tonic int // Pitch class of the root, 0 for C through 11 for B
+	minor bool
+}
+
+// Notation is a way of writing keys.
+type Notation string
+
+// Notations Key.Format writes.
+const (
+	Musical Notation = "musical"
+	Camelot Notation = "camelot"
+	OpenKey Notation = "open-key"
+)
+
+// Notations lists every Notation.
+var Notations = []Notation{Musical, Camelot, OpenKey}
+
+// ParseNotation parses the name of a Notation.
+func ParseNotation(name string) (Notation, error) {
+	for _, n := range Notations {
+		if strings.EqualFold(name, string(n)) {
+			return n, nil
+		}
+	}
+	return "", fmt.Errorf("unknown key notation %q", name)
+}
+
+var pitchClasses = map[string]int{
+	"C": 0, "B#": 0,
+	"C#": 1, "Db": 1,
+	"D":  2,
+	"D#": 3, "Eb": 3,
+	"E": 4, "Fb": 4,
+	"F": 5, "E#": 5,
+	"F#": 6, "Gb": 6,
+	"G":  7,
+	"G#": 8, "Ab": 8,
+	"A":  9,
+	"A#": 10, "Bb": 10,
+	"B": 11, "Cb": 11,
+}
+
+// Names each key is written with in musical notation, by pitch class.
+var (
+	majorNames = [12]string{"C", "Db", "D", "Eb", "E", "F", "F#", "G", "Ab", "A", "Bb", "B"}
+	minorNames = [12]string{"Cm", "C#m", "Dm", "Ebm", "Em", "Fm", "F#m", "Gm", "G#m", "Am", "Bbm", "Bm"}
+)
+
+// New returns the key with the given root pitch class, 0 for C through 11
+// for B, and mode.
+func New(tonic int, minor bool) Key {
+	return Key{tonic: ((tonic % 12) + 12) % 12, minor: minor}
+}
+
+// FromCamelot returns the key with Camelot number 1 to 12, minor for the
+// A side of the wheel.
+func FromCamelot(number int, minor bool) (Key, error) {
+	if number < 1 || number > 12 {
+		return Key{}, fmt.Errorf("camelot number %d out of range 1-12", number)
+	}
+	// 8B is C major and each step adds a fifth
+	tonic := (number - 8) * 7
+	if minor {
+		tonic -= 3 // Relative minor
+	}
+	return New(tonic, minor), nil
+}
+
+// Parse parses a key in musical, Camelot or Open Key notation.
+func Parse(s string) (Key, error) {
+	name := strings.TrimSpace(s)
+	if name == "" {
+		return Key{}, fmt.Errorf("empty key")
+	}
+
+	if k, ok := parseNumbered(name); ok {
+		return k, nil
+	}
+	if k, ok := parseMusical(name); ok {
+		return k, nil
+	}
+	return Key{}, fmt.Errorf("unknown key %q", s)
+}
+
+// parseNumbered parses Camelot ("8A") and Open Key ("1m") notation.
+func parseNumbered(name string) (Key, bool) {
+	n, err := strconv.Atoi(name[:len(name)-1])
+	if err != nil {
+		return Key{}, false
+	}
+
+	var k Key
+	switch strings.ToUpper(name[len(name)-1:]) {
+	case "A":
+		k, err = FromCamelot(n, true)
+	case "B":
+		k, err = FromCamelot(n, false)
+	case "M":
+		k, err = fromOpenKey(n, true)
+	case "D":
+		k, err = fromOpenKey(n, false)
+	default:
+		return Key{}, false
+	}
+	return k, err == nil
+}
+
+func fromOpenKey(number int, minor bool) (Key, error) {
+	if number < 1 || number > 12 {
+		return Key{}, fmt.Errorf("open key number %d out of range 1-12", number)
+	}
+	// 1d is 8B
+	return FromCamelot((number+6)%12+1, minor)
+}
+
+func parseMusical(name string) (Key, bool) {
+	root := strings.ToUpper(name[:1])
+	rest := strings.NewReplacer("♯", "#", "♭", "b").Replace(name[1:])
+	if len(rest) > 0 && (rest[0] == '#' || rest[0] == 'b') {
+		root += rest[:1]
+		rest = rest[1:]
+	}
+
+	tonic, ok := pitchClasses[root]
+	if !ok {
+		return Key{}, false
+	}
+
+	switch strings.ToLower(strings.TrimSpace(rest)) {
+	case "", "maj", "major":
+		return New(tonic, false), true
+	case "m", "min", "minor":
+		return New(tonic, true), true
+	}
+	return Key{}, false
+}
+
+// Tonic returns the pitch class of the key's root, 0 for C through 11 for B.
+func (k Key) Tonic() int {
+	return k.tonic
+}
+
+// Minor reports whether the key is minor.
+func (k Key) Minor() bool {
+	return k.minor
+}
+
+// CamelotNumber returns the key's position on the Camelot wheel, 1 to 12.
+func (k Key) CamelotNumber() int {
+	major := k.tonic
+	if k.minor {
+		major = (k.tonic + 3) % 12 // Relative major
+	}
+	// Seven semitones is a fifth, which is one step on the wheel
+	return (major*7+7)%12 + 1
+}
+
+// String returns the key in musical notation.
+func (k Key) String() string {
+	if k.minor {
+		return minorNames[k.tonic]
+	}
+	return majorNames[k.tonic]
+}
+
+// Camelot returns the key in Camelot notation.
+func (k Key) Camelot() string {
+	letter := "B"
+	if k.minor {
+		letter = "A"
+	}
+	return strconv.Itoa(k.CamelotNumber()) + letter
+}
+
+// OpenKey returns the key in Open Key notation.
+func (k Key) OpenKey() string {
+	letter := "d"
+	if k.minor {
+		letter = "m"
+	}
+	return strconv.Itoa((k.CamelotNumber()+4)%12+1) + letter
+}
+
+// Format returns the key in notation n, or musical notation for unknown
+// notations.
+func (k Key) Format(n Notation) string {
+	switch n {
+	case Camelot:
+		return k.Camelot()
+	case OpenKey:
+		return k.OpenKey()
+	}
+	return k.String()
+}
+
+// Relative returns the major or minor key with the same notes.
+func (k Key) Relative() Key {
+	if k.minor {
+		return New(k.tonic+3, false)
+	}
+	return New(k.tonic-3, true)
+}
+
+// Step returns the key n steps clockwise round the Camelot wheel, a fifth
+// up each, keeping the mode.
+func (k Key) Step(n int) Key {
+	return New(k.tonic+7*n, k.minor)
+}
+
+// Compatible returns the keys that mix harmonically with k: k itself, its
+// relative key, and its neighbors on the Camelot wheel.
+func (k Key) Compatible() []Key {
+	return []Key{k, k.Relative(), k.Step(-1), k.Step(1)}
+}
+
+// CompatibleWith reports whether other is one of k.Compatible().
+func (k Key) CompatibleWith(other Key) bool {
+	for _, c := range k.Compatible() {
+		if c == other {
+			return true
+		}
+	}
+	return false
+}
+
+// Convert rewrites a key in notation n, returning s unchanged if it isn't
+// a key.
+func Convert(s string, n Notation) string {
+	k, err := Parse(s)
+	if err != nil {
+		return s
+	}
+	return k.Format(n)
+}
@@ -0,0 +1,189 @@
+package key
+
+import "testing"
+
+// wheel is every key in musical, Camelot and Open Key notation.
+var wheel = []struct {
+	musical, camelot, openKey string
+}{
+	{"G#m", "1A", "6m"}, {"B", "1B", "6d"},
+	{"Ebm", "2A", "7m"}, {"F#", "2B", "7d"},
+	{"Bbm", "3A", "8m"}, {"Db", "3B", "8d"},
+	{"Fm", "4A", "9m"}, {"Ab", "4B", "9d"},
+	{"Cm", "5A", "10m"}, {"Eb", "5B", "10d"},
+	{"Gm", "6A", "11m"}, {"Bb", "6B", "11d"},
+	{"Dm", "7A", "12m"}, {"F", "7B", "12d"},
+	{"Am", "8A", "1m"}, {"C", "8B", "1d"},
+	{"Em", "9A", "2m"}, {"G", "9B", "2d"},
+	{"Bm", "10A", "3m"}, {"D", "10B", "3d"},
+	{"F#m", "11A", "4m"}, {"A", "11B", "4d"},
+	{"C#m", "12A", "5m"}, {"E", "12B", "5d"},
+}
+
+func TestWheel(t *testing.T) {
+	seen := make(map[Key]bool)
+	for _, w := range wheel {
+		for _, s := range []string{w.musical, w.camelot, w.openKey} {
+			k, err := Parse(s)
+			if err != nil {
+				t.Errorf("Parse(%q): %v", s, err)
+				continue
+			}
+			seen[k] = true
+			if got := k.String(); got != w.musical {
+				t.Errorf("Parse(%q).String() = %q, want %q", s, got, w.musical)
+			}
+			if got := k.Camelot(); got != w.camelot {
+				t.Errorf("Parse(%q).Camelot() = %q, want %q", s, got, w.camelot)
+			}
+			if got := k.OpenKey(); got != w.openKey {
+				t.Errorf("Parse(%q).OpenKey() = %q, want %q", s, got, w.openKey)
+			}
+		}
+	}
+	if len(seen) != 24 {
+		t.Errorf("wheel has %d distinct keys, want 24", len(seen))
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		in   string
+		n    Notation
+		want string
+	}{
+		{"Am", Camelot, "8A"},
+		{"8A", OpenKey, "1m"},
+		{"1m", Musical, "Am"},
+		{"1d", Camelot, "8B"},
+		{"12B", OpenKey, "5d"},
+		{"5d", Musical, "E"},
+		{"Abm", Camelot, "1A"},
+		{"Bbmin", Musical, "Bbm"},
+		{"C major", OpenKey, "1d"},
+		{"f♯ minor", Camelot, "11A"},
+		{"8a", Musical, "Am"},
+		{"8A", "unknown", "Am"},
+		{"not a key", Camelot, "not a key"},
+		{"", Camelot, ""},
+	}
+	for _, tt := range tests {
+		if got := Convert(tt.in, tt.n); got != tt.want {
+			t.Errorf("Convert(%q, %s) = %q, want %q", tt.in, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, s := range []string{"", " ", "H", "0A", "13A", "8C", "0m", "13d", "Cmaj7", "#m"} {
+		if k, err := Parse(s); err == nil {
+			t.Errorf("Parse(%q) = %v, want an error", s, k)
+		}
+	}
+}
+
+func TestParseNotation(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Notation
+	}{
+		{"musical", Musical},
+		{"Camelot", Camelot},
+		{"OPEN-KEY", OpenKey},
+	}
+	for _, tt := range tests {
+		if got, err := ParseNotation(tt.in); err != nil || got != tt.want {
+			t.Errorf("ParseNotation(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+	if _, err := ParseNotation("openkey"); err == nil {
+		t.Error("ParseNotation succeeded with an unknown notation")
+	}
+}
+
+func TestCompatible(t *testing.T) {
+	tests := []struct {
+		key  string
+		want []string // Itself, relative, one step down, one step up
+	}{
+		{"8A", []string{"8A", "8B", "7A", "9A"}},
+		{"8B", []string{"8B", "8A", "7B", "9B"}},
+		// The wheel wraps from 12 to 1
+		{"12A", []string{"12A", "12B", "11A", "1A"}},
+		{"1B", []string{"1B", "1A", "12B", "2B"}},
+	}
+	for _, tt := range tests {
+		k, err := Parse(tt.key)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.key, err)
+		}
+		got := k.Compatible()
+		if len(got) != len(tt.want) {
+			t.Errorf("%s.Compatible() = %v, want %v", tt.key, got, tt.want)
+			continue
+		}
+		for i, c := range got {
+			if c.Camelot() != tt.want[i] {
+				t.Errorf("%s.Compatible()[%d] = %s, want %s", tt.key, i, c.Camelot(), tt.want[i])
+			}
+		}
+	}
+}
+
+func TestCompatibleWith(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"Am", "8A", true},
+		{"Am", "C", true},
+		{"Am", "Em", true},
+		{"Am", "Dm", true},
+		{"Am", "G", false},
+		{"Am", "Bm", false},
+		{"12A", "1A", true},
+		{"1A", "12A", true},
+		{"12B", "1A", false},
+	}
+	for _, tt := range tests {
+		a, errA := Parse(tt.a)
+		b, errB := Parse(tt.b)
+		if errA != nil || errB != nil {
+			t.Fatalf("Parse(%q, %q): %v, %v", tt.a, tt.b, errA, errB)
+		}
+		if got := a.CompatibleWith(b); got != tt.want {
+			t.Errorf("%s.CompatibleWith(%s) = %t, want %t", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestStepWraps(t *testing.T) {
+	for _, w := range wheel {
+		k, _ := Parse(w.camelot)
+		if got := k.Step(12); got != k {
+			t.Errorf("%s.Step(12) = %s, want %s", w.camelot, got.Camelot(), w.camelot)
+		}
+		if got := k.Step(1).Step(-1); got != k {
+			t.Errorf("%s.Step(1).Step(-1) = %s, want %s", w.camelot, got.Camelot(), w.camelot)
+		}
+	}
+}
+
+func TestFromCamelot(t *testing.T) {
+	for _, n := range []int{0, 13, -1} {
+		if _, err := FromCamelot(n, true); err == nil {
+			t.Errorf("FromCamelot(%d) succeeded", n)
+		}
+	}
+	for n := 1; n <= 12; n++ {
+		for _, minor := range []bool{true, false} {
+			k, err := FromCamelot(n, minor)
+			if err != nil {
+				t.Fatalf("FromCamelot(%d, %t): %v", n, minor, err)
+			}
+			if k.CamelotNumber() != n || k.Minor() != minor {
+				t.Errorf("FromCamelot(%d, %t) = %s", n, minor, k.Camelot())
+			}
+		}
+	}
+}
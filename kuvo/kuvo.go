@@ -0,0 +1,318 @@
+// Package kuvo parses the tab separated playlist exports Rekordbox writes
+// with "Export a playlist to a file for KUVO (*.txt)".
+package kuvo
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+
+	"github.com/r-medina/rdbs"
+)
+
+// Column names as they appear in the export header.
+const (
+	ColumnNumber    = "#"
+	ColumnTitle     = "Track Title"
+	ColumnArtist    = "Artist"
+	ColumnAlbum     = "Album"
+	ColumnGenre     = "Genre"
+	ColumnBPM       = "BPM"
+	ColumnRating    = "Rating"
+	ColumnTime      = "Time"
+	ColumnKey       = "Key"
+	ColumnDateAdded = "Date Added"
+	ColumnLabel     = "Label"
+	ColumnISRC      = "ISRC"
+	ColumnComments  = "Comments"
+	ColumnRemixer   = "Remixer"
+	ColumnComposer  = "Composer"
+)
+
+// ErrMissingColumn is returned when a required header column is absent.
+var ErrMissingColumn = errors.New("missing required column")
+
+// Track represents a single row of a KUVO export.
+type Track struct {
+	Line      int // Line number in the export, starting at 1
+	Number    int
+	Title     string
+	Artist    string
+	Album     string
+	Genre     string
+	BPM       float64
+	Rating    int
+	Time      time.Duration
+	Key       string
+	DateAdded time.Time
+	Label     string
+	ISRC      string
+	Comments  string
+	Remixer   string
+	Composer  string
+	Extra     map[string]string // Columns without a dedicated field
+}
+
+// Track converts t into the basic track type used for Spotify syncing.
+func (t Track) Track() rdbs.Track {
+	return rdbs.Track{Artist: t.Artist, Title: t.Title}
+}
+
+// RowError describes a malformed row in an export.
+type RowError struct {
+	Line int
+	Err  error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// Export is a parsed KUVO export.
+type Export struct {
+	Columns []string
+	Tracks  []Track
+	// Problems lists rows that were malformed. Rows with unparseable
+	// values are still included in Tracks with those fields left empty;
+	// rows that could not be read at all are skipped.
+	Problems []*RowError
+}
+
+// BasicTracks returns the tracks in the export as basic tracks.
+func (e *Export) BasicTracks() []rdbs.Track {
+	tracks := make([]rdbs.Track, 0, len(e.Tracks))
+	for _, t := range e.Tracks {
+		tracks = append(tracks, t.Track())
+	}
+	return tracks
+}
+
+// ReadFile parses the export at path.
+func ReadFile(path string) (*Export, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open export %s: %w", path, err)
+	}
+	defer f.Close()
+
+	export, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse export %s: %w", path, err)
+	}
+	return export, nil
+}
+
+// Parse reads an export from r. Both the UTF-16 files Rekordbox writes and
+// UTF-8 re-saves are accepted.
+func Parse(r io.Reader) (*Export, error) {
+	br := bufio.NewReader(r)
+	decoded, err := decode(br)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(decoded)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	export := new(Export)
+	var index map[string]int
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSuffix(scanner.Text(), "\r")
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		fields := strings.Split(text, "\t")
+		if index == nil {
+			export.Columns = make([]string, len(fields))
+			index = make(map[string]int, len(fields))
+			for i, field := range fields {
+				name := strings.TrimSpace(strings.TrimPrefix(field, "\ufeff"))
+				export.Columns[i] = name
+				index[name] = i
+			}
+			for _, required := range []string{ColumnArtist, ColumnTitle} {
+				if _, ok := index[required]; !ok {
+					return nil, fmt.Errorf("%w %q in header %q", ErrMissingColumn, required, text)
+				}
+			}
+			continue
+		}
+
+		track, problems := parseRow(export.Columns, fields, line)
+		export.Problems = append(export.Problems, problems...)
+		if track != nil {
+			export.Tracks = append(export.Tracks, *track)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read export: %w", err)
+	}
+	if index == nil {
+		return nil, errors.New("export is empty")
+	}
+
+	return export, nil
+}
+
+func parseRow(columns, fields []string, line int) (*Track, []*RowError) {
+	var problems []*RowError
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, &RowError{Line: line, Err: fmt.Errorf(format, args...)})
+	}
+
+	if len(fields) != len(columns) {
+		problem("expected %d fields, got %d", len(columns), len(fields))
+	}
+
+	track := &Track{Line: line}
+	for i, name := range columns {
+		if i >= len(fields) {
+			break
+		}
+		value := strings.TrimSpace(fields[i])
+		if value == "" {
+			continue
+		}
+
+		switch name {
+		case ColumnNumber:
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				problem("invalid %s %q", name, value)
+			}
+			track.Number = n
+		case ColumnTitle:
+			track.Title = value
+		case ColumnArtist:
+			track.Artist = value
+		case ColumnAlbum:
+			track.Album = value
+		case ColumnGenre:
+			track.Genre = value
+		case ColumnBPM:
+			bpm, err := strconv.ParseFloat(strings.ReplaceAll(value, ",", "."), 64)
+			if err != nil {
+				problem("invalid %s %q", name, value)
+			}
+			track.BPM = bpm
+		case ColumnRating:
+			rating, err := parseRating(value)
+			if err != nil {
+				problem("invalid %s %q", name, value)
+			}
+			track.Rating = rating
+		case ColumnTime:
+			d, err := parseTime(value)
+			if err != nil {
+				problem("invalid %s %q", name, value)
+			}
+			track.Time = d
+		case ColumnKey:
+			track.Key = value
+		case ColumnDateAdded:
+			date, err := time.Parse("2006-01-02", value)
+			if err != nil {
+				problem("invalid %s %q", name, value)
+			}
+			track.DateAdded = date
+		case ColumnLabel:
+			track.Label = value
+		case ColumnISRC:
+			track.ISRC = value
+		case ColumnComments:
+			track.Comments = value
+		case ColumnRemixer:
+			track.Remixer = value
+		case ColumnComposer:
+			track.Composer = value
+		default:
+			if track.Extra == nil {
+				track.Extra = make(map[string]string)
+			}
+			track.Extra[name] = value
+		}
+	}
+
+	if track.Title == "" {
+		problem("missing %s", ColumnTitle)
+		return nil, problems
+	}
+
+	return track, problems
+}
+
+// parseTime parses durations formatted as m:ss or h:mm:ss.
+func parseTime(s string) (time.Duration, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+
+	var total time.Duration
+	for _, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		total = total*60 + time.Duration(n)
+	}
+	return total * time.Second, nil
+}
+
+// parseRating accepts both numeric ratings and star strings like "***".
+func parseRating(s string) (int, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		return n, nil
+	}
+
+	stars := strings.Count(s, "*") + strings.Count(s, "★")
+	if stars == 0 {
+		return 0, fmt.Errorf("invalid rating %q", s)
+	}
+	return stars, nil
+}
+
+// decode detects the export's encoding from its byte order mark, or from
+// NUL bytes for UTF-16 files without one, and returns a UTF-8 reader.
+func decode(br *bufio.Reader) (io.Reader, error) {
+	head, err := br.Peek(512)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, fmt.Errorf("failed to read export: %w", err)
+	}
+
+	switch {
+	case bytes.HasPrefix(head, []byte{0xFF, 0xFE}), bytes.HasPrefix(head, []byte{0xFE, 0xFF}):
+		dec := unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewDecoder()
+		return transform.NewReader(br, dec), nil
+	case bytes.HasPrefix(head, []byte{0xEF, 0xBB, 0xBF}):
+		br.Discard(3)
+		return br, nil
+	}
+
+	if zeros := bytes.Count(head, []byte{0}); zeros > len(head)/4 {
+		endianness := unicode.LittleEndian
+		if len(head) > 0 && head[0] == 0 {
+			endianness = unicode.BigEndian
+		}
+		dec := unicode.UTF16(endianness, unicode.IgnoreBOM).NewDecoder()
+		return transform.NewReader(br, dec), nil
+	}
+
+	return br, nil
+}
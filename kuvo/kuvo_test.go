@@ -0,0 +1,194 @@
+package kuvo
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+const export = "#\tTrack Title\tArtist\tBPM\tTime\tKey\tRating\tDate Added\tMy Tag\r\n" +
+	"1\tRain (Original Mix)\tKerri Chandler\t124.00\t6:32\tAm\t****\t2024-01-05\tWarm\r\n" +
+	"2\tJóga\tBjörk\t91,5\t1:05:00\t8A\t3\t\t\r\n"
+
+var exportTracks = []Track{
+	{
+		Line: 2, Number: 1, Title: "Rain (Original Mix)", Artist: "Kerri Chandler",
+		BPM: 124, Time: 6*time.Minute + 32*time.Second, Key: "Am", Rating: 4,
+		DateAdded: time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC),
+		Extra:     map[string]string{"My Tag": "Warm"},
+	},
+	{
+		Line: 3, Number: 2, Title: "Jóga", Artist: "Björk",
+		BPM: 91.5, Time: time.Hour + 5*time.Minute, Key: "8A", Rating: 3,
+	},
+}
+
+// encodeUTF16 encodes s as UTF-16, with a byte order mark if bom is set.
+func encodeUTF16(s string, bigEndian, bom bool) []byte {
+	units := utf16.Encode([]rune(s))
+	if bom {
+		units = append([]uint16{0xFEFF}, units...)
+	}
+	var buf bytes.Buffer
+	for _, u := range units {
+		if bigEndian {
+			buf.Write([]byte{byte(u >> 8), byte(u)})
+		} else {
+			buf.Write([]byte{byte(u), byte(u >> 8)})
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestParseEncodings(t *testing.T) {
+	tests := map[string][]byte{
+		"utf-16le with bom":    encodeUTF16(export, false, true),
+		"utf-16le without bom": encodeUTF16(export, false, false),
+		"utf-16be with bom":    encodeUTF16(export, true, true),
+		"utf-16be without bom": encodeUTF16(export, true, false),
+		"utf-8 with bom":       append([]byte("\xEF\xBB\xBF"), export...),
+		"utf-8":                []byte(export),
+		"utf-8 with lf":        []byte(strings.ReplaceAll(export, "\r\n", "\n")),
+	}
+	for name, data := range tests {
+		got, err := Parse(bytes.NewReader(data))
+		if err != nil {
+			t.Errorf("%s: Parse: %v", name, err)
+			continue
+		}
+		wantColumns := []string{"#", "Track Title", "Artist", "BPM", "Time", "Key", "Rating", "Date Added", "My Tag"}
+		if !reflect.DeepEqual(got.Columns, wantColumns) {
+			t.Errorf("%s: Columns = %q, want %q", name, got.Columns, wantColumns)
+		}
+		if !reflect.DeepEqual(got.Tracks, exportTracks) {
+			t.Errorf("%s: Tracks =\n%+v\nwant\n%+v", name, got.Tracks, exportTracks)
+		}
+		if len(got.Problems) != 0 {
+			t.Errorf("%s: Problems = %v, want none", name, got.Problems)
+		}
+	}
+}
+
+func TestParseHeader(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []Track
+		err   error // Checked with errors.Is if set
+		fails bool
+	}{
+		{
+			name:  "blank lines before the header",
+			input: "\n  \nArtist\tTrack Title\nMoodymann\tMinus\n",
+			want:  []Track{{Line: 4, Artist: "Moodymann", Title: "Minus"}},
+		},
+		{
+			name:  "header only",
+			input: "Track Title\tArtist\n",
+		},
+		{
+			name:  "missing artist column",
+			input: "#\tTrack Title\n1\tMinus\n",
+			err:   ErrMissingColumn,
+			fails: true,
+		},
+		{
+			name:  "missing title column",
+			input: "Artist\tAlbum\n",
+			err:   ErrMissingColumn,
+			fails: true,
+		},
+		{
+			name:  "empty",
+			input: "\n\n",
+			fails: true,
+		},
+	}
+	for _, tt := range tests {
+		got, err := Parse(strings.NewReader(tt.input))
+		if tt.fails {
+			if err == nil || (tt.err != nil && !errors.Is(err, tt.err)) {
+				t.Errorf("%s: err = %v, want %v", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Parse: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got.Tracks, tt.want) {
+			t.Errorf("%s: Tracks = %+v, want %+v", tt.name, got.Tracks, tt.want)
+		}
+	}
+}
+
+func TestParseProblems(t *testing.T) {
+	input := "#\tTrack Title\tArtist\tBPM\tTime\tRating\tDate Added\n" +
+		"1\tMinus\tMoodymann\tfast\t5:00\t*\t2024-01-05\n" + // Bad BPM
+		"x\tRain\tKerri Chandler\t124\t6 min\tgood\t05/01/2024\n" + // Bad number, time, rating, date
+		"3\t\tNobody\t120\t1:00\t\t\n" + // No title, skipped
+		"4\tShort Row\n" + // Too few fields
+		"5\tToo\tMany\t1\t1:00\t1\t2024-01-01\textra\n"
+
+	got, err := Parse(strings.NewReader(utf16Input(input)))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	var titles []string
+	for _, track := range got.Tracks {
+		titles = append(titles, track.Title)
+	}
+	if want := []string{"Minus", "Rain", "Short Row", "Too"}; !reflect.DeepEqual(titles, want) {
+		t.Errorf("titles = %q, want %q", titles, want)
+	}
+	if got.Tracks[0].BPM != 0 || got.Tracks[0].Time != 5*time.Minute {
+		t.Errorf("bad BPM should leave only BPM empty: %+v", got.Tracks[0])
+	}
+
+	var problems []string
+	for _, p := range got.Problems {
+		problems = append(problems, p.Error())
+	}
+	want := []string{
+		`line 2: invalid BPM "fast"`,
+		`line 3: invalid # "x"`,
+		`line 3: invalid Time "6 min"`,
+		`line 3: invalid Rating "good"`,
+		`line 3: invalid Date Added "05/01/2024"`,
+		`line 4: missing Track Title`,
+		`line 5: expected 7 fields, got 2`,
+		`line 6: expected 7 fields, got 8`,
+	}
+	if !reflect.DeepEqual(problems, want) {
+		t.Errorf("Problems =\n%s\nwant\n%s", strings.Join(problems, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// utf16Input returns s as the UTF-16LE bytes Rekordbox writes, in a string
+// for strings.NewReader.
+func utf16Input(s string) string {
+	return string(encodeUTF16(s, false, true))
+}
+
+func TestParseTime(t *testing.T) {
+	tests := map[string]time.Duration{
+		"0:00":    0,
+		"6:32":    6*time.Minute + 32*time.Second,
+		"1:05:00": time.Hour + 5*time.Minute,
+	}
+	for in, want := range tests {
+		if got, err := parseTime(in); err != nil || got != want {
+			t.Errorf("parseTime(%q) = %v, %v, want %v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "5", "1:2:3:4", "a:00", "-1:00"} {
+		if _, err := parseTime(in); err == nil {
+			t.Errorf("parseTime(%q) succeeded", in)
+		}
+	}
+}
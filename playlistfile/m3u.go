@@ -0,0 +1,82 @@
+package playlistfile
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// ParseM3U reads an M3U or M3U8 playlist. Extended M3U #EXTINF lines are
+// used for artist and title when present. Plain M3U files are often in
+// the system's legacy code page rather than UTF-8, so files that aren't
+// valid UTF-8 are decoded as Latin-1 (Windows-1252).
+func ParseM3U(r io.Reader) ([]Entry, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if !utf8.Valid(data) {
+		if data, err = charmap.Windows1252.NewDecoder().Bytes(data); err != nil {
+			return nil, err
+		}
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var entries []Entry
+	var pending *Entry
+	first := true
+	for scanner.Scan() {
+		line := scanner.Text()
+		if first {
+			line = strings.TrimPrefix(line, "\ufeff")
+			first = false
+		}
+		line = strings.TrimSpace(line)
+
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#EXTINF:"):
+			entry := parseExtInf(strings.TrimPrefix(line, "#EXTINF:"))
+			pending = &entry
+		case strings.HasPrefix(line, "#"):
+			continue
+		default:
+			entry := Entry{}
+			if pending != nil {
+				entry = *pending
+				pending = nil
+			}
+			entry.Location = line
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries, scanner.Err()
+}
+
+// parseExtInf parses the part of an #EXTINF line after the colon, e.g.
+// `123 tvg-id="x",Artist - Title`.
+func parseExtInf(s string) Entry {
+	var entry Entry
+
+	info, display, _ := strings.Cut(s, ",")
+
+	fields := strings.Fields(info)
+	if len(fields) > 0 {
+		if seconds, err := strconv.Atoi(fields[0]); err == nil && seconds > 0 {
+			entry.Duration = time.Duration(seconds) * time.Second
+		}
+	}
+
+	entry.Artist, entry.Title = splitArtistTitle(display)
+	return entry
+}
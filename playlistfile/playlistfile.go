@@ -0,0 +1,210 @@
+// Package playlistfile reads M3U, M3U8, PLS and XSPF playlists so they can
+// be used as sources for Spotify syncing.
+package playlistfile
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dhowden/tag"
+
+	"github.com/r-medina/rdbs"
+)
+
+// Entry represents a single track reference in a playlist file.
+type Entry struct {
+	Location string // File path or URL as written in the playlist
+	Artist   string
+	Title    string
+	Duration time.Duration
+}
+
+// Format identifies a playlist file format.
+type Format string
+
+const (
+	FormatM3U  Format = "m3u"
+	FormatPLS  Format = "pls"
+	FormatXSPF Format = "xspf"
+)
+
+// FormatFromPath guesses the playlist format from a file extension.
+func FormatFromPath(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".m3u", ".m3u8":
+		return FormatM3U, nil
+	case ".pls":
+		return FormatPLS, nil
+	case ".xspf":
+		return FormatXSPF, nil
+	default:
+		return "", fmt.Errorf("unsupported playlist file extension %q", filepath.Ext(path))
+	}
+}
+
+// IsSupported reports whether path has a playlist extension this package can read.
+func IsSupported(path string) bool {
+	_, err := FormatFromPath(path)
+	return err == nil
+}
+
+// Parse reads playlist entries in the given format. The returned name is
+// empty unless the format carries a playlist title.
+func Parse(r io.Reader, format Format) (name string, entries []Entry, err error) {
+	switch format {
+	case FormatM3U:
+		entries, err = ParseM3U(r)
+	case FormatPLS:
+		entries, err = ParsePLS(r)
+	case FormatXSPF:
+		return ParseXSPF(r)
+	default:
+		err = fmt.Errorf("unsupported playlist format %q", format)
+	}
+	return "", entries, err
+}
+
+// Playlist is a playlist read from a file.
+type Playlist struct {
+	rdbs.Playlist
+	// Skipped lists the entries no track could be resolved for, in the
+	// order they appear in the file.
+	Skipped []Entry
+}
+
+// ReadFile reads a playlist file and resolves every entry into a track.
+// Entries without artist or title metadata are filled in from the tags of
+// the referenced audio file, falling back to an "Artist - Title" file name.
+// Entries that can't be resolved are listed in Skipped.
+func ReadFile(path string) (*Playlist, error) {
+	format, err := FormatFromPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open playlist %s: %w", path, err)
+	}
+	defer f.Close()
+
+	name, entries, err := Parse(f, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse playlist %s: %w", path, err)
+	}
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+
+	playlist := &Playlist{Playlist: rdbs.Playlist{Name: name}}
+	baseDir := filepath.Dir(path)
+	for _, entry := range entries {
+		track, ok := ResolveTrack(entry, baseDir)
+		if !ok {
+			playlist.Skipped = append(playlist.Skipped, entry)
+			continue
+		}
+		playlist.Tracks = append(playlist.Tracks, track)
+	}
+
+	return playlist, nil
+}
+
+// ResolveTrack turns an entry into a track, reading tags from the referenced
+// file when the playlist itself does not say what the track is. Relative
+// locations are resolved against baseDir. It reports false when no title
+// could be determined.
+func ResolveTrack(entry Entry, baseDir string) (rdbs.Track, bool) {
+	track := rdbs.Track{
+		Artist: strings.TrimSpace(entry.Artist),
+		Title:  strings.TrimSpace(entry.Title),
+	}
+
+	if track.Artist == "" && track.Title != "" {
+		track.Artist, track.Title = splitArtistTitle(track.Title)
+	}
+	if track.Artist != "" && track.Title != "" {
+		return track, true
+	}
+
+	if file := LocalPath(entry.Location, baseDir); file != "" {
+		if artist, title, err := readTags(file); err == nil {
+			if track.Artist == "" {
+				track.Artist = artist
+			}
+			if track.Title == "" {
+				track.Title = title
+			}
+		}
+	}
+
+	if track.Title == "" && entry.Location != "" {
+		base := path.Base(strings.ReplaceAll(entry.Location, `\`, "/"))
+		if unescaped, err := url.PathUnescape(base); err == nil {
+			base = unescaped
+		}
+		artist, title := splitArtistTitle(strings.TrimSuffix(base, path.Ext(base)))
+		if track.Artist == "" {
+			track.Artist = artist
+		}
+		track.Title = title
+	}
+
+	return track, track.Title != ""
+}
+
+// LocalPath converts a playlist location into a local file path. It returns
+// an empty string for remote URLs.
+func LocalPath(location, baseDir string) string {
+	if location == "" {
+		return ""
+	}
+
+	// Single letter schemes are Windows drive letters, not URLs.
+	if u, err := url.Parse(location); err == nil && len(u.Scheme) > 1 {
+		if u.Scheme != "file" {
+			return ""
+		}
+		return filepath.FromSlash(u.Path)
+	}
+
+	file := filepath.FromSlash(strings.ReplaceAll(location, `\`, "/"))
+	if !filepath.IsAbs(file) && baseDir != "" {
+		file = filepath.Join(baseDir, file)
+	}
+	return file
+}
+
+func readTags(file string) (artist, title string, err error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+
+	m, err := tag.ReadFrom(f)
+	if err != nil {
+		return "", "", err
+	}
+
+	artist = strings.TrimSpace(m.Artist())
+	if artist == "" {
+		artist = strings.TrimSpace(m.AlbumArtist())
+	}
+	return artist, strings.TrimSpace(m.Title()), nil
+}
+
+// splitArtistTitle splits "Artist - Title" display strings. Strings without
+// a separator are treated as a bare title.
+func splitArtistTitle(s string) (artist, title string) {
+	if i := strings.Index(s, " - "); i > 0 {
+		return strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+3:])
+	}
+	return "", strings.TrimSpace(s)
+}
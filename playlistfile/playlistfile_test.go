@@ -0,0 +1,190 @@
+package playlistfile
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/r-medina/rdbs"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		input  string
+		title  string // Playlist name
+		want   []Entry
+		err    bool
+	}{
+		{
+			name:   "extended m3u",
+			format: FormatM3U,
+			input:  "#EXTM3U\n#EXTINF:392,Kerri Chandler - Rain\n/music/rain.mp3\n",
+			want: []Entry{
+				{Location: "/music/rain.mp3", Artist: "Kerri Chandler", Title: "Rain", Duration: 392 * time.Second},
+			},
+		},
+		{
+			name:   "plain m3u with bom, comments and crlf",
+			format: FormatM3U,
+			input:  "\ufeff/music/a.mp3\r\n# a comment\r\n\r\nb.mp3\r\n",
+			want:   []Entry{{Location: "/music/a.mp3"}, {Location: "b.mp3"}},
+		},
+		{
+			name:   "extinf attributes and unknown length",
+			format: FormatM3U,
+			input:  "#EXTINF:-1 tvg-id=\"x\",Title Only\nhttp://radio.example/stream\n",
+			want:   []Entry{{Location: "http://radio.example/stream", Title: "Title Only"}},
+		},
+		{
+			name:   "utf-8 m3u8",
+			format: FormatM3U,
+			input:  "#EXTINF:1,Björk - Jóga\n/music/jóga.flac\n",
+			want:   []Entry{{Location: "/music/jóga.flac", Artist: "Björk", Title: "Jóga", Duration: time.Second}},
+		},
+		{
+			name:   "latin-1 m3u",
+			format: FormatM3U,
+			input:  "#EXTINF:1,Bj\xf6rk - J\xf3ga\n/music/j\xf3ga.flac\n",
+			want:   []Entry{{Location: "/music/jóga.flac", Artist: "Björk", Title: "Jóga", Duration: time.Second}},
+		},
+		{
+			name:   "pls",
+			format: FormatPLS,
+			input: "[playlist]\nFile10=/music/c.mp3\nFile1=/music/a.mp3\nTitle1=A - B\nLength1=60\n" +
+				"; comment\nTitle2=Only Title\nNumberOfEntries=3\nVersion=2\n",
+			want: []Entry{
+				{Location: "/music/a.mp3", Artist: "A", Title: "B", Duration: time.Minute},
+				{Title: "Only Title"},
+				{Location: "/music/c.mp3"},
+			},
+		},
+		{
+			name:   "malformed pls",
+			format: FormatPLS,
+			input:  "[playlist]\nnot a key\n",
+			err:    true,
+		},
+		{
+			name:   "xspf",
+			format: FormatXSPF,
+			input: `<?xml version="1.0" encoding="UTF-8"?>
+<playlist version="1" xmlns="http://xspf.org/ns/0/">
+  <title> Late Night </title>
+  <trackList>
+    <track>
+      <location>file:///music/rain.mp3</location>
+      <location>http://mirror/rain.mp3</location>
+      <creator>Kerri Chandler</creator>
+      <title>Rain</title>
+      <duration>392000</duration>
+    </track>
+    <track><title>No Location</title></track>
+  </trackList>
+</playlist>`,
+			title: "Late Night",
+			want: []Entry{
+				{Location: "file:///music/rain.mp3", Artist: "Kerri Chandler", Title: "Rain", Duration: 392 * time.Second},
+				{Title: "No Location"},
+			},
+		},
+		{
+			name:   "invalid xspf",
+			format: FormatXSPF,
+			input:  "<playlist><trackList>",
+			err:    true,
+		},
+	}
+	for _, tt := range tests {
+		title, entries, err := Parse(strings.NewReader(tt.input), tt.format)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: Parse succeeded, want an error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Parse: %v", tt.name, err)
+			continue
+		}
+		if title != tt.title {
+			t.Errorf("%s: name = %q, want %q", tt.name, title, tt.title)
+		}
+		if !reflect.DeepEqual(entries, tt.want) {
+			t.Errorf("%s: entries =\n%+v\nwant\n%+v", tt.name, entries, tt.want)
+		}
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "Warm Up.xspf")
+	err := os.WriteFile(path, []byte(`<playlist version="1" xmlns="http://xspf.org/ns/0/">
+  <trackList>
+    <track><creator>Kerri Chandler</creator><title>Rain</title></track>
+    <track><title>Moodymann - Shades of Jae</title></track>
+    <track><location>Music/Robert%20Hood%20-%20Minus.mp3</location></track>
+    <track><duration>1000</duration></track>
+  </trackList>
+</playlist>`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	playlist, err := ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if playlist.Name != "Warm Up" {
+		t.Errorf("Name = %q, want the file name", playlist.Name)
+	}
+	want := []rdbs.Track{
+		{Artist: "Kerri Chandler", Title: "Rain"},
+		{Artist: "Moodymann", Title: "Shades of Jae"},
+		{Artist: "Robert Hood", Title: "Minus"},
+	}
+	if !reflect.DeepEqual(playlist.Tracks, want) {
+		t.Errorf("Tracks = %+v, want %+v", playlist.Tracks, want)
+	}
+	if wantSkipped := []Entry{{Duration: time.Second}}; !reflect.DeepEqual(playlist.Skipped, wantSkipped) {
+		t.Errorf("Skipped = %+v, want %+v", playlist.Skipped, wantSkipped)
+	}
+}
+
+func TestFormatFromPath(t *testing.T) {
+	tests := map[string]Format{
+		"a.m3u":  FormatM3U,
+		"a.M3U8": FormatM3U,
+		"a.pls":  FormatPLS,
+		"a.xspf": FormatXSPF,
+		"a.txt":  "",
+	}
+	for path, want := range tests {
+		got, err := FormatFromPath(path)
+		if got != want || (err != nil) != (want == "") {
+			t.Errorf("FormatFromPath(%q) = %q, %v, want %q", path, got, err, want)
+		}
+	}
+}
+
+func TestLocalPath(t *testing.T) {
+	base := filepath.FromSlash("/playlists")
+	tests := []struct {
+		location, want string
+	}{
+		{"", ""},
+		{"http://radio.example/stream", ""},
+		{"file:///music/a.mp3", filepath.FromSlash("/music/a.mp3")},
+		{"/music/a.mp3", filepath.FromSlash("/music/a.mp3")},
+		{`Music\a.mp3`, filepath.Join(base, "Music", "a.mp3")},
+	}
+	for _, tt := range tests {
+		if got := LocalPath(tt.location, base); got != tt.want {
+			t.Errorf("LocalPath(%q) = %q, want %q", tt.location, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package playlistfile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParsePLS reads a PLS playlist. TitleN keys are used for artist and title
+// when present. Entries are ordered by their number, and entries without
+// a FileN key are kept so callers can report them.
+func ParsePLS(r io.Reader) ([]Entry, error) {
+	scanner := bufio.NewScanner(r)
+
+	byIndex := make(map[int]*Entry)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if lineNo == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		if line == "" || strings.HasPrefix(line, "[") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			return nil, fmt.Errorf("line %d: expected key=value, got %q", lineNo, line)
+		}
+
+		field, index, ok := splitPLSKey(key)
+		if !ok {
+			continue // NumberOfEntries, Version, etc.
+		}
+
+		entry, exists := byIndex[index]
+		if !exists {
+			entry = &Entry{}
+			byIndex[index] = entry
+		}
+
+		switch field {
+		case "file":
+			entry.Location = value
+		case "title":
+			entry.Artist, entry.Title = splitArtistTitle(value)
+		case "length":
+			if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+				entry.Duration = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	indexes := make([]int, 0, len(byIndex))
+	for i := range byIndex {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	entries := make([]Entry, 0, len(indexes))
+	for _, i := range indexes {
+		entries = append(entries, *byIndex[i])
+	}
+
+	return entries, nil
+}
+
+// splitPLSKey splits keys like "File12" into ("file", 12).
+func splitPLSKey(key string) (string, int, bool) {
+	key = strings.ToLower(strings.TrimSpace(key))
+	for _, field := range []string{"file", "title", "length"} {
+		if !strings.HasPrefix(key, field) {
+			continue
+		}
+		index, err := strconv.Atoi(key[len(field):])
+		if err != nil {
+			return "", 0, false
+		}
+		return field, index, true
+	}
+	return "", 0, false
+}
@@ -0,0 +1,44 @@
+package playlistfile
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+	"time"
+)
+
+type xspfPlaylist struct {
+	XMLName xml.Name    `xml:"playlist"`
+	Title   string      `xml:"title"`
+	Tracks  []xspfTrack `xml:"trackList>track"`
+}
+
+type xspfTrack struct {
+	Locations []string `xml:"location"`
+	Creator   string   `xml:"creator"`
+	Title     string   `xml:"title"`
+	Duration  int64    `xml:"duration"` // In milliseconds
+}
+
+// ParseXSPF reads an XSPF playlist and returns its title and entries.
+func ParseXSPF(r io.Reader) (string, []Entry, error) {
+	var playlist xspfPlaylist
+	if err := xml.NewDecoder(r).Decode(&playlist); err != nil {
+		return "", nil, err
+	}
+
+	entries := make([]Entry, 0, len(playlist.Tracks))
+	for _, t := range playlist.Tracks {
+		entry := Entry{
+			Artist:   strings.TrimSpace(t.Creator),
+			Title:    strings.TrimSpace(t.Title),
+			Duration: time.Duration(t.Duration) * time.Millisecond,
+		}
+		if len(t.Locations) > 0 {
+			entry.Location = strings.TrimSpace(t.Locations[0])
+		}
+		entries = append(entries, entry)
+	}
+
+	return strings.TrimSpace(playlist.Title), entries, nil
+}
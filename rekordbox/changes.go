@@ -0,0 +1,491 @@
+package rekordbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Version identifies the state of a set of rows. Rekordbox bumps
+// rb_local_usn and updated_at whenever it writes a row, and deleting a row
+// changes Count, so two equal Versions mean nothing changed in between.
+type Version struct {
+	USN       int64  // Highest rb_local_usn
+	UpdatedAt string // Latest updated_at
+	Count     int    // Number of live rows
+}
+
+// GetPlaylistVersions calls GetPlaylistVersionsContext with context.Background().
+func (db *DB) GetPlaylistVersions() (map[string]Version, error) {
+	return db.GetPlaylistVersionsContext(context.Background())
+}
+
+// GetPlaylistVersionsContext returns the version of every playlist,
+// covering the playlist row and its track memberships. Edits to the tracks
+// themselves aren't covered, so playing a track doesn't change the
+// versions of the playlists it is in. Smart playlists have no memberships.
+func (db *DB) GetPlaylistVersionsContext(ctx context.Context) (map[string]Version, error) {
+	p := db.schema.table("djmdPlaylist", "p")
+	sp := db.schema.table("djmdSongPlaylist", "sp")
+	query := `
+		SELECT
+			p.ID,
+			MAX(
+				COALESCE(` + p.USN + `, 0),
+				COALESCE(MAX(` + sp.USN + `), 0)
+			) AS USN,
+			MAX(
+				COALESCE(` + p.UpdatedAt + `, ''),
+				COALESCE(MAX(` + sp.UpdatedAt + `), '')
+			) AS UpdatedAt,
+			COUNT(sp.ID) AS Count
+		FROM djmdPlaylist p
+		LEFT JOIN djmdSongPlaylist sp ON sp.PlaylistID = p.ID AND ` + sp.Live + `
+		WHERE ` + p.Live + `
+		GROUP BY p.ID`
+
+	versions, err := db.queryVersions(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get playlist versions: %w", err)
+	}
+	return versions, nil
+}
+
+// GetMyTagVersions calls GetMyTagVersionsContext with context.Background().
+func (db *DB) GetMyTagVersions() (map[string]Version, error) {
+	return db.GetMyTagVersionsContext(context.Background())
+}
+
+// GetMyTagVersionsContext returns the version of every My Tag, covering its
+// row and track assignments but not the tracks themselves.
+func (db *DB) GetMyTagVersionsContext(ctx context.Context) (map[string]Version, error) {
+	t := db.schema.table("djmdMyTag", "t")
+	st := db.schema.table("djmdSongMyTag", "st")
+	query := `
+		SELECT
+			t.ID,
+			MAX(
+				COALESCE(` + t.USN + `, 0),
+				COALESCE(MAX(` + st.USN + `), 0)
+			) AS USN,
+			MAX(
+				COALESCE(` + t.UpdatedAt + `, ''),
+				COALESCE(MAX(` + st.UpdatedAt + `), '')
+			) AS UpdatedAt,
+			COUNT(st.ID) AS Count
+		FROM djmdMyTag t
+		LEFT JOIN djmdSongMyTag st ON st.MyTagID = t.ID AND ` + st.Live + `
+		WHERE ` + t.Live + `
+		GROUP BY t.ID`
+
+	versions, err := db.queryVersions(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get my tag versions: %w", err)
+	}
+	return versions, nil
+}
+
+func (db *DB) queryVersions(ctx context.Context, query string) (map[string]Version, error) {
+	rows, err := db.query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make(map[string]Version)
+	for rows.Next() {
+		var id string
+		var v Version
+		if err := rows.Scan(&id, &v.USN, &v.UpdatedAt, &v.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan version row: %w", err)
+		}
+		versions[id] = v
+	}
+
+	return versions, rows.Err()
+}
+
+// ChangeKind says how a row changed.
+type ChangeKind string
+
+// Change kinds.
+const (
+	Added    ChangeKind = "added"
+	Modified ChangeKind = "modified"
+	Deleted  ChangeKind = "deleted"
+)
+
+// changeKind classifies a row written after mark. Rows created after the
+// mark was taken are added, older ones modified.
+func changeKind(mark Mark, deleted bool, createdAt string) ChangeKind {
+	switch {
+	case deleted:
+		return Deleted
+	case mark.UpdatedAt == "" || createdAt > mark.UpdatedAt:
+		return Added
+	default:
+		return Modified
+	}
+}
+
+// TrackChange is a changed row of djmdContent.
+type TrackChange struct {
+	Kind  ChangeKind
+	USN   int64
+	Track FullTrack
+}
+
+// PlaylistChange is a changed row of djmdPlaylist.
+type PlaylistChange struct {
+	Kind      ChangeKind
+	USN       int64
+	ID        string
+	Name      string
+	ParentID  string
+	Attribute int
+}
+
+// MembershipChange is a changed row of djmdSongPlaylist, a track being
+// added to, moved in or removed from a playlist. Rows Rekordbox removed
+// outright have no USN or TrackNo.
+type MembershipChange struct {
+	Kind       ChangeKind
+	USN        int64
+	ID         string
+	PlaylistID string
+	ContentID  string
+	TrackNo    int
+}
+
+// Changes lists the rows written after a mark, ordered by USN.
+type Changes struct {
+	Since       Mark  // Mark the changes are relative to
+	USN         int64 // Current USN, the high-water mark for the next call
+	UpdatedAt   string
+	Tracks      []TrackChange
+	Playlists   []PlaylistChange
+	Memberships []MembershipChange
+
+	memberships map[string]Membership
+}
+
+// Empty reports whether nothing changed.
+func (c *Changes) Empty() bool {
+	return len(c.Tracks) == 0 && len(c.Playlists) == 0 && len(c.Memberships) == 0
+}
+
+// Mark returns the high-water mark to pass to the next ChangesSince call.
+func (c *Changes) Mark() Mark {
+	return Mark{USN: c.USN, UpdatedAt: c.UpdatedAt, Memberships: c.memberships}
+}
+
+// CurrentUSN calls CurrentUSNContext with context.Background().
+func (db *DB) CurrentUSN() (int64, error) {
+	return db.CurrentUSNContext(context.Background())
+}
+
+// usnTables are the tables whose rb_local_usn CurrentUSN covers: the ones
+// ChangesSince and the version queries read.
+var usnTables = []string{"djmdContent", "djmdPlaylist", "djmdSongPlaylist", "djmdMyTag", "djmdSongMyTag"}
+
+// CurrentUSNContext returns the highest update sequence number in the
+// database. Rekordbox keeps it in agentRegistry where the schema has it;
+// the highest rb_local_usn of usnTables is used if that is behind or
+// missing.
+func (db *DB) CurrentUSNContext(ctx context.Context) (int64, error) {
+	usns := []string{"0"}
+	if db.schema.HasColumn("agentRegistry", "registry_id") && db.schema.HasColumn("agentRegistry", "int_1") {
+		usns = append(usns, `COALESCE((SELECT int_1 FROM agentRegistry WHERE registry_id = 'localUpdateCount'), 0)`)
+	}
+	for _, table := range usnTables {
+		if db.schema.HasColumn(table, "rb_local_usn") {
+			usns = append(usns, fmt.Sprintf("COALESCE((SELECT MAX(rb_local_usn) FROM %s), 0)", table))
+		}
+	}
+	// MAX with one argument is the aggregate, which works too
+	query := "SELECT MAX(" + strings.Join(usns, ", ") + ")"
+
+	var usn int64
+	if err := db.queryRow(ctx, query).Scan(&usn); err != nil {
+		return 0, fmt.Errorf("failed to get current usn: %w", err)
+	}
+	return usn, nil
+}
+
+// ChangesSince calls ChangesSinceContext with context.Background().
+func (db *DB) ChangesSince(mark Mark) (*Changes, error) {
+	return db.ChangesSinceContext(context.Background(), mark)
+}
+
+// ChangesSinceContext returns the tracks, playlists and playlist
+// memberships written after mark. Pass the zero Mark to get everything.
+// Memberships Rekordbox removed outright rather than marking deleted are
+// found by comparing against the memberships saved in mark. Schemas
+// without rb_local_usn columns report no other changes.
+func (db *DB) ChangesSinceContext(ctx context.Context, mark Mark) (*Changes, error) {
+	current, err := db.CurrentUSNContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	changes := &Changes{Since: mark, USN: current}
+
+	c := db.schema.table("djmdContent", "")
+	p := db.schema.table("djmdPlaylist", "")
+	sp := db.schema.table("djmdSongPlaylist", "")
+	query := `
+		SELECT MAX(
+			COALESCE((SELECT MAX(` + c.UpdatedAt + `) FROM djmdContent), ''),
+			COALESCE((SELECT MAX(` + p.UpdatedAt + `) FROM djmdPlaylist), ''),
+			COALESCE((SELECT MAX(` + sp.UpdatedAt + `) FROM djmdSongPlaylist), '')
+		)`
+	if err := db.queryRow(ctx, query).Scan(&changes.UpdatedAt); err != nil {
+		return nil, fmt.Errorf("failed to get latest update time: %w", err)
+	}
+
+	if changes.Tracks, err = db.trackChangesSince(ctx, mark); err != nil {
+		return nil, err
+	}
+	if changes.Playlists, err = db.playlistChangesSince(ctx, mark); err != nil {
+		return nil, err
+	}
+	if changes.Memberships, err = db.membershipChangesSince(ctx, mark); err != nil {
+		return nil, err
+	}
+	if changes.memberships, err = db.memberships(ctx); err != nil {
+		return nil, err
+	}
+	changes.Memberships = append(changes.Memberships, removedMemberships(mark, changes)...)
+
+	return changes, nil
+}
+
+// removedMemberships returns the memberships in mark that are gone from
+// the database without having been marked deleted.
+func removedMemberships(mark Mark, changes *Changes) []MembershipChange {
+	reported := make(map[string]bool)
+	for _, change := range changes.Memberships {
+		reported[change.ID] = true
+	}
+
+	ids := make([]string, 0, len(mark.Memberships))
+	for id := range mark.Memberships {
+		if _, ok := changes.memberships[id]; !ok && !reported[id] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	removed := make([]MembershipChange, len(ids))
+	for i, id := range ids {
+		m := mark.Memberships[id]
+		removed[i] = MembershipChange{
+			Kind:       Deleted,
+			ID:         id,
+			PlaylistID: m.PlaylistID,
+			ContentID:  m.ContentID,
+		}
+	}
+	return removed
+}
+
+// memberships returns every live row of djmdSongPlaylist by ID.
+func (db *DB) memberships(ctx context.Context) (map[string]Membership, error) {
+	sp := db.schema.table("djmdSongPlaylist", "")
+	query := `
+		SELECT ID, COALESCE(PlaylistID, ''), COALESCE(ContentID, '')
+		FROM djmdSongPlaylist
+		WHERE ` + sp.Live
+
+	rows, err := db.query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get playlist memberships: %w", err)
+	}
+	defer rows.Close()
+
+	memberships := make(map[string]Membership)
+	for rows.Next() {
+		var id string
+		var m Membership
+		if err := rows.Scan(&id, &m.PlaylistID, &m.ContentID); err != nil {
+			return nil, fmt.Errorf("failed to scan playlist membership: %w", err)
+		}
+		memberships[id] = m
+	}
+
+	return memberships, rows.Err()
+}
+
+func (db *DB) trackChangesSince(ctx context.Context, mark Mark) ([]TrackChange, error) {
+	c := db.schema.table("djmdContent", "c")
+	query := `
+		SELECT` + db.fullTrackColumns() + `,
+			COALESCE(` + c.USN + `, 0),
+			COALESCE(` + c.Deleted + `, 0),
+			COALESCE(` + c.CreatedAt + `, '')
+		FROM djmdContent c` + fullTrackJoins + `
+		WHERE ` + c.USN + ` > ?
+		ORDER BY COALESCE(` + c.USN + `, 0), c.ID`
+
+	rows, err := db.query(ctx, query, mark.USN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get track changes: %w", err)
+	}
+	defer rows.Close()
+
+	var changes []TrackChange
+	for rows.Next() {
+		var change TrackChange
+		var deleted bool
+		var createdAt string
+		change.Track, err = scanFullTrack(rows, &change.USN, &deleted, &createdAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan track change: %w", err)
+		}
+		change.Kind = changeKind(mark, deleted, createdAt)
+		changes = append(changes, change)
+	}
+
+	return changes, rows.Err()
+}
+
+func (db *DB) playlistChangesSince(ctx context.Context, mark Mark) ([]PlaylistChange, error) {
+	p := db.schema.table("djmdPlaylist", "")
+	query := `
+		SELECT
+			ID,
+			COALESCE(Name, ''),
+			COALESCE(ParentID, ''),
+			COALESCE(Attribute, 0),
+			COALESCE(` + p.USN + `, 0),
+			COALESCE(` + p.Deleted + `, 0),
+			COALESCE(` + p.CreatedAt + `, '')
+		FROM djmdPlaylist
+		WHERE ` + p.USN + ` > ?
+		ORDER BY COALESCE(` + p.USN + `, 0), ID`
+
+	rows, err := db.query(ctx, query, mark.USN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get playlist changes: %w", err)
+	}
+	defer rows.Close()
+
+	var changes []PlaylistChange
+	for rows.Next() {
+		var change PlaylistChange
+		var deleted bool
+		var createdAt string
+		err := rows.Scan(&change.ID, &change.Name, &change.ParentID, &change.Attribute,
+			&change.USN, &deleted, &createdAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan playlist change: %w", err)
+		}
+		change.Kind = changeKind(mark, deleted, createdAt)
+		changes = append(changes, change)
+	}
+
+	return changes, rows.Err()
+}
+
+func (db *DB) membershipChangesSince(ctx context.Context, mark Mark) ([]MembershipChange, error) {
+	sp := db.schema.table("djmdSongPlaylist", "")
+	query := `
+		SELECT
+			ID,
+			COALESCE(PlaylistID, ''),
+			COALESCE(ContentID, ''),
+			COALESCE(TrackNo, 0),
+			COALESCE(` + sp.USN + `, 0),
+			COALESCE(` + sp.Deleted + `, 0),
+			COALESCE(` + sp.CreatedAt + `, '')
+		FROM djmdSongPlaylist
+		WHERE ` + sp.USN + ` > ?
+		ORDER BY COALESCE(` + sp.USN + `, 0), ID`
+
+	rows, err := db.query(ctx, query, mark.USN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get playlist membership changes: %w", err)
+	}
+	defer rows.Close()
+
+	var changes []MembershipChange
+	for rows.Next() {
+		var change MembershipChange
+		var deleted bool
+		var createdAt string
+		err := rows.Scan(&change.ID, &change.PlaylistID, &change.ContentID, &change.TrackNo,
+			&change.USN, &deleted, &createdAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan playlist membership change: %w", err)
+		}
+		change.Kind = changeKind(mark, deleted, createdAt)
+		changes = append(changes, change)
+	}
+
+	return changes, rows.Err()
+}
+
+// Mark is a persisted high-water mark for ChangesSince.
+type Mark struct {
+	USN int64 `json:"usn"`
+	// UpdatedAt is the latest updated_at in the database, in Rekordbox's
+	// own format, so rows created later can be told from modified ones.
+	UpdatedAt string `json:"updated_at"`
+	// Memberships are the playlist memberships at the mark, by ID.
+	Memberships map[string]Membership `json:"memberships,omitempty"`
+}
+
+// Membership is a track's entry in a playlist.
+type Membership struct {
+	PlaylistID string `json:"playlist_id"`
+	ContentID  string `json:"content_id"`
+}
+
+// LoadMark reads a mark saved with Save. A missing file is the zero Mark,
+// which makes ChangesSince return everything.
+func LoadMark(path string) (Mark, error) {
+	var mark Mark
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return mark, nil
+	}
+	if err != nil {
+		return mark, fmt.Errorf("failed to read mark: %w", err)
+	}
+	if err := json.Unmarshal(data, &mark); err != nil {
+		return mark, fmt.Errorf("failed to parse mark %s: %w", path, err)
+	}
+	return mark, nil
+}
+
+// Save writes the mark to path. The file is replaced atomically so a
+// crash never leaves a truncated mark behind.
+func (m Mark) Save(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode mark: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to save mark: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save mark: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save mark: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to save mark: %w", err)
+	}
+	return nil
+}
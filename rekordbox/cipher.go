@@ -0,0 +1,184 @@
+package rekordbox
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	sqlite3 "github.com/mutecomm/go-sqlcipher/v4"
+)
+
+// DBKeyEnv is the environment variable that sets the database key when no
+// key option is given to New.
+const DBKeyEnv = "REKORDBOX_DB_KEY"
+
+// sqliteHeader starts every unencrypted SQLite database.
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+// Cipher is a way of decrypting the database: a SQLCipher passphrase and
+// the SQLCipher major version whose defaults it was written with.
+type Cipher struct {
+	Name          string
+	Key           string
+	Compatibility int
+}
+
+func (c Cipher) String() string {
+	if c.Key == "" {
+		return c.Name
+	}
+	return fmt.Sprintf("%s (SQLCipher %d)", c.Name, c.Compatibility)
+}
+
+// Unencrypted is reported by DB.Cipher for plain SQLite copies of the
+// database, such as ones decrypted by other tools.
+var Unencrypted = Cipher{Name: "unencrypted"}
+
+// KnownCiphers are tried in order when New isn't given a key. Every
+// Rekordbox 6 and 7 release so far uses the same key with SQLCipher 4
+// defaults; a release that changes it needs WithKey or $REKORDBOX_DB_KEY
+// until it is added here.
+var KnownCiphers = []Cipher{
+	{Name: "rekordbox 6/7", Key: DBKey, Compatibility: 4},
+}
+
+// WithKey makes New decrypt the database with key instead of the known
+// Rekordbox keys, for releases that changed it.
+func WithKey(key string) Option {
+	return func(db *DB) {
+		db.ciphers = keyCiphers(key)
+	}
+}
+
+// WithCipher makes New try only the given ciphers, in order.
+func WithCipher(ciphers ...Cipher) Option {
+	return func(db *DB) {
+		db.ciphers = ciphers
+	}
+}
+
+// keyCiphers tries a given key with both SQLCipher 4 and 3 defaults, as
+// it may come from a tool that wrote the database with either.
+func keyCiphers(key string) []Cipher {
+	return []Cipher{
+		{Name: "custom key", Key: key, Compatibility: 4},
+		{Name: "custom key", Key: key, Compatibility: 3},
+	}
+}
+
+// DecryptError is returned by New when none of the ciphers tried could
+// read the database. Other failures to open it, like missing permissions,
+// are returned as they are.
+type DecryptError struct {
+	Path  string
+	Tried []Cipher
+	Err   error // Error from the last cipher tried
+}
+
+func (e *DecryptError) Error() string {
+	tried := make([]string, len(e.Tried))
+	for i, c := range e.Tried {
+		tried[i] = c.String()
+	}
+	return fmt.Sprintf("cannot decrypt %s (tried %s; set %s or pass a key if your Rekordbox version uses a new one): %v",
+		e.Path, strings.Join(tried, ", "), DBKeyEnv, e.Err)
+}
+
+func (e *DecryptError) Unwrap() error {
+	return e.Err
+}
+
+// Cipher returns how the database was decrypted.
+func (db *DB) Cipher() Cipher {
+	return db.cipher
+}
+
+// open opens file, detecting unencrypted copies and otherwise trying each
+// of ciphers until one can read the schema.
+func open(file string, ciphers []Cipher) (*sql.DB, Cipher, error) {
+	plain, err := isUnencrypted(file)
+	if err != nil {
+		return nil, Cipher{}, err
+	}
+	if plain {
+		sqlDB, err := openCipher(file, Unencrypted)
+		if err != nil {
+			return nil, Cipher{}, err
+		}
+		return sqlDB, Unencrypted, nil
+	}
+
+	decryptErr := &DecryptError{Path: file}
+	for _, c := range ciphers {
+		decryptErr.Tried = append(decryptErr.Tried, c)
+		sqlDB, err := openCipher(file, c)
+		if isNotADB(err) {
+			decryptErr.Err = err
+			continue
+		}
+		if err != nil {
+			return nil, Cipher{}, err
+		}
+		return sqlDB, c, nil
+	}
+	if decryptErr.Err == nil {
+		decryptErr.Err = fmt.Errorf("no ciphers to try")
+	}
+	return nil, Cipher{}, decryptErr
+}
+
+// openCipher opens file read-only with c and checks it can be read; the
+// driver only fails on a wrong key once the database is queried.
+func openCipher(file string, c Cipher) (*sql.DB, error) {
+	dsn := fmt.Sprintf("file:%s?mode=ro", file)
+	if c.Key != "" {
+		dsn = fmt.Sprintf(
+			"file:%s?_pragma_key=%s&_pragma_cipher_compatibility=%d&mode=ro",
+			file,
+			url.QueryEscape(c.Key),
+			c.Compatibility,
+		)
+	}
+
+	sqlDB, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	var n int
+	if err := sqlDB.QueryRow("SELECT count(*) FROM sqlite_master").Scan(&n); err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+	return sqlDB, nil
+}
+
+// isNotADB reports whether err is SQLite failing to recognize the file,
+// which is how SQLCipher reports a wrong key.
+func isNotADB(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrNotADB
+	}
+	return err != nil && strings.Contains(err.Error(), "file is not a database")
+}
+
+// isUnencrypted reports whether file starts with the plain SQLite header.
+func isUnencrypted(file string) (bool, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return false, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer f.Close()
+
+	header := make([]byte, len(sqliteHeader))
+	if _, err := io.ReadFull(f, header); err != nil {
+		return false, fmt.Errorf("failed to read database header: %w", err)
+	}
+	return bytes.Equal(header, sqliteHeader), nil
+}
@@ -0,0 +1,141 @@
+package rekordbox
+
+import (
+	"context"
+	"fmt"
+)
+
+// Cue represents a memory cue, hot cue or loop from djmdCue.
+type Cue struct {
+	ID        string
+	ContentID string
+	Kind      int // 0 for memory cues, otherwise the hot cue slot
+	InMsec    int
+	OutMsec   int // -1 unless the cue is a loop
+	Color     int
+	Comment   string
+}
+
+// IsHotCue reports whether c is a hot cue rather than a memory cue.
+func (c Cue) IsHotCue() bool {
+	return c.Kind > 0
+}
+
+// HotCueIndex returns the zero based hot cue slot (A is 0), or -1 for
+// memory cues. Rekordbox skips kind 4 when numbering slots.
+func (c Cue) HotCueIndex() int {
+	switch {
+	case c.Kind <= 0:
+		return -1
+	case c.Kind < 4:
+		return c.Kind - 1
+	default:
+		return c.Kind - 2
+	}
+}
+
+// IsLoop reports whether c marks a loop.
+func (c Cue) IsLoop() bool {
+	return c.OutMsec > c.InMsec
+}
+
+// GetTrackCues calls GetTrackCuesContext with context.Background().
+func (db *DB) GetTrackCues(contentID string) ([]Cue, error) {
+	return db.GetTrackCuesContext(context.Background(), contentID)
+}
+
+// GetTrackCuesContext retrieves the cue points of a track ordered by position.
+func (db *DB) GetTrackCuesContext(ctx context.Context, contentID string) ([]Cue, error) {
+	cueTable := db.schema.table("djmdCue", "cue")
+	query := `
+		SELECT
+			cue.ID,
+			cue.ContentID,
+			cue.Kind,
+			cue.InMsec,
+			COALESCE(cue.OutMsec, -1) AS OutMsec,
+			COALESCE(cue.Color, -1) AS Color,
+			COALESCE(cue.Comment, '') AS Comment
+		FROM djmdCue cue
+		WHERE cue.ContentID = ? AND ` + cueTable.Live + `
+		ORDER BY cue.InMsec`
+
+	rows, err := db.query(ctx, query, contentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cues for track %s: %w", contentID, err)
+	}
+	defer rows.Close()
+
+	var cues []Cue
+	for rows.Next() {
+		var cue Cue
+		if err := rows.Scan(&cue.ID, &cue.ContentID, &cue.Kind, &cue.InMsec, &cue.OutMsec, &cue.Color, &cue.Comment); err != nil {
+			return nil, fmt.Errorf("failed to scan cue row: %w", err)
+		}
+		cues = append(cues, cue)
+	}
+
+	return cues, rows.Err()
+}
+
+// GetPlaylistCues calls GetPlaylistCuesContext with context.Background().
+func (db *DB) GetPlaylistCues(playlistID string) (map[string][]Cue, error) {
+	return db.GetPlaylistCuesContext(context.Background(), playlistID)
+}
+
+// GetPlaylistCuesContext retrieves the cue points of every track in a
+// playlist, keyed by content ID.
+func (db *DB) GetPlaylistCuesContext(ctx context.Context, playlistID string) (map[string][]Cue, error) {
+	cueTable := db.schema.table("djmdCue", "cue")
+	sp := db.schema.table("djmdSongPlaylist", "sp")
+	query := `
+		SELECT
+			cue.ID,
+			cue.ContentID,
+			cue.Kind,
+			cue.InMsec,
+			COALESCE(cue.OutMsec, -1) AS OutMsec,
+			COALESCE(cue.Color, -1) AS Color,
+			COALESCE(cue.Comment, '') AS Comment
+		FROM djmdCue cue
+		WHERE cue.ContentID IN (
+			SELECT sp.ContentID
+			FROM djmdSongPlaylist sp
+			WHERE sp.PlaylistID = ? AND ` + sp.Live + `
+		) AND ` + cueTable.Live + `
+		ORDER BY cue.ContentID, cue.InMsec`
+
+	rows, err := db.query(ctx, query, playlistID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cues for playlist %s: %w", playlistID, err)
+	}
+	defer rows.Close()
+
+	cues := make(map[string][]Cue)
+	for rows.Next() {
+		var cue Cue
+		if err := rows.Scan(&cue.ID, &cue.ContentID, &cue.Kind, &cue.InMsec, &cue.OutMsec, &cue.Color, &cue.Comment); err != nil {
+			return nil, fmt.Errorf("failed to scan cue row: %w", err)
+		}
+		cues[cue.ContentID] = append(cues[cue.ContentID], cue)
+	}
+
+	return cues, rows.Err()
+}
+
+// LoadPlaylistCues calls LoadPlaylistCuesContext with context.Background().
+func (db *DB) LoadPlaylistCues(playlist *FullPlaylist) error {
+	return db.LoadPlaylistCuesContext(context.Background(), playlist)
+}
+
+// LoadPlaylistCuesContext fills in the Cues of every track in playlist.
+func (db *DB) LoadPlaylistCuesContext(ctx context.Context, playlist *FullPlaylist) error {
+	cues, err := db.GetPlaylistCuesContext(ctx, playlist.ID)
+	if err != nil {
+		return err
+	}
+	for i := range playlist.Tracks {
+		playlist.Tracks[i].Cues = cues[playlist.Tracks[i].ID]
+	}
+	return nil
+}
@@ -0,0 +1,296 @@
+package rekordbox
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DBEnv is the environment variable that overrides database discovery.
+const DBEnv = "REKORDBOX_DB"
+
+// DBName is the file name of the Rekordbox 6 and 7 database.
+const DBName = "master.db"
+
+// Installation is a Rekordbox database found by Discover.
+type Installation struct {
+	Path    string // Location of master.db
+	Version string // Installed Rekordbox version, empty if unknown
+	Source  string // How Path was found, like "options.json"
+}
+
+// NotFoundError is returned by Discover when no database exists in any
+// known location.
+type NotFoundError struct {
+	Searched []string
+}
+
+func (e *NotFoundError) Error() string {
+	if len(e.Searched) == 0 {
+		return fmt.Sprintf("no rekordbox installation found; set %s to the database path", DBEnv)
+	}
+	return fmt.Sprintf("no rekordbox database found (searched %s; set %s to its path)",
+		strings.Join(e.Searched, ", "), DBEnv)
+}
+
+// Discover finds the Rekordbox database. It uses $REKORDBOX_DB if set and
+// otherwise looks where Rekordbox keeps its database on the current OS,
+// following the locations recorded in Rekordbox's options.json and
+// rekordbox3.settings when the database was moved. On Linux it looks
+// inside Wine prefixes.
+func Discover() (*Installation, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return discover(runtime.GOOS, home, os.Getenv)
+}
+
+func discover(goos, home string, getenv func(string) string) (*Installation, error) {
+	if path := getenv(DBEnv); path != "" {
+		if !fileExists(path) {
+			return nil, fmt.Errorf("%s is set to %s, which doesn't exist", DBEnv, path)
+		}
+		return &Installation{Path: path, Source: DBEnv}, nil
+	}
+
+	var searched []string
+	for _, loc := range dbLocations(goos, home, getenv) {
+		candidates := []struct {
+			source string
+			path   string
+		}{
+			{"options.json", loc.fromOptions()},
+			{"rekordbox3.settings", loc.fromSettings()},
+			{"default location", filepath.Join(loc.dbDir, DBName)},
+		}
+		for _, c := range candidates {
+			if c.path == "" {
+				continue
+			}
+			if fileExists(c.path) {
+				return &Installation{Path: c.path, Version: loc.version(), Source: c.source}, nil
+			}
+			searched = append(searched, c.path)
+		}
+	}
+
+	return nil, &NotFoundError{Searched: searched}
+}
+
+// dbLocation is where one Rekordbox installation keeps its files.
+type dbLocation struct {
+	dbDir    string // Default database directory
+	options  string // rekordboxAgent's options.json
+	settings string // rekordbox3.settings
+	apps     string // Glob matching installed application directories
+	// hostPath converts a path read from options.json or
+	// rekordbox3.settings to one usable on this system.
+	hostPath func(string) string
+}
+
+func dbLocations(goos, home string, getenv func(string) string) []dbLocation {
+	switch goos {
+	case "darwin":
+		support := filepath.Join(home, "Library", "Application Support", "Pioneer")
+		return []dbLocation{{
+			dbDir:    filepath.Join(home, "Library", "Pioneer", "rekordbox"),
+			options:  filepath.Join(support, "rekordboxAgent", "storage", "options.json"),
+			settings: filepath.Join(support, "rekordbox", "rekordbox3.settings"),
+			apps:     "/Applications/rekordbox */rekordbox.app/Contents/Info.plist",
+			hostPath: func(p string) string { return p },
+		}}
+	case "windows":
+		appData := getenv("APPDATA")
+		if appData == "" {
+			appData = filepath.Join(home, "AppData", "Roaming")
+		}
+		programs := getenv("ProgramFiles")
+		if programs == "" {
+			programs = `C:\Program Files`
+		}
+		return []dbLocation{windowsLocation(appData, filepath.Join(programs, "Pioneer"), func(p string) string { return p })}
+	default:
+		var locs []dbLocation
+		for _, prefix := range winePrefixes(home, getenv) {
+			prefix := prefix
+			users, _ := filepath.Glob(filepath.Join(prefix, "drive_c", "users", "*", "AppData", "Roaming"))
+			users2, _ := filepath.Glob(filepath.Join(prefix, "drive_c", "users", "*", "Application Data"))
+			for _, appData := range append(users, users2...) {
+				locs = append(locs, windowsLocation(
+					appData,
+					filepath.Join(prefix, "drive_c", "Program Files", "Pioneer"),
+					func(p string) string { return winePath(prefix, p) },
+				))
+			}
+		}
+		return locs
+	}
+}
+
+func windowsLocation(appData, programs string, hostPath func(string) string) dbLocation {
+	return dbLocation{
+		dbDir:    filepath.Join(appData, "Pioneer", "rekordbox"),
+		options:  filepath.Join(appData, "Pioneer", "rekordboxAgent", "storage", "options.json"),
+		settings: filepath.Join(appData, "Pioneer", "rekordbox", "rekordbox3.settings"),
+		apps:     filepath.Join(programs, "rekordbox *"),
+		hostPath: hostPath,
+	}
+}
+
+// winePrefixes returns $WINEPREFIX, ~/.wine and the prefixes of common
+// Wine front ends.
+func winePrefixes(home string, getenv func(string) string) []string {
+	var prefixes []string
+	if p := getenv("WINEPREFIX"); p != "" {
+		prefixes = append(prefixes, p)
+	}
+	prefixes = append(prefixes, filepath.Join(home, ".wine"))
+	for _, pattern := range []string{
+		filepath.Join(home, ".local", "share", "bottles", "bottles", "*"),
+		filepath.Join(home, "Games", "*"), // Lutris
+		filepath.Join(home, ".var", "app", "com.usebottles.bottles", "data", "bottles", "bottles", "*"),
+	} {
+		matches, _ := filepath.Glob(pattern)
+		prefixes = append(prefixes, matches...)
+	}
+
+	var existing []string
+	for _, p := range prefixes {
+		if info, err := os.Stat(filepath.Join(p, "drive_c")); err == nil && info.IsDir() {
+			existing = append(existing, p)
+		}
+	}
+	return existing
+}
+
+// winePath converts a Windows path like C:\Users\me\master.db to its
+// location inside a Wine prefix.
+func winePath(prefix, p string) string {
+	if len(p) < 3 || p[1] != ':' {
+		return p
+	}
+	drive := "drive_" + strings.ToLower(p[:1])
+	rest := strings.Split(strings.ReplaceAll(p[3:], `\`, "/"), "/")
+	return filepath.Join(append([]string{prefix, drive}, rest...)...)
+}
+
+// fromOptions returns the database path recorded in options.json, which
+// holds pairs like ["db-path", "/path/to/master.db"]. Other options can
+// have values of any type.
+func (loc dbLocation) fromOptions() string {
+	data, err := os.ReadFile(loc.options)
+	if err != nil {
+		return ""
+	}
+
+	var options struct {
+		Options [][]json.RawMessage `json:"options"`
+	}
+	if err := json.Unmarshal(data, &options); err != nil {
+		return ""
+	}
+	for _, pair := range options.Options {
+		if len(pair) != 2 {
+			continue
+		}
+		var name, path string
+		if json.Unmarshal(pair[0], &name) != nil || name != "db-path" {
+			continue
+		}
+		if json.Unmarshal(pair[1], &path) == nil && path != "" {
+			return loc.hostPath(path)
+		}
+	}
+	return ""
+}
+
+// fromSettings returns the database path from the masterDbDirectory
+// setting, which Rekordbox writes when the database is moved.
+func (loc dbLocation) fromSettings() string {
+	data, err := os.ReadFile(loc.settings)
+	if err != nil {
+		return ""
+	}
+
+	var settings struct {
+		Values []struct {
+			Name string `xml:"name,attr"`
+			Val  string `xml:"val,attr"`
+		} `xml:"VALUE"`
+	}
+	if err := xml.Unmarshal(data, &settings); err != nil {
+		return ""
+	}
+	for _, v := range settings.Values {
+		if v.Name == "masterDbDirectory" && v.Val != "" {
+			return filepath.Join(loc.hostPath(v.Val), DBName)
+		}
+	}
+	return ""
+}
+
+var (
+	versionPattern = regexp.MustCompile(`\d+(\.\d+)+`)
+	plistVersion   = regexp.MustCompile(`<key>CFBundleShortVersionString</key>\s*<string>([^<]+)</string>`)
+)
+
+// version returns the newest installed Rekordbox version, read from the
+// application's Info.plist on macOS and its directory name on Windows.
+func (loc dbLocation) version() string {
+	matches, _ := filepath.Glob(loc.apps)
+
+	var versions []string
+	for _, match := range matches {
+		if filepath.Ext(match) == ".plist" {
+			data, err := os.ReadFile(match)
+			if err != nil {
+				continue
+			}
+			if m := plistVersion.FindSubmatch(data); m != nil {
+				versions = append(versions, string(m[1]))
+			}
+		} else if v := versionPattern.FindString(filepath.Base(match)); v != "" {
+			versions = append(versions, v)
+		}
+	}
+	if len(versions) == 0 {
+		return ""
+	}
+
+	sort.Slice(versions, func(i, j int) bool { return compareVersions(versions[i], versions[j]) < 0 })
+	return versions[len(versions)-1]
+}
+
+// compareVersions compares dotted version numbers numerically.
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
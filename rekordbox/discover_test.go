@@ -0,0 +1,191 @@
+package rekordbox
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFile creates path and its parent directories.
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// env returns a getenv that only knows vars.
+func env(vars map[string]string) func(string) string {
+	return func(key string) string { return vars[key] }
+}
+
+func TestDiscoverEnv(t *testing.T) {
+	db := filepath.Join(t.TempDir(), "master.db")
+	writeFile(t, db, "")
+
+	got, err := discover("darwin", t.TempDir(), env(map[string]string{DBEnv: db}))
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+	if got.Path != db || got.Source != DBEnv {
+		t.Errorf("got %+v, want %s from %s", got, db, DBEnv)
+	}
+
+	if _, err := discover("darwin", t.TempDir(), env(map[string]string{DBEnv: db + ".gone"})); err == nil {
+		t.Error("discover succeeded with a missing $REKORDBOX_DB")
+	}
+}
+
+func TestDiscoverDarwin(t *testing.T) {
+	home := t.TempDir()
+	support := filepath.Join(home, "Library", "Application Support", "Pioneer")
+	moved := filepath.Join(home, "Moved", "master.db")
+	writeFile(t, moved, "")
+	writeFile(t, filepath.Join(home, "Library", "Pioneer", "rekordbox", DBName), "")
+
+	tests := []struct {
+		name    string
+		options string
+		want    string
+		source  string
+	}{
+		{
+			name:    "options.json",
+			options: `{"options": [["db-path", "` + moved + `"]]}`,
+			want:    moved,
+			source:  "options.json",
+		},
+		{
+			name: "mixed option values",
+			options: `{"options": [
+				["language", "en"],
+				["tutorial-shown", true],
+				["window", {"width": 1280, "height": 800}],
+				["recent", ["a", "b"]],
+				["volume", 0.8],
+				["db-path", "` + moved + `"]
+			]}`,
+			want:   moved,
+			source: "options.json",
+		},
+		{
+			name:    "db-path not a string",
+			options: `{"options": [["db-path", 42]]}`,
+			want:    filepath.Join(home, "Library", "Pioneer", "rekordbox", DBName),
+			source:  "default location",
+		},
+		{
+			name:    "invalid options.json",
+			options: `{`,
+			want:    filepath.Join(home, "Library", "Pioneer", "rekordbox", DBName),
+			source:  "default location",
+		},
+	}
+	for _, tt := range tests {
+		writeFile(t, filepath.Join(support, "rekordboxAgent", "storage", "options.json"), tt.options)
+		got, err := discover("darwin", home, env(nil))
+		if err != nil {
+			t.Errorf("%s: discover: %v", tt.name, err)
+			continue
+		}
+		if got.Path != tt.want || got.Source != tt.source {
+			t.Errorf("%s: got %s from %s, want %s from %s", tt.name, got.Path, got.Source, tt.want, tt.source)
+		}
+	}
+}
+
+func TestDiscoverSettings(t *testing.T) {
+	home := t.TempDir()
+	moved := filepath.Join(home, "Moved")
+	writeFile(t, filepath.Join(moved, DBName), "")
+	writeFile(t, filepath.Join(home, "Library", "Application Support", "Pioneer", "rekordbox", "rekordbox3.settings"),
+		`<PROPERTIES><VALUE name="masterDbDirectory" val="`+moved+`"/></PROPERTIES>`)
+
+	got, err := discover("darwin", home, env(nil))
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+	if want := filepath.Join(moved, DBName); got.Path != want || got.Source != "rekordbox3.settings" {
+		t.Errorf("got %s from %s, want %s from rekordbox3.settings", got.Path, got.Source, want)
+	}
+}
+
+func TestDiscoverWindows(t *testing.T) {
+	appData := t.TempDir()
+	programs := t.TempDir()
+	db := filepath.Join(appData, "Pioneer", "rekordbox", DBName)
+	writeFile(t, db, "")
+	for _, dir := range []string{"rekordbox 6.8.5", "rekordbox 7.0.2", "rekordbox 7.0.10"} {
+		if err := os.MkdirAll(filepath.Join(programs, "Pioneer", dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := discover("windows", t.TempDir(), env(map[string]string{
+		"APPDATA":      appData,
+		"ProgramFiles": programs,
+	}))
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+	if got.Path != db || got.Source != "default location" || got.Version != "7.0.10" {
+		t.Errorf("got %+v, want %s from default location, version 7.0.10", got, db)
+	}
+}
+
+func TestDiscoverWine(t *testing.T) {
+	prefix := t.TempDir()
+	appData := filepath.Join(prefix, "drive_c", "users", "dj", "AppData", "Roaming")
+	writeFile(t, filepath.Join(appData, "Pioneer", "rekordboxAgent", "storage", "options.json"),
+		`{"options": [["db-path", "D:\\Rekordbox\\master.db"]]}`)
+	db := filepath.Join(prefix, "drive_d", "Rekordbox", DBName)
+	writeFile(t, db, "")
+
+	got, err := discover("linux", t.TempDir(), env(map[string]string{"WINEPREFIX": prefix}))
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+	if got.Path != db || got.Source != "options.json" {
+		t.Errorf("got %s from %s, want %s from options.json", got.Path, got.Source, db)
+	}
+}
+
+func TestDiscoverNotFound(t *testing.T) {
+	home := t.TempDir()
+	_, err := discover("darwin", home, env(nil))
+	var notFound *NotFoundError
+	if !errors.As(err, &notFound) {
+		t.Fatalf("err = %v, want NotFoundError", err)
+	}
+	want := filepath.Join(home, "Library", "Pioneer", "rekordbox", DBName)
+	if len(notFound.Searched) != 1 || notFound.Searched[0] != want {
+		t.Errorf("Searched = %q, want [%s]", notFound.Searched, want)
+	}
+
+	// No Wine prefixes means nothing to search
+	_, err = discover("linux", home, env(nil))
+	if !errors.As(err, &notFound) || len(notFound.Searched) != 0 {
+		t.Errorf("err = %v, want NotFoundError with nothing searched", err)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"7.0.2", "7.0.10", -1},
+		{"7.0.10", "7.0.2", 1},
+		{"6.8", "6.8.0", 0},
+		{"7", "6.99.99", 1},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package rekordbox
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// DuplicateReason is what the tracks in a DuplicateGroup share.
+type DuplicateReason string
+
+// Duplicate reasons, in the order GroupDuplicates reports them.
+const (
+	DuplicateISRC        DuplicateReason = "isrc"
+	DuplicateFileHash    DuplicateReason = "file_hash"
+	DuplicateArtistTitle DuplicateReason = "artist_title"
+)
+
+// DuplicateGroup is a set of tracks that are likely the same recording.
+type DuplicateGroup struct {
+	Reason DuplicateReason
+	Key    string // The shared ISRC, file hash or normalized "artist - title"
+	Tracks []FullTrack
+}
+
+// DuplicateOptions configure FindDuplicates and GroupDuplicates.
+type DuplicateOptions struct {
+	// DurationTolerance is how far apart the lengths of tracks with the
+	// same artist and title can be; further apart they are taken to be
+	// different edits. Zero uses DefaultDurationTolerance.
+	DurationTolerance time.Duration
+	// HashFiles compares the contents of audio files of the same size,
+	// which reads them in full. Missing files are skipped.
+	HashFiles bool
+}
+
+// DefaultDurationTolerance is used when DuplicateOptions doesn't set one.
+const DefaultDurationTolerance = 3 * time.Second
+
+// FindDuplicates calls FindDuplicatesContext with context.Background().
+func (db *DB) FindDuplicates(opts DuplicateOptions) ([]DuplicateGroup, error) {
+	return db.FindDuplicatesContext(context.Background(), opts)
+}
+
+// FindDuplicatesContext finds duplicates in the whole collection.
+func (db *DB) FindDuplicatesContext(ctx context.Context, opts DuplicateOptions) ([]DuplicateGroup, error) {
+	tracks, err := db.GetAllTracksContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return GroupDuplicates(ctx, tracks, opts)
+}
+
+// GroupDuplicates groups tracks sharing an ISRC, the contents of their
+// file, or a normalized artist and title with similar lengths. A set of
+// tracks matching on several of these is only reported once, for the
+// first reason.
+func GroupDuplicates(ctx context.Context, tracks []FullTrack, opts DuplicateOptions) ([]DuplicateGroup, error) {
+	if opts.DurationTolerance == 0 {
+		opts.DurationTolerance = DefaultDurationTolerance
+	}
+
+	var groups []DuplicateGroup
+	seen := make(map[string]bool)
+	add := func(reason DuplicateReason, byKey map[string][]FullTrack) {
+		keys := make([]string, 0, len(byKey))
+		for key := range byKey {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			group := byKey[key]
+			if len(group) < 2 {
+				continue
+			}
+			ids := make([]string, len(group))
+			for i, t := range group {
+				ids[i] = t.ID
+			}
+			sort.Strings(ids)
+			set := strings.Join(ids, "\x00")
+			if seen[set] {
+				continue
+			}
+			seen[set] = true
+			groups = append(groups, DuplicateGroup{Reason: reason, Key: key, Tracks: group})
+		}
+	}
+
+	byISRC := make(map[string][]FullTrack)
+	for _, t := range tracks {
+		if isrc := strings.ToUpper(strings.TrimSpace(t.ISRC)); isrc != "" {
+			byISRC[isrc] = append(byISRC[isrc], t)
+		}
+	}
+	add(DuplicateISRC, byISRC)
+
+	if opts.HashFiles {
+		byHash, err := groupByFileHash(ctx, tracks)
+		if err != nil {
+			return nil, err
+		}
+		add(DuplicateFileHash, byHash)
+	}
+
+	byTitle := make(map[string][]FullTrack)
+	for _, t := range tracks {
+		if key := NormalizeArtistTitle(t.Artist, t.Title); key != "" {
+			byTitle[key] = append(byTitle[key], t)
+		}
+	}
+	byTitleLength := make(map[string][]FullTrack)
+	for key, group := range byTitle {
+		for i, cluster := range clusterByDuration(group, opts.DurationTolerance) {
+			clusterKey := key
+			if i > 0 {
+				clusterKey = fmt.Sprintf("%s #%d", key, i+1)
+			}
+			byTitleLength[clusterKey] = cluster
+		}
+	}
+	add(DuplicateArtistTitle, byTitleLength)
+
+	return groups, nil
+}
+
+// clusterByDuration splits tracks into runs whose lengths are each within
+// tolerance of the previous one.
+func clusterByDuration(tracks []FullTrack, tolerance time.Duration) [][]FullTrack {
+	sorted := append([]FullTrack(nil), tracks...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Length < sorted[j].Length })
+
+	var clusters [][]FullTrack
+	for i, t := range sorted {
+		if i == 0 || t.Duration()-sorted[i-1].Duration() > tolerance {
+			clusters = append(clusters, nil)
+		}
+		clusters[len(clusters)-1] = append(clusters[len(clusters)-1], t)
+	}
+	return clusters
+}
+
+// groupByFileHash hashes the files of tracks whose size matches another
+// track's and groups them by hash.
+func groupByFileHash(ctx context.Context, tracks []FullTrack) (map[string][]FullTrack, error) {
+	bySize := make(map[int64][]FullTrack)
+	for _, t := range tracks {
+		info, err := os.Stat(t.FolderPath)
+		if err != nil {
+			continue
+		}
+		bySize[info.Size()] = append(bySize[info.Size()], t)
+	}
+
+	byHash := make(map[string][]FullTrack)
+	for _, group := range bySize {
+		if len(group) < 2 {
+			continue
+		}
+		for _, t := range group {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			hash, err := hashFile(t.FolderPath)
+			if err != nil {
+				continue
+			}
+			byHash[hash] = append(byHash[hash], t)
+		}
+	}
+	return byHash, nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+var (
+	// titleNoise matches parts of titles that don't distinguish
+	// recordings: "(Original Mix)" and featured artists.
+	titleNoise = regexp.MustCompile(`(?i)[(\[]\s*original( mix)?\s*[)\]]|\s(feat\.?|ft\.?|featuring)\s.*$|[(\[]\s*(feat\.?|ft\.?|featuring)\s[^)\]]*[)\]]`)
+	// nonWord matches runs of anything but letters and digits.
+	nonWord = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+)
+
+// NormalizeArtistTitle returns a key that is the same for spellings of an
+// artist and title differing only in case, accents, punctuation, featured
+// artists or an "(Original Mix)" suffix. It is empty if title is.
+func NormalizeArtistTitle(artist, title string) string {
+	title = normalizeText(titleNoise.ReplaceAllString(title, " "))
+	if title == "" {
+		return ""
+	}
+	artist = normalizeText(titleNoise.ReplaceAllString(artist, " "))
+	return artist + " - " + title
+}
+
+func normalizeText(s string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	if folded, _, err := transform.String(t, s); err == nil {
+		s = folded
+	}
+	s = strings.ToLower(s)
+	return strings.TrimSpace(nonWord.ReplaceAllString(s, " "))
+}
@@ -0,0 +1,174 @@
+package rekordbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dhowden/tag"
+)
+
+// FindMissingFiles calls FindMissingFilesContext with context.Background().
+func (db *DB) FindMissingFiles() ([]FullTrack, error) {
+	return db.FindMissingFilesContext(context.Background())
+}
+
+// FindMissingFilesContext returns the tracks in the collection whose audio
+// file doesn't exist.
+func (db *DB) FindMissingFilesContext(ctx context.Context) ([]FullTrack, error) {
+	tracks, err := db.GetAllTracksContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return MissingFiles(ctx, tracks)
+}
+
+// MissingFiles returns the tracks whose audio file doesn't exist. Tracks
+// without a path, like streaming ones, are skipped.
+func MissingFiles(ctx context.Context, tracks []FullTrack) ([]FullTrack, error) {
+	var missing []FullTrack
+	for _, t := range tracks {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if t.FolderPath == "" {
+			continue
+		}
+		if _, err := os.Stat(t.FolderPath); errors.Is(err, fs.ErrNotExist) {
+			missing = append(missing, t)
+		}
+	}
+	return missing, nil
+}
+
+// Ways a Relocation matches the missing track.
+const (
+	MatchFilename = "filename" // Same file name, ignoring case
+	MatchSize     = "size"     // Same size as the database records
+	MatchTags     = "tags"     // Same normalized artist and title tags
+)
+
+// Relocation is a file that may be where a missing track was moved.
+type Relocation struct {
+	Path    string
+	Matches []string // Match constants, in the order above
+}
+
+// RelocateOptions configure FindRelocations.
+type RelocateOptions struct {
+	// Roots are the directories searched, recursively.
+	Roots []string
+	// ReadTags reads the tags of every audio file under Roots, to find
+	// files that were renamed and re-encoded.
+	ReadTags bool
+}
+
+// audioExtensions are the file types Rekordbox can import.
+var audioExtensions = map[string]bool{
+	".mp3": true, ".m4a": true, ".mp4": true, ".aac": true, ".flac": true,
+	".wav": true, ".aif": true, ".aiff": true, ".alac": true, ".ogg": true,
+}
+
+// FindRelocations searches opts.Roots for files that may be the missing
+// tracks, keyed by track ID. A file is a candidate when its name or size
+// matches, or its tags with ReadTags. Candidates matching in more ways
+// come first; tracks without any are left out.
+func FindRelocations(ctx context.Context, missing []FullTrack, opts RelocateOptions) (map[string][]Relocation, error) {
+	byName := make(map[string][]string)
+	bySize := make(map[int64][]string)
+	byTags := make(map[string][]string)
+	seen := make(map[string]bool) // Roots may overlap
+
+	for _, root := range opts.Roots {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if path == root {
+					return err
+				}
+				return nil // Skip unreadable subdirectories
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if d.IsDir() || !audioExtensions[strings.ToLower(filepath.Ext(path))] || seen[path] {
+				return nil
+			}
+			seen[path] = true
+
+			name := strings.ToLower(d.Name())
+			byName[name] = append(byName[name], path)
+			if info, err := d.Info(); err == nil {
+				bySize[info.Size()] = append(bySize[info.Size()], path)
+			}
+			if opts.ReadTags {
+				if artist, title, err := readTags(path); err == nil {
+					if key := NormalizeArtistTitle(artist, title); key != "" {
+						byTags[key] = append(byTags[key], path)
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to search %s: %w", root, err)
+		}
+	}
+
+	relocations := make(map[string][]Relocation)
+	for _, t := range missing {
+		matches := make(map[string][]string)
+		for _, path := range byName[strings.ToLower(filepath.Base(t.FolderPath))] {
+			matches[path] = append(matches[path], MatchFilename)
+		}
+		if t.FileSize > 0 {
+			for _, path := range bySize[t.FileSize] {
+				matches[path] = append(matches[path], MatchSize)
+			}
+		}
+		if key := NormalizeArtistTitle(t.Artist, t.Title); key != "" {
+			for _, path := range byTags[key] {
+				matches[path] = append(matches[path], MatchTags)
+			}
+		}
+		if len(matches) == 0 {
+			continue
+		}
+
+		candidates := make([]Relocation, 0, len(matches))
+		for path, m := range matches {
+			candidates = append(candidates, Relocation{Path: path, Matches: m})
+		}
+		sort.Slice(candidates, func(i, j int) bool {
+			if len(candidates[i].Matches) != len(candidates[j].Matches) {
+				return len(candidates[i].Matches) > len(candidates[j].Matches)
+			}
+			return candidates[i].Path < candidates[j].Path
+		})
+		relocations[t.ID] = candidates
+	}
+	return relocations, nil
+}
+
+func readTags(path string) (artist, title string, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+
+	m, err := tag.ReadFrom(f)
+	if err != nil {
+		return "", "", err
+	}
+
+	artist = strings.TrimSpace(m.Artist())
+	if artist == "" {
+		artist = strings.TrimSpace(m.AlbumArtist())
+	}
+	return artist, strings.TrimSpace(m.Title()), nil
+}
@@ -0,0 +1,76 @@
+package rekordbox
+
+import (
+	"context"
+	"fmt"
+)
+
+// MyTag is a My Tag from djmdMyTag. Tags are grouped under parent tags,
+// like "Mood" for "Peak".
+type MyTag struct {
+	ID        string
+	Name      string
+	ParentID  string
+	GroupName string // Name of the parent tag, empty for groups
+}
+
+// GetMyTags calls GetMyTagsContext with context.Background().
+func (db *DB) GetMyTags() ([]MyTag, error) {
+	return db.GetMyTagsContext(context.Background())
+}
+
+// GetMyTagsContext retrieves every My Tag and tag group.
+func (db *DB) GetMyTagsContext(ctx context.Context) ([]MyTag, error) {
+	t := db.schema.table("djmdMyTag", "t")
+	query := `
+		SELECT
+			t.ID,
+			COALESCE(t.Name, '') AS Name,
+			COALESCE(t.ParentID, '') AS ParentID,
+			COALESCE(parent.Name, '') AS GroupName
+		FROM djmdMyTag t
+		LEFT JOIN djmdMyTag parent ON t.ParentID = parent.ID
+		WHERE ` + t.Live + `
+		ORDER BY t.ParentID, t.Seq`
+
+	rows, err := db.query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get my tags: %w", err)
+	}
+	defer rows.Close()
+
+	var tags []MyTag
+	for rows.Next() {
+		var tag MyTag
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.ParentID, &tag.GroupName); err != nil {
+			return nil, fmt.Errorf("failed to scan my tag row: %w", err)
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags, rows.Err()
+}
+
+// GetMyTagTracks calls GetMyTagTracksContext with context.Background().
+func (db *DB) GetMyTagTracks(tagID string) ([]FullTrack, error) {
+	return db.GetMyTagTracksContext(context.Background(), tagID)
+}
+
+// GetMyTagTracksContext retrieves the tracks tagged with a My Tag, in the
+// order they were tagged.
+func (db *DB) GetMyTagTracksContext(ctx context.Context, tagID string) ([]FullTrack, error) {
+	st := db.schema.table("djmdSongMyTag", "st")
+	c := db.schema.table("djmdContent", "c")
+	query := `
+		SELECT` + db.fullTrackColumns() + `
+		FROM djmdSongMyTag st
+		JOIN djmdContent c ON st.ContentID = c.ID` + fullTrackJoins + `
+		WHERE st.MyTagID = ? AND ` + st.Live + ` AND ` + c.Live + `
+		ORDER BY st.TrackNo, c.ID`
+
+	tracks, err := db.queryFullTracks(ctx, query, tagID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tracks for my tag %s: %w", tagID, err)
+	}
+	return tracks, nil
+}
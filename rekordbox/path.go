@@ -0,0 +1,89 @@
+package rekordbox
+
+import "strings"
+
+// PathSeparator separates folder and playlist names in a playlist path
+// such as "House/Deep/Late Night". A separator that is part of a name is
+// escaped with a backslash.
+const PathSeparator = "/"
+
+// ParsePlaylistPath splits a playlist path into names. Surrounding
+// whitespace and empty elements are dropped, so "/House/ Deep /" is
+// ["House", "Deep"].
+func ParsePlaylistPath(s string) []string {
+	var (
+		names []string
+		name  strings.Builder
+	)
+	flush := func() {
+		if n := strings.TrimSpace(name.String()); n != "" {
+			names = append(names, n)
+		}
+		name.Reset()
+	}
+
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && s[i+1] == PathSeparator[0]:
+			name.WriteByte(PathSeparator[0])
+			i++
+		case s[i] == PathSeparator[0]:
+			flush()
+		default:
+			name.WriteByte(s[i])
+		}
+	}
+	flush()
+
+	return names
+}
+
+// FormatPlaylistPath joins names into a path ParsePlaylistPath accepts.
+func FormatPlaylistPath(path []string) string {
+	escaped := make([]string, len(path))
+	for i, name := range path {
+		escaped[i] = strings.ReplaceAll(name, PathSeparator, `\`+PathSeparator)
+	}
+	return strings.Join(escaped, PathSeparator)
+}
+
+// IsPlaylistPath reports whether s has more than one path element.
+func IsPlaylistPath(s string) bool {
+	return len(ParsePlaylistPath(s)) > 1
+}
+
+// Find returns the node for the playlist or folder with the given ID
+// below n, or nil.
+func (n *PlaylistNode) Find(id string) *PlaylistNode {
+	if n.Playlist != nil && n.Playlist.ID == id {
+		return n
+	}
+	for _, child := range n.Children {
+		if found := child.Find(id); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// FindPath returns the nodes below n whose names match path from n down.
+// Rekordbox allows siblings with the same name, so there can be more than
+// one.
+func (n *PlaylistNode) FindPath(path []string) []*PlaylistNode {
+	if len(path) == 0 {
+		return nil
+	}
+
+	var found []*PlaylistNode
+	for _, child := range n.Children {
+		if child.Playlist == nil || child.Playlist.Name != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			found = append(found, child)
+		} else {
+			found = append(found, child.FindPath(path[1:])...)
+		}
+	}
+	return found
+}
@@ -1,15 +1,18 @@
 package rekordbox
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"net/url"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	_ "github.com/mutecomm/go-sqlcipher/v4"
 	"github.com/r-medina/rdbs"
+	"github.com/r-medina/rdbs/key"
 )
 
 const DBKey = "402fd482c38817c35ffa8ffb8c7d93143b749e7d315df7a81732a1ff43608497"
@@ -26,13 +29,35 @@ type FullTrack struct {
 	Year        int
 	TrackNumber int
 	DiscNumber  int
-	BPM         int
-	Length      int // In milliseconds
+	BPM         int // In hundredths of a beat per minute
+	Length      int // In seconds
 	Key         string
 	Rating      int
 	ISRC        string
 	FileType    string
+	FolderPath  string // Full path to the audio file
+	FileSize    int64  // In bytes
+	Comments    string
 	DateCreated time.Time
+	Cues        []Cue // Only populated by exporters that need cue points
+}
+
+// Tempo returns the track's BPM as a floating point value.
+func (t FullTrack) Tempo() float64 {
+	return float64(t.BPM) / 100
+}
+
+// Duration returns the track's length.
+func (t FullTrack) Duration() time.Duration {
+	return time.Duration(t.Length) * time.Second
+}
+
+// ParsedKey returns the track's key, which Rekordbox may store in musical
+// or Camelot notation. It is false if the track has no key or it can't be
+// parsed.
+func (t FullTrack) ParsedKey() (key.Key, bool) {
+	k, err := key.Parse(t.Key)
+	return k, err == nil
 }
 
 // FullPlaylist represents a playlist with full hierarchy context.
@@ -46,10 +71,33 @@ type FullPlaylist struct {
 	ImagePath   string
 	DateCreated time.Time
 	Path        []string // Full hierarchy path
+	TrackCount  int      // Only set by GetPlaylistHierarchy WithTrackCounts
 	Tracks      []FullTrack
 	Children    []*FullPlaylist
 }
 
+// PlaylistKind distinguishes playlists, folders and smart playlists.
+type PlaylistKind string
+
+// Playlist kinds.
+const (
+	KindPlaylist PlaylistKind = "playlist"
+	KindFolder   PlaylistKind = "folder"
+	KindSmart    PlaylistKind = "smart"
+)
+
+// Kind returns the kind of p, from its Attribute.
+func (p *FullPlaylist) Kind() PlaylistKind {
+	switch p.Attribute {
+	case 1:
+		return KindFolder
+	case 4:
+		return KindSmart
+	default:
+		return KindPlaylist
+	}
+}
+
 // PlaylistNode represents a node in the playlist hierarchy.
 type PlaylistNode struct {
 	Playlist *FullPlaylist
@@ -71,14 +119,11 @@ type PlaylistInfo struct {
 	Seq        string
 }
 
-// OpenDB opens a read-only SQLite database connection with encryption.
+// OpenDB opens a read-only SQLite database connection, decrypting it with
+// the first of KnownCiphers that works.
 func OpenDB(file string) (*sql.DB, error) {
-	dsn := fmt.Sprintf(
-		"file:%s?_pragma_key=%s&_pragma_cipher_compatibility=4&mode=ro",
-		file,
-		url.QueryEscape(DBKey),
-	)
-	return sql.Open("sqlite3", dsn)
+	sqlDB, _, err := open(file, KnownCiphers)
+	return sqlDB, err
 }
 
 // Option defines a configuration function for DB initialization.
@@ -93,11 +138,27 @@ func WithDBLocation(path string) Option {
 
 // DB represents a Rekordbox database connection.
 type DB struct {
-	path  string
-	sqlDB *sql.DB
+	path     string
+	snapshot bool
+	// snapshotPath is the copy being read when snapshot is set.
+	snapshotPath string
+	// ciphers are tried in order when opening; cipher is the one that
+	// worked.
+	ciphers []Cipher
+	cipher  Cipher
+	schema  *Schema
+	// anySchema opens databases whose schema isn't supported.
+	anySchema bool
+	sqlDB     *sql.DB
+
+	searchMu    sync.Mutex
+	searchIndex *SearchIndex // Built by the first SearchTracks
 }
 
-// New creates a new DB instance with the provided options.
+// New creates a new DB instance with the provided options. Without
+// WithDBLocation the database is found with Discover. Without WithKey or
+// WithCipher it is decrypted with $REKORDBOX_DB_KEY if set, and otherwise
+// with KnownCiphers.
 func New(opts ...Option) (*DB, error) {
 	db := new(DB)
 
@@ -105,32 +166,77 @@ func New(opts ...Option) (*DB, error) {
 		opt(db)
 	}
 
+	if db.ciphers == nil {
+		if key := os.Getenv(DBKeyEnv); key != "" {
+			db.ciphers = keyCiphers(key)
+		} else {
+			db.ciphers = KnownCiphers
+		}
+	}
+
 	if db.path == "" {
-		homeDir, err := os.UserHomeDir()
+		install, err := Discover()
 		if err != nil {
-			return nil, fmt.Errorf("failed to get home directory: %w", err)
+			return nil, err
 		}
-		db.path = filepath.Join(homeDir, "Library/Pioneer/rekordbox/master.db")
+		db.path = install.Path
 	}
 
-	sqlDB, err := OpenDB(db.path)
+	sqlDB, cipher, err := open(db.path, db.ciphers)
 	if err != nil {
+		var decryptErr *DecryptError
+		if errors.As(err, &decryptErr) {
+			decryptErr.Path = db.path
+			return nil, decryptErr
+		}
 		return nil, fmt.Errorf("failed to open database at %s: %w", db.path, err)
 	}
+
+	if db.snapshot {
+		db.snapshotPath, err = snapshot(context.Background(), sqlDB, db.path)
+		sqlDB.Close()
+		if err != nil {
+			return nil, err
+		}
+		if sqlDB, err = openCipher(db.snapshotPath, cipher); err != nil {
+			db.removeSnapshot()
+			return nil, fmt.Errorf("failed to open snapshot of %s: %w", db.path, err)
+		}
+	}
 	db.sqlDB = sqlDB
+	db.cipher = cipher
+
+	if db.schema, err = detectSchema(sqlDB, db.anySchema); err != nil {
+		db.Close()
+		return nil, err
+	}
 
 	return db, nil
 }
 
-// Close closes the database connection.
+// Path returns the location of the database file.
+func (db *DB) Path() string {
+	return db.path
+}
+
+// Close closes the database connection and removes any snapshot.
 func (db *DB) Close() error {
-	return db.sqlDB.Close()
+	err := db.sqlDB.Close()
+	db.removeSnapshot()
+	return err
 }
 
-// GetFullTrackInfo retrieves complete track metadata by content ID.
-func (db *DB) GetFullTrackInfo(contentID string) (*FullTrack, error) {
-	query := `
-		SELECT
+func (db *DB) removeSnapshot() {
+	if db.snapshotPath != "" {
+		os.RemoveAll(filepath.Dir(db.snapshotPath))
+		db.snapshotPath = ""
+	}
+}
+
+// fullTrackColumns selects every FullTrack field from djmdContent c joined
+// with fullTrackJoins, in the order scanFullTrack expects.
+func (db *DB) fullTrackColumns() string {
+	return `
 			c.ID,
 			c.Title,
 			c.TrackNo,
@@ -142,25 +248,38 @@ func (db *DB) GetFullTrackInfo(contentID string) (*FullTrack, error) {
 			c.FileType,
 			c.DateCreated,
 			c.ISRC,
+			COALESCE(c.FolderPath, '') AS FolderPath,
+			COALESCE(c.FileSize, 0) AS FileSize,
+			COALESCE(c.Commnt, '') AS Comments,
 			COALESCE(a.Name, '') AS Artist,
 			COALESCE(al.Name, '') AS Album,
 			COALESCE(aa.Name, '') AS AlbumArtist,
 			COALESCE(g.Name, '') AS Genre,
 			COALESCE(l.Name, '') AS Label,
-			COALESCE(k.ScaleName, '') AS KeyName
-		FROM djmdContent c
+			COALESCE(` + db.schema.keyName("k") + `, '') AS KeyName`
+}
+
+// fullTrackJoins joins the lookup tables fullTrackColumns reads from.
+const fullTrackJoins = `
 		LEFT JOIN djmdArtist a ON c.ArtistID = a.ID
 		LEFT JOIN djmdAlbum al ON c.AlbumID = al.ID
 		LEFT JOIN djmdArtist aa ON al.AlbumArtistID = aa.ID
 		LEFT JOIN djmdGenre g ON c.GenreID = g.ID
 		LEFT JOIN djmdLabel l ON c.LabelID = l.ID
-		LEFT JOIN djmdKey k ON c.KeyID = k.ID
-		WHERE c.ID = ? AND c.rb_local_deleted = 0`
+		LEFT JOIN djmdKey k ON c.KeyID = k.ID`
+
+// rowScanner is implemented by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
 
+// scanFullTrack scans a row selected with fullTrackColumns. Any extra
+// destinations are scanned from columns following them.
+func scanFullTrack(row rowScanner, extra ...interface{}) (FullTrack, error) {
 	var track FullTrack
 	var dateStr string
 
-	err := db.sqlDB.QueryRow(query, contentID).Scan(
+	dest := []interface{}{
 		&track.ID,
 		&track.Title,
 		&track.TrackNumber,
@@ -172,60 +291,92 @@ func (db *DB) GetFullTrackInfo(contentID string) (*FullTrack, error) {
 		&track.FileType,
 		&dateStr,
 		&track.ISRC,
+		&track.FolderPath,
+		&track.FileSize,
+		&track.Comments,
 		&track.Artist,
 		&track.Album,
 		&track.AlbumArtist,
 		&track.Genre,
 		&track.Label,
 		&track.Key,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get track info for ID %s: %w", contentID, err)
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return track, err
 	}
 
-	if dateStr != "" {
-		if parsed, err := time.Parse("2006-01-02 15:04:05", dateStr); err == nil {
+	// DateCreated holds a bare date in most libraries.
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02"} {
+		if parsed, err := time.Parse(layout, dateStr); err == nil {
 			track.DateCreated = parsed
+			break
 		}
 	}
 
+	return track, nil
+}
+
+// GetFullTrackInfo calls GetFullTrackInfoContext with context.Background().
+func (db *DB) GetFullTrackInfo(contentID string) (*FullTrack, error) {
+	return db.GetFullTrackInfoContext(context.Background(), contentID)
+}
+
+// GetFullTrackInfoContext retrieves complete track metadata by content ID.
+func (db *DB) GetFullTrackInfoContext(ctx context.Context, contentID string) (*FullTrack, error) {
+	c := db.schema.table("djmdContent", "c")
+	query := `
+		SELECT` + db.fullTrackColumns() + `
+		FROM djmdContent c` + fullTrackJoins + `
+		WHERE c.ID = ? AND ` + c.Live
+
+	track, err := scanFullTrack(db.queryRow(ctx, query, contentID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get track info for ID %s: %w", contentID, err)
+	}
+
 	return &track, nil
 }
 
-// GetPlaylistTracksDetailed retrieves all tracks in a playlist with full metadata.
+// GetTracksByPath calls GetTracksByPathContext with context.Background().
+func (db *DB) GetTracksByPath(path string) ([]FullTrack, error) {
+	return db.GetTracksByPathContext(context.Background(), path)
+}
+
+// GetTracksByPathContext retrieves the tracks whose audio file is at path.
+// There is usually at most one, but Rekordbox can import a file twice.
+func (db *DB) GetTracksByPathContext(ctx context.Context, path string) ([]FullTrack, error) {
+	c := db.schema.table("djmdContent", "c")
+	query := `
+		SELECT` + db.fullTrackColumns() + `
+		FROM djmdContent c` + fullTrackJoins + `
+		WHERE c.FolderPath = ? AND ` + c.Live + `
+		ORDER BY c.ID`
+
+	tracks, err := db.queryFullTracks(ctx, query, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tracks at %s: %w", path, err)
+	}
+	return tracks, nil
+}
+
+// GetPlaylistTracksDetailed calls GetPlaylistTracksDetailedContext with context.Background().
 func (db *DB) GetPlaylistTracksDetailed(playlistID string) ([]FullTrack, error) {
+	return db.GetPlaylistTracksDetailedContext(context.Background(), playlistID)
+}
+
+// GetPlaylistTracksDetailedContext retrieves all tracks in a playlist with full metadata.
+func (db *DB) GetPlaylistTracksDetailedContext(ctx context.Context, playlistID string) ([]FullTrack, error) {
+	sp := db.schema.table("djmdSongPlaylist", "sp")
+	c := db.schema.table("djmdContent", "c")
 	query := `
-		SELECT
-			c.ID,
-			c.Title,
-			c.TrackNo,
-			c.DiscNo,
-			c.BPM,
-			c.Length,
-			c.Rating,
-			c.ReleaseYear,
-			c.FileType,
-			c.DateCreated,
-			c.ISRC,
-			COALESCE(a.Name, '') AS Artist,
-			COALESCE(al.Name, '') AS Album,
-			COALESCE(aa.Name, '') AS AlbumArtist,
-			COALESCE(g.Name, '') AS Genre,
-			COALESCE(l.Name, '') AS Label,
-			COALESCE(k.ScaleName, '') AS KeyName,
+		SELECT` + db.fullTrackColumns() + `,
 			sp.TrackNo AS PlaylistTrackNo
 		FROM djmdSongPlaylist sp
-		JOIN djmdContent c ON sp.ContentID = c.ID
-		LEFT JOIN djmdArtist a ON c.ArtistID = a.ID
-		LEFT JOIN djmdAlbum al ON c.AlbumID = al.ID
-		LEFT JOIN djmdArtist aa ON al.AlbumArtistID = aa.ID
-		LEFT JOIN djmdGenre g ON c.GenreID = g.ID
-		LEFT JOIN djmdLabel l ON c.LabelID = l.ID
-		LEFT JOIN djmdKey k ON c.KeyID = k.ID
-		WHERE sp.PlaylistID = ? AND sp.rb_local_deleted = 0 AND c.rb_local_deleted = 0
+		JOIN djmdContent c ON sp.ContentID = c.ID` + fullTrackJoins + `
+		WHERE sp.PlaylistID = ? AND ` + sp.Live + ` AND ` + c.Live + `
 		ORDER BY sp.TrackNo`
 
-	rows, err := db.sqlDB.Query(query, playlistID)
+	rows, err := db.query(ctx, query, playlistID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get tracks for playlist %s: %w", playlistID, err)
 	}
@@ -233,48 +384,102 @@ func (db *DB) GetPlaylistTracksDetailed(playlistID string) ([]FullTrack, error)
 
 	var tracks []FullTrack
 	for rows.Next() {
-		var track FullTrack
-		var dateStr string
 		var playlistTrackNo int
-
-		err := rows.Scan(
-			&track.ID,
-			&track.Title,
-			&track.TrackNumber,
-			&track.DiscNumber,
-			&track.BPM,
-			&track.Length,
-			&track.Rating,
-			&track.Year,
-			&track.FileType,
-			&dateStr,
-			&track.ISRC,
-			&track.Artist,
-			&track.Album,
-			&track.AlbumArtist,
-			&track.Genre,
-			&track.Label,
-			&track.Key,
-			&playlistTrackNo,
-		)
+		track, err := scanFullTrack(rows, &playlistTrackNo)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan track row: %w", err)
 		}
+		tracks = append(tracks, track)
+	}
 
-		if dateStr != "" {
-			if parsed, err := time.Parse("2006-01-02 15:04:05", dateStr); err == nil {
-				track.DateCreated = parsed
-			}
-		}
+	return tracks, rows.Err()
+}
 
+// GetAllTracks calls GetAllTracksContext with context.Background().
+func (db *DB) GetAllTracks() ([]FullTrack, error) {
+	return db.GetAllTracksContext(context.Background())
+}
+
+// GetAllTracksContext retrieves every track in the collection with full metadata.
+func (db *DB) GetAllTracksContext(ctx context.Context) ([]FullTrack, error) {
+	c := db.schema.table("djmdContent", "c")
+	query := `
+		SELECT` + db.fullTrackColumns() + `
+		FROM djmdContent c` + fullTrackJoins + `
+		WHERE ` + c.Live + `
+		ORDER BY c.ID`
+
+	tracks, err := db.queryFullTracks(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tracks: %w", err)
+	}
+	return tracks, nil
+}
+
+// queryFullTracks runs a query selecting fullTrackColumns and scans every
+// row.
+func (db *DB) queryFullTracks(ctx context.Context, query string, args ...interface{}) ([]FullTrack, error) {
+	rows, err := db.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tracks []FullTrack
+	for rows.Next() {
+		track, err := scanFullTrack(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan track row: %w", err)
+		}
 		tracks = append(tracks, track)
 	}
 
 	return tracks, rows.Err()
 }
 
-// GetPlaylistHierarchy retrieves the complete playlist hierarchy.
-func (db *DB) GetPlaylistHierarchy() (*PlaylistNode, error) {
+// HierarchyOption configures GetPlaylistHierarchy.
+type HierarchyOption func(*hierarchyOptions)
+
+type hierarchyOptions struct {
+	trackCounts bool
+}
+
+// WithTrackCounts sets the TrackCount of every playlist in the hierarchy.
+// Folders and smart playlists, which have no tracks of their own, get 0.
+func WithTrackCounts() HierarchyOption {
+	return func(o *hierarchyOptions) {
+		o.trackCounts = true
+	}
+}
+
+// GetPlaylistHierarchy calls GetPlaylistHierarchyContext with context.Background().
+func (db *DB) GetPlaylistHierarchy(opts ...HierarchyOption) (*PlaylistNode, error) {
+	return db.GetPlaylistHierarchyContext(context.Background(), opts...)
+}
+
+// GetPlaylistHierarchyContext retrieves the complete playlist hierarchy.
+func (db *DB) GetPlaylistHierarchyContext(ctx context.Context, opts ...HierarchyOption) (*PlaylistNode, error) {
+	var o hierarchyOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	p := db.schema.table("djmdPlaylist", "p")
+	trackCount, countJoin := "0", ""
+	if o.trackCounts {
+		sp := db.schema.table("djmdSongPlaylist", "sp")
+		c := db.schema.table("djmdContent", "c")
+		trackCount = "COALESCE(counts.TrackCount, 0)"
+		countJoin = `
+		LEFT JOIN (
+			SELECT sp.PlaylistID, COUNT(*) AS TrackCount
+			FROM djmdSongPlaylist sp
+			JOIN djmdContent c ON sp.ContentID = c.ID
+			WHERE ` + sp.Live + ` AND ` + c.Live + `
+			GROUP BY sp.PlaylistID
+		) counts ON counts.PlaylistID = p.ID`
+	}
+
 	query := `
 		SELECT
 			p.ID,
@@ -283,11 +488,12 @@ func (db *DB) GetPlaylistHierarchy() (*PlaylistNode, error) {
 			p.Seq,
 			p.Attribute,
 			COALESCE(p.ImagePath, '') AS ImagePath,
-			p.created_at,
-			COALESCE(parent.Name, '') AS ParentName
+			` + p.CreatedAt + `,
+			COALESCE(parent.Name, '') AS ParentName,
+			` + trackCount + ` AS TrackCount
 		FROM djmdPlaylist p
-		LEFT JOIN djmdPlaylist parent ON p.ParentID = parent.ID
-		WHERE p.rb_local_deleted = 0
+		LEFT JOIN djmdPlaylist parent ON p.ParentID = parent.ID` + countJoin + `
+		WHERE ` + p.Live + `
 		ORDER BY
 			CASE
 				WHEN p.ParentID IS NULL OR p.ParentID = '' OR p.ParentID = 'root' THEN 0
@@ -297,7 +503,7 @@ func (db *DB) GetPlaylistHierarchy() (*PlaylistNode, error) {
 			p.Seq,
 			p.Name`
 
-	rows, err := db.sqlDB.Query(query)
+	rows, err := db.query(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get playlist hierarchy: %w", err)
 	}
@@ -318,6 +524,7 @@ func (db *DB) GetPlaylistHierarchy() (*PlaylistNode, error) {
 			&playlist.ImagePath,
 			&dateStr,
 			&playlist.ParentName,
+			&playlist.TrackCount,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan playlist row: %w", err)
@@ -377,8 +584,14 @@ func (db *DB) GetPlaylistHierarchy() (*PlaylistNode, error) {
 	return root, rows.Err()
 }
 
-// GetFullPlaylist retrieves a playlist with all its tracks and metadata.
+// GetFullPlaylist calls GetFullPlaylistContext with context.Background().
 func (db *DB) GetFullPlaylist(playlistID string) (*FullPlaylist, error) {
+	return db.GetFullPlaylistContext(context.Background(), playlistID)
+}
+
+// GetFullPlaylistContext retrieves a playlist with all its tracks and metadata.
+func (db *DB) GetFullPlaylistContext(ctx context.Context, playlistID string) (*FullPlaylist, error) {
+	p := db.schema.table("djmdPlaylist", "p")
 	query := `
 		SELECT
 			p.ID,
@@ -387,17 +600,17 @@ func (db *DB) GetFullPlaylist(playlistID string) (*FullPlaylist, error) {
 			p.Seq,
 			p.Attribute,
 			COALESCE(p.ImagePath, '') AS ImagePath,
-			p.created_at,
+			` + p.CreatedAt + `,
 			COALESCE(parent.Name, '') AS ParentName
 		FROM djmdPlaylist p
 		LEFT JOIN djmdPlaylist parent ON p.ParentID = parent.ID
-		WHERE p.ID = ? AND p.rb_local_deleted = 0`
+		WHERE p.ID = ? AND ` + p.Live
 
 	var playlist FullPlaylist
 	var parentID sql.NullString
 	var dateStr string
 
-	err := db.sqlDB.QueryRow(query, playlistID).Scan(
+	err := db.queryRow(ctx, query, playlistID).Scan(
 		&playlist.ID,
 		&playlist.Name,
 		&parentID,
@@ -421,7 +634,7 @@ func (db *DB) GetFullPlaylist(playlistID string) (*FullPlaylist, error) {
 		}
 	}
 
-	tracks, err := db.GetPlaylistTracksDetailed(playlistID)
+	tracks, err := db.GetPlaylistTracksDetailedContext(ctx, playlistID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get tracks for playlist %s: %w", playlistID, err)
 	}
@@ -431,11 +644,17 @@ func (db *DB) GetFullPlaylist(playlistID string) (*FullPlaylist, error) {
 	return &playlist, nil
 }
 
-// GetPlaylistsByParent retrieves playlists by parent ID for folder structure syncing.
+// GetPlaylistsByParent calls GetPlaylistsByParentContext with context.Background().
 func (db *DB) GetPlaylistsByParent(parentID string) ([]FullPlaylist, error) {
+	return db.GetPlaylistsByParentContext(context.Background(), parentID)
+}
+
+// GetPlaylistsByParentContext retrieves playlists by parent ID for folder structure syncing.
+func (db *DB) GetPlaylistsByParentContext(ctx context.Context, parentID string) ([]FullPlaylist, error) {
 	var query string
 	var args []interface{}
 
+	p := db.schema.table("djmdPlaylist", "p")
 	if parentID == "" || parentID == "root" {
 		query = `
 			SELECT
@@ -445,10 +664,10 @@ func (db *DB) GetPlaylistsByParent(parentID string) ([]FullPlaylist, error) {
 				p.Seq,
 				p.Attribute,
 				COALESCE(p.ImagePath, '') AS ImagePath,
-				p.created_at,
+				` + p.CreatedAt + `,
 				'' AS ParentName
 			FROM djmdPlaylist p
-			WHERE (p.ParentID IS NULL OR p.ParentID = '' OR p.ParentID = 'root') AND p.rb_local_deleted = 0
+			WHERE (p.ParentID IS NULL OR p.ParentID = '' OR p.ParentID = 'root') AND ` + p.Live + `
 			ORDER BY p.Seq`
 	} else {
 		query = `
@@ -459,16 +678,16 @@ func (db *DB) GetPlaylistsByParent(parentID string) ([]FullPlaylist, error) {
 				p.Seq,
 				p.Attribute,
 				COALESCE(p.ImagePath, '') AS ImagePath,
-				p.created_at,
+				` + p.CreatedAt + `,
 				COALESCE(parent.Name, '') AS ParentName
 			FROM djmdPlaylist p
 			LEFT JOIN djmdPlaylist parent ON p.ParentID = parent.ID
-			WHERE p.ParentID = ? AND p.rb_local_deleted = 0
+			WHERE p.ParentID = ? AND ` + p.Live + `
 			ORDER BY p.Seq`
 		args = append(args, parentID)
 	}
 
-	rows, err := db.sqlDB.Query(query, args...)
+	rows, err := db.query(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get playlists by parent %s: %w", parentID, err)
 	}
@@ -511,17 +730,23 @@ func (db *DB) GetPlaylistsByParent(parentID string) ([]FullPlaylist, error) {
 	return playlists, rows.Err()
 }
 
-// GetPlaylistTrackCounts returns track counts per playlist for sync verification.
+// GetPlaylistTrackCounts calls GetPlaylistTrackCountsContext with context.Background().
 func (db *DB) GetPlaylistTrackCounts() (map[string]int, error) {
+	return db.GetPlaylistTrackCountsContext(context.Background())
+}
+
+// GetPlaylistTrackCountsContext returns track counts per playlist for sync verification.
+func (db *DB) GetPlaylistTrackCountsContext(ctx context.Context) (map[string]int, error) {
+	sp := db.schema.table("djmdSongPlaylist", "sp")
 	query := `
 		SELECT
 			sp.PlaylistID,
 			COUNT(*) AS TrackCount
 		FROM djmdSongPlaylist sp
-		WHERE sp.rb_local_deleted = 0
+		WHERE ` + sp.Live + `
 		GROUP BY sp.PlaylistID`
 
-	rows, err := db.sqlDB.Query(query)
+	rows, err := db.query(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get track counts: %w", err)
 	}
@@ -540,21 +765,26 @@ func (db *DB) GetPlaylistTrackCounts() (map[string]int, error) {
 	return counts, rows.Err()
 }
 
-// GetPlaylistInfo retrieves playlist metadata by name.
+// GetPlaylistInfo calls GetPlaylistInfoContext with context.Background().
 func (db *DB) GetPlaylistInfo(name string) ([]PlaylistInfo, error) {
+	return db.GetPlaylistInfoContext(context.Background(), name)
+}
+
+// GetPlaylistInfoContext retrieves playlist metadata by name.
+func (db *DB) GetPlaylistInfoContext(ctx context.Context, name string) ([]PlaylistInfo, error) {
 	query := `
 		SELECT
 			p.ID,
 			p.Name,
 			p.ParentID,
 			p.Seq,
-			parent.Name AS ParentName
+			COALESCE(parent.Name, '') AS ParentName
 		FROM djmdPlaylist p
 		LEFT JOIN djmdPlaylist parent ON p.ParentID = parent.ID
 		WHERE p.Name = ?
 		ORDER BY p.ParentID DESC, p.Seq DESC`
 
-	rows, err := db.sqlDB.Query(query, name)
+	rows, err := db.query(ctx, query, name)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query playlist '%s': %w", name, err)
 	}
@@ -572,8 +802,13 @@ func (db *DB) GetPlaylistInfo(name string) ([]PlaylistInfo, error) {
 	return playlists, rows.Err()
 }
 
-// GetPlaylistTracks retrieves basic track information for a playlist.
+// GetPlaylistTracks calls GetPlaylistTracksContext with context.Background().
 func (db *DB) GetPlaylistTracks(playlistID string) ([]rdbs.Track, error) {
+	return db.GetPlaylistTracksContext(context.Background(), playlistID)
+}
+
+// GetPlaylistTracksContext retrieves basic track information for a playlist.
+func (db *DB) GetPlaylistTracksContext(ctx context.Context, playlistID string) ([]rdbs.Track, error) {
 	query := `
 		SELECT
 			c.Title,
@@ -584,7 +819,7 @@ func (db *DB) GetPlaylistTracks(playlistID string) ([]rdbs.Track, error) {
 		WHERE sp.PlaylistID = ?
 		ORDER BY sp.TrackNo`
 
-	rows, err := db.sqlDB.Query(query, playlistID)
+	rows, err := db.query(ctx, query, playlistID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query tracks for playlist '%s': %w", playlistID, err)
 	}
@@ -602,16 +837,22 @@ func (db *DB) GetPlaylistTracks(playlistID string) ([]rdbs.Track, error) {
 	return tracks, rows.Err()
 }
 
-// GetAllPlaylists retrieves all playlists ordered by creation date.
+// GetAllPlaylists calls GetAllPlaylistsContext with context.Background().
 func (db *DB) GetAllPlaylists() ([]Playlist, error) {
+	return db.GetAllPlaylistsContext(context.Background())
+}
+
+// GetAllPlaylistsContext retrieves all playlists ordered by creation date.
+func (db *DB) GetAllPlaylistsContext(ctx context.Context) ([]Playlist, error) {
+	p := db.schema.table("djmdPlaylist", "")
 	query := `
 		SELECT
 			ID,
 			Name
 		FROM djmdPlaylist
-		ORDER BY created_at DESC`
+		ORDER BY ` + p.CreatedAt + ` DESC`
 
-	rows, err := db.sqlDB.Query(query)
+	rows, err := db.query(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query playlists: %w", err)
 	}
@@ -628,32 +869,3 @@ func (db *DB) GetAllPlaylists() ([]Playlist, error) {
 
 	return playlists, rows.Err()
 }
-
-// DumpDatabaseSchema prints the database schema for tables, indexes, views, and triggers.
-func (db *DB) DumpDatabaseSchema() error {
-	query := `
-		SELECT
-			type,
-			name,
-			sql
-		FROM sqlite_master
-		WHERE type IN ('table', 'index', 'view', 'trigger')`
-
-	rows, err := db.sqlDB.Query(query)
-	if err != nil {
-		return fmt.Errorf("failed to query schema: %w", err)
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var objType, name, sqlStmt sql.NullString
-		if err := rows.Scan(&objType, &name, &sqlStmt); err != nil {
-			return fmt.Errorf("failed to scan row: %w", err)
-		}
-		if objType.Valid && name.Valid && sqlStmt.Valid {
-			fmt.Printf("-- %s: %s\n%s;\n\n", objType.String, name.String, sqlStmt.String)
-		}
-	}
-
-	return rows.Err()
-}
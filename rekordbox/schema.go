@@ -0,0 +1,509 @@
+package rekordbox
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Schema describes the layout of an opened database, detected by New.
+type Schema struct {
+	// Version is djmdProperty.DBVersion, empty if the database doesn't
+	// record one.
+	Version string
+	// Variants describes how queries were adapted to this schema, like
+	// "no rb_local_deleted columns".
+	Variants []string
+
+	columns map[string]map[string]bool
+	// keyColumn is the djmdKey column holding key names, empty if there
+	// is none.
+	keyColumn string
+}
+
+// requiredColumns are the tables and columns every query needs. Databases
+// missing any of them aren't supported.
+var requiredColumns = map[string][]string{
+	"djmdContent": {
+		"ID", "Title", "TrackNo", "DiscNo", "BPM", "Length", "Rating", "ReleaseYear",
+		"FileType", "DateCreated", "ISRC", "FolderPath", "FileSize", "Commnt",
+		"ArtistID", "AlbumID", "GenreID", "LabelID", "KeyID",
+	},
+	"djmdPlaylist":     {"ID", "Name", "ParentID", "Seq", "Attribute", "ImagePath"},
+	"djmdSongPlaylist": {"PlaylistID", "ContentID", "TrackNo"},
+	"djmdArtist":       {"ID", "Name"},
+	"djmdAlbum":        {"ID", "Name", "AlbumArtistID"},
+	"djmdGenre":        {"ID", "Name"},
+	"djmdLabel":        {"ID", "Name"},
+	"djmdKey":          {"ID"},
+}
+
+// bookkeepingTables are the tables queries read bookkeeping columns
+// from, which some schemas lack.
+var bookkeepingTables = []string{
+	"djmdContent", "djmdPlaylist", "djmdSongPlaylist", "djmdMyTag", "djmdSongMyTag", "djmdCue",
+}
+
+// bookkeepingColumns are the columns tableColumns covers.
+var bookkeepingColumns = []string{"rb_local_deleted", "rb_local_usn", "created_at", "updated_at"}
+
+// tableColumns holds the SQL for the bookkeeping columns of a table in a
+// query, with constants in place of columns the schema lacks.
+type tableColumns struct {
+	Live      string // Condition matching rows that aren't deleted
+	Deleted   string // rb_local_deleted
+	USN       string // rb_local_usn
+	CreatedAt string // created_at
+	UpdatedAt string // updated_at
+}
+
+// table returns the bookkeeping columns of table, qualified with alias
+// unless it is empty.
+func (s *Schema) table(table, alias string) tableColumns {
+	column := func(name, missing string) string {
+		switch {
+		case !s.HasColumn(table, name):
+			return missing
+		case alias == "":
+			return name
+		default:
+			return alias + "." + name
+		}
+	}
+
+	t := tableColumns{
+		Deleted:   column("rb_local_deleted", "0"),
+		USN:       column("rb_local_usn", "0"),
+		CreatedAt: column("created_at", "''"),
+		UpdatedAt: column("updated_at", "''"),
+	}
+	t.Live = t.Deleted + " = 0"
+	return t
+}
+
+// keyName returns the key name column of djmdKey qualified with alias, or
+// an empty string constant if the schema has none.
+func (s *Schema) keyName(alias string) string {
+	if s.keyColumn == "" {
+		return "''"
+	}
+	return alias + "." + s.keyColumn
+}
+
+// IncompatibleSchemaError is returned by New for databases whose schema
+// lacks tables or columns the package needs.
+type IncompatibleSchemaError struct {
+	Version string
+	Missing []string // Like "djmdContent.BPM"
+}
+
+func (e *IncompatibleSchemaError) Error() string {
+	version := e.Version
+	if version == "" {
+		version = "unknown"
+	}
+	return fmt.Sprintf("unsupported rekordbox database schema (version %s): missing %s",
+		version, strings.Join(e.Missing, ", "))
+}
+
+// Schema returns the schema detected when the database was opened.
+func (db *DB) Schema() *Schema {
+	return db.schema
+}
+
+// HasTable reports whether the database has table.
+func (s *Schema) HasTable(table string) bool {
+	return s.columns[table] != nil
+}
+
+// HasColumn reports whether table has column.
+func (s *Schema) HasColumn(table, column string) bool {
+	return s.columns[table][column]
+}
+
+// detectSchema reads the tables and columns of sqlDB, checks the package
+// can query them unless anySchema is set and records which optional
+// columns queries can use.
+func detectSchema(sqlDB *sql.DB, anySchema bool) (*Schema, error) {
+	rows, err := sqlDB.Query(`
+		SELECT m.name, c.name
+		FROM sqlite_master m
+		JOIN pragma_table_info(m.name) c
+		WHERE m.type = 'table'`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema: %w", err)
+	}
+	defer rows.Close()
+
+	s := &Schema{columns: make(map[string]map[string]bool)}
+	for rows.Next() {
+		var table, column string
+		if err := rows.Scan(&table, &column); err != nil {
+			return nil, fmt.Errorf("failed to scan schema row: %w", err)
+		}
+		if s.columns[table] == nil {
+			s.columns[table] = make(map[string]bool)
+		}
+		s.columns[table][column] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read schema: %w", err)
+	}
+
+	if s.HasColumn("djmdProperty", "DBVersion") {
+		var version sql.NullString
+		err := sqlDB.QueryRow(`SELECT DBVersion FROM djmdProperty LIMIT 1`).Scan(&version)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, fmt.Errorf("failed to read database version: %w", err)
+		}
+		s.Version = version.String
+	}
+
+	var missing []string
+	for table, columns := range requiredColumns {
+		if !s.HasTable(table) {
+			missing = append(missing, table)
+			continue
+		}
+		for _, column := range columns {
+			if !s.HasColumn(table, column) {
+				missing = append(missing, table+"."+column)
+			}
+		}
+	}
+	if len(missing) > 0 && !anySchema {
+		sort.Strings(missing)
+		return nil, &IncompatibleSchemaError{Version: s.Version, Missing: missing}
+	}
+
+	for _, column := range bookkeepingColumns {
+		var lacking []string
+		var present int
+		for _, table := range bookkeepingTables {
+			if !s.HasTable(table) {
+				continue
+			}
+			present++
+			if !s.HasColumn(table, column) {
+				lacking = append(lacking, table)
+			}
+		}
+		switch {
+		case len(lacking) == 0:
+		case len(lacking) == present:
+			s.Variants = append(s.Variants, "no "+column+" columns")
+		default:
+			s.Variants = append(s.Variants, "no "+column+" in "+strings.Join(lacking, ", "))
+		}
+	}
+
+	// Older schemas name the key column Name rather than ScaleName.
+	switch {
+	case s.HasColumn("djmdKey", "ScaleName"):
+		s.keyColumn = "ScaleName"
+	case s.HasColumn("djmdKey", "Name"):
+		s.keyColumn = "Name"
+		s.Variants = append(s.Variants, "djmdKey.Name instead of ScaleName")
+	default:
+		s.Variants = append(s.Variants, "no key names")
+	}
+
+	if !s.HasColumn("agentRegistry", "int_1") {
+		s.Variants = append(s.Variants, "no agentRegistry USN")
+	}
+
+	return s, nil
+}
+
+// query runs a query. Queries read columns not every schema has through
+// Schema.table.
+func (db *DB) query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return db.sqlDB.QueryContext(ctx, query, args...)
+}
+
+// queryRow runs a single-row query.
+func (db *DB) queryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return db.sqlDB.QueryRowContext(ctx, query, args...)
+}
+
+// WithAnySchema makes New open databases whose schema it doesn't support,
+// so their schema can still be inspected with Tables. Track and playlist
+// queries may fail on them.
+func WithAnySchema() Option {
+	return func(db *DB) {
+		db.anySchema = true
+	}
+}
+
+// Table describes a database table.
+type Table struct {
+	Name     string   `json:"name"`
+	Columns  []Column `json:"columns"`
+	Indexes  []Index  `json:"indexes"`
+	RowCount int64    `json:"row_count"`
+}
+
+// Column describes a table column.
+type Column struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	NotNull    bool   `json:"not_null,omitempty"`
+	PrimaryKey bool   `json:"primary_key,omitempty"`
+	Default    string `json:"default,omitempty"`
+}
+
+// Index describes a table index.
+type Index struct {
+	Name    string   `json:"name"`
+	Unique  bool     `json:"unique,omitempty"`
+	Columns []string `json:"columns"`
+}
+
+// Tables calls TablesContext with context.Background().
+func (db *DB) Tables() ([]Table, error) {
+	return db.TablesContext(context.Background())
+}
+
+// TablesContext returns every table in the database with its columns,
+// indexes and row count, ordered by name.
+func (db *DB) TablesContext(ctx context.Context) ([]Table, error) {
+	rows, err := db.sqlDB.QueryContext(ctx, `
+		SELECT name
+		FROM sqlite_master
+		WHERE type = 'table' AND name NOT LIKE 'sqlite_%'
+		ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tables: %w", err)
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan table row: %w", err)
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query tables: %w", err)
+	}
+
+	tables := make([]Table, 0, len(names))
+	for _, name := range names {
+		table, err := db.describeTable(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	return tables, nil
+}
+
+// DumpDatabaseSchema prints the database schema for tables, indexes, views, and triggers.
+//
+// Deprecated: Use Tables, which returns the schema instead of printing it.
+func (db *DB) DumpDatabaseSchema() error {
+	query := `
+		SELECT
+			type,
+			name,
+			sql
+		FROM sqlite_master
+		WHERE type IN ('table', 'index', 'view', 'trigger')`
+
+	rows, err := db.sqlDB.Query(query)
+	if err != nil {
+		return fmt.Errorf("failed to query schema: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var objType, name, sqlStmt sql.NullString
+		if err := rows.Scan(&objType, &name, &sqlStmt); err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		if objType.Valid && name.Valid && sqlStmt.Valid {
+			fmt.Printf("-- %s: %s\n%s;\n\n", objType.String, name.String, sqlStmt.String)
+		}
+	}
+
+	return rows.Err()
+}
+
+func (db *DB) describeTable(ctx context.Context, name string) (Table, error) {
+	table := Table{Name: name, Columns: []Column{}, Indexes: []Index{}}
+
+	rows, err := db.sqlDB.QueryContext(ctx, `
+		SELECT name, type, "notnull", COALESCE(dflt_value, ''), pk
+		FROM pragma_table_info(?)
+		ORDER BY cid`, name)
+	if err != nil {
+		return table, fmt.Errorf("failed to query columns of %s: %w", name, err)
+	}
+	for rows.Next() {
+		var c Column
+		var pk int
+		if err := rows.Scan(&c.Name, &c.Type, &c.NotNull, &c.Default, &pk); err != nil {
+			rows.Close()
+			return table, fmt.Errorf("failed to scan column row: %w", err)
+		}
+		c.PrimaryKey = pk > 0
+		table.Columns = append(table.Columns, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return table, fmt.Errorf("failed to query columns of %s: %w", name, err)
+	}
+
+	rows, err = db.sqlDB.QueryContext(ctx, `
+		SELECT l.name, l."unique", COALESCE(i.name, '')
+		FROM pragma_index_list(?) l
+		JOIN pragma_index_info(l.name) i
+		ORDER BY l.name, i.seqno`, name)
+	if err != nil {
+		return table, fmt.Errorf("failed to query indexes of %s: %w", name, err)
+	}
+	for rows.Next() {
+		var index, column string
+		var unique bool
+		if err := rows.Scan(&index, &unique, &column); err != nil {
+			rows.Close()
+			return table, fmt.Errorf("failed to scan index row: %w", err)
+		}
+		if n := len(table.Indexes); n == 0 || table.Indexes[n-1].Name != index {
+			table.Indexes = append(table.Indexes, Index{Name: index, Unique: unique})
+		}
+		last := &table.Indexes[len(table.Indexes)-1]
+		last.Columns = append(last.Columns, column)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return table, fmt.Errorf("failed to query indexes of %s: %w", name, err)
+	}
+
+	query := fmt.Sprintf(`SELECT count(*) FROM "%s"`, strings.ReplaceAll(name, `"`, `""`))
+	if err := db.sqlDB.QueryRowContext(ctx, query).Scan(&table.RowCount); err != nil {
+		return table, fmt.Errorf("failed to count rows of %s: %w", name, err)
+	}
+
+	return table, nil
+}
+
+// SchemaDiff lists the differences between two sets of tables.
+type SchemaDiff struct {
+	AddedTables   []Table     `json:"added_tables"`
+	RemovedTables []Table     `json:"removed_tables"`
+	ChangedTables []TableDiff `json:"changed_tables"`
+}
+
+// TableDiff lists the differences in a table present in both sets.
+type TableDiff struct {
+	Name           string         `json:"name"`
+	AddedColumns   []Column       `json:"added_columns,omitempty"`
+	RemovedColumns []Column       `json:"removed_columns,omitempty"`
+	ChangedColumns []ColumnChange `json:"changed_columns,omitempty"`
+	AddedIndexes   []Index        `json:"added_indexes,omitempty"`
+	RemovedIndexes []Index        `json:"removed_indexes,omitempty"`
+}
+
+// ColumnChange is a column whose type or constraints changed.
+type ColumnChange struct {
+	Old Column `json:"old"`
+	New Column `json:"new"`
+}
+
+// Empty reports whether the two sets of tables have the same schema.
+func (d *SchemaDiff) Empty() bool {
+	return len(d.AddedTables) == 0 && len(d.RemovedTables) == 0 && len(d.ChangedTables) == 0
+}
+
+// DiffTables compares the tables of two databases, as returned by Tables,
+// from before to after.
+// Row counts are ignored; an index whose definition changed is reported as
+// removed and added.
+func DiffTables(before, after []Table) *SchemaDiff {
+	diff := &SchemaDiff{
+		AddedTables:   []Table{},
+		RemovedTables: []Table{},
+		ChangedTables: []TableDiff{},
+	}
+
+	oldTables := make(map[string]Table)
+	for _, t := range before {
+		oldTables[t.Name] = t
+	}
+	newTables := make(map[string]bool)
+	for _, t := range after {
+		newTables[t.Name] = true
+		o, ok := oldTables[t.Name]
+		if !ok {
+			diff.AddedTables = append(diff.AddedTables, t)
+			continue
+		}
+		if td := diffTable(o, t); td != nil {
+			diff.ChangedTables = append(diff.ChangedTables, *td)
+		}
+	}
+	for _, t := range before {
+		if !newTables[t.Name] {
+			diff.RemovedTables = append(diff.RemovedTables, t)
+		}
+	}
+
+	return diff
+}
+
+func diffTable(before, after Table) *TableDiff {
+	td := &TableDiff{Name: after.Name}
+
+	oldColumns := make(map[string]Column)
+	for _, c := range before.Columns {
+		oldColumns[c.Name] = c
+	}
+	newColumns := make(map[string]bool)
+	for _, c := range after.Columns {
+		newColumns[c.Name] = true
+		o, ok := oldColumns[c.Name]
+		switch {
+		case !ok:
+			td.AddedColumns = append(td.AddedColumns, c)
+		case o != c:
+			td.ChangedColumns = append(td.ChangedColumns, ColumnChange{Old: o, New: c})
+		}
+	}
+	for _, c := range before.Columns {
+		if !newColumns[c.Name] {
+			td.RemovedColumns = append(td.RemovedColumns, c)
+		}
+	}
+
+	oldIndexes := make(map[string]Index)
+	for _, i := range before.Indexes {
+		oldIndexes[i.Name] = i
+	}
+	newIndexes := make(map[string]Index)
+	for _, i := range after.Indexes {
+		newIndexes[i.Name] = i
+		if o, ok := oldIndexes[i.Name]; !ok || !sameIndex(o, i) {
+			td.AddedIndexes = append(td.AddedIndexes, i)
+		}
+	}
+	for _, i := range before.Indexes {
+		if n, ok := newIndexes[i.Name]; !ok || !sameIndex(i, n) {
+			td.RemovedIndexes = append(td.RemovedIndexes, i)
+		}
+	}
+
+	if len(td.AddedColumns)+len(td.RemovedColumns)+len(td.ChangedColumns)+
+		len(td.AddedIndexes)+len(td.RemovedIndexes) == 0 {
+		return nil
+	}
+	return td
+}
+
+func sameIndex(a, b Index) bool {
+	return a.Unique == b.Unique && strings.Join(a.Columns, ",") == strings.Join(b.Columns, ",")
+}
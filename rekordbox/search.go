@@ -0,0 +1,175 @@
+package rekordbox
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/r-medina/rdbs/key"
+)
+
+// SearchFilters narrow SearchTracks results. Zero values don't filter.
+type SearchFilters struct {
+	MinBPM      float64
+	MaxBPM      float64
+	Key         string // In any notation key.Parse reads, like "Am" or "8A"
+	HarmonicKey bool   // Also match keys that mix harmonically with Key
+	MinRating   int
+	AddedAfter  time.Time // Inclusive
+	AddedBefore time.Time // Exclusive
+	Limit       int       // Maximum number of results
+}
+
+func (f SearchFilters) match(t FullTrack) bool {
+	bpm := t.Tempo()
+	switch {
+	case f.MinBPM > 0 && bpm < f.MinBPM:
+		return false
+	case f.MaxBPM > 0 && bpm > f.MaxBPM:
+		return false
+	case f.Key != "" && !f.matchKey(t):
+		return false
+	case t.Rating < f.MinRating:
+		return false
+	case !f.AddedAfter.IsZero() && t.DateCreated.Before(f.AddedAfter):
+		return false
+	case !f.AddedBefore.IsZero() && !t.DateCreated.Before(f.AddedBefore):
+		return false
+	}
+	return true
+}
+
+// matchKey compares the track's key with Key whatever notation either is
+// written in, falling back to comparing names that can't be parsed.
+func (f SearchFilters) matchKey(t FullTrack) bool {
+	want, err := key.Parse(f.Key)
+	have, ok := t.ParsedKey()
+	if err != nil || !ok {
+		return strings.EqualFold(t.Key, f.Key)
+	}
+	if f.HarmonicKey {
+		return want.CompatibleWith(have)
+	}
+	return want == have
+}
+
+// searchFields are the FullTrack fields SearchTracks matches text in,
+// with the weight a match in each adds to a track's score.
+var searchFields = []struct {
+	weight int
+	value  func(FullTrack) string
+}{
+	{4, func(t FullTrack) string { return t.Title }},
+	{3, func(t FullTrack) string { return t.Artist }},
+	{2, func(t FullTrack) string { return t.Album }},
+	{1, func(t FullTrack) string { return t.Label }},
+	{1, func(t FullTrack) string { return t.Genre }},
+	{1, func(t FullTrack) string { return t.Comments }},
+}
+
+// SearchIndex is an in-memory index of tracks for text search.
+type SearchIndex struct {
+	tracks []FullTrack
+	fields [][]string // Lowercased searchFields of each track
+}
+
+// NewSearchIndex indexes tracks.
+func NewSearchIndex(tracks []FullTrack) *SearchIndex {
+	idx := &SearchIndex{tracks: tracks, fields: make([][]string, len(tracks))}
+	for i, t := range tracks {
+		fields := make([]string, len(searchFields))
+		for j, f := range searchFields {
+			fields[j] = strings.ToLower(f.value(t))
+		}
+		idx.fields[i] = fields
+	}
+	return idx
+}
+
+// Search returns the tracks matching every word of query in their title,
+// artist, album, label, genre or comments, and filters. Tracks with more
+// matches in more important fields come first. An empty query matches
+// every track.
+func (idx *SearchIndex) Search(query string, filters SearchFilters) []FullTrack {
+	terms := strings.Fields(strings.ToLower(query))
+
+	type hit struct {
+		track FullTrack
+		score int
+	}
+	var hits []hit
+	for i, t := range idx.tracks {
+		if !filters.match(t) {
+			continue
+		}
+		score, ok := idx.score(i, terms)
+		if ok {
+			hits = append(hits, hit{t, score})
+		}
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].score != hits[j].score {
+			return hits[i].score > hits[j].score
+		}
+		a, b := hits[i].track, hits[j].track
+		if a.Artist != b.Artist {
+			return a.Artist < b.Artist
+		}
+		return a.Title < b.Title
+	})
+
+	if filters.Limit > 0 && len(hits) > filters.Limit {
+		hits = hits[:filters.Limit]
+	}
+
+	tracks := make([]FullTrack, len(hits))
+	for i, h := range hits {
+		tracks[i] = h.track
+	}
+	return tracks
+}
+
+// score reports whether every term occurs in track i and how well it
+// matched.
+func (idx *SearchIndex) score(i int, terms []string) (int, bool) {
+	total := 0
+	for _, term := range terms {
+		matched := false
+		for j, field := range idx.fields[i] {
+			if strings.Contains(field, term) {
+				total += searchFields[j].weight
+				matched = true
+			}
+		}
+		if !matched {
+			return 0, false
+		}
+	}
+	return total, true
+}
+
+// SearchTracks calls SearchTracksContext with context.Background().
+func (db *DB) SearchTracks(query string, filters SearchFilters) ([]FullTrack, error) {
+	return db.SearchTracksContext(context.Background(), query, filters)
+}
+
+// SearchTracksContext searches the collection as SearchIndex.Search does.
+// The index is built on the first search and reused by later ones, so
+// they don't see tracks changed since.
+func (db *DB) SearchTracksContext(ctx context.Context, query string, filters SearchFilters) ([]FullTrack, error) {
+	db.searchMu.Lock()
+	defer db.searchMu.Unlock()
+
+	if db.searchIndex == nil {
+		tracks, err := db.GetAllTracksContext(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build search index: %w", err)
+		}
+		db.searchIndex = NewSearchIndex(tracks)
+	}
+
+	return db.searchIndex.Search(query, filters), nil
+}
@@ -0,0 +1,411 @@
+package rekordbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SmartList holds the conditions of a smart playlist, stored as XML in
+// djmdPlaylist.SmartList. Groups are nested conditions, which newer
+// Rekordbox versions allow.
+type SmartList struct {
+	All        bool // Whether every condition must match rather than any
+	Conditions []SmartCondition
+	Groups     []*SmartList
+}
+
+// SmartCondition is a single smart playlist rule.
+type SmartCondition struct {
+	Property string // Such as "genre" or "bpm"
+	Operator int
+	Unit     string // Unit of Left for "in the last" rules, like "day"
+	Left     string
+	Right    string // Upper bound of range rules
+}
+
+// Smart playlist operators.
+const (
+	smartEqual       = 1
+	smartNotEqual    = 2
+	smartGreater     = 3
+	smartLess        = 4
+	smartInRange     = 5
+	smartInLast      = 6
+	smartNotInLast   = 7
+	smartContains    = 8
+	smartNotContains = 9
+	smartStartsWith  = 10
+	smartEndsWith    = 11
+)
+
+// smartProperties lists the properties conditions can be evaluated on and
+// how to compare them.
+var smartProperties = map[string]string{
+	"artist":      "text",
+	"album":       "text",
+	"albumArtist": "text",
+	"comments":    "text",
+	"genre":       "text",
+	"key":         "text",
+	"label":       "text",
+	"title":       "text",
+	"fileName":    "text",
+	"fileType":    "text",
+	"bpm":         "number",
+	"rating":      "number",
+	"duration":    "number",
+	"trackNumber": "number",
+	"releaseYear": "number",
+	"year":        "number",
+	"dateCreated": "date",
+	"myTag":       "tag",
+}
+
+type smartNode struct {
+	LogicalOperator int              `xml:"LogicalOperator,attr"`
+	Conditions      []smartCondition `xml:"CONDITION"`
+	Nodes           []smartNode      `xml:"NODE"`
+}
+
+type smartCondition struct {
+	PropertyName string `xml:"PropertyName,attr"`
+	Operator     int    `xml:"Operator,attr"`
+	ValueUnit    string `xml:"ValueUnit,attr"`
+	ValueLeft    string `xml:"ValueLeft,attr"`
+	ValueRight   string `xml:"ValueRight,attr"`
+}
+
+// ParseSmartList parses the XML of a smart playlist.
+func ParseSmartList(data string) (*SmartList, error) {
+	var node smartNode
+	if err := xml.Unmarshal([]byte(data), &node); err != nil {
+		return nil, fmt.Errorf("failed to parse smart list: %w", err)
+	}
+	return newSmartList(node), nil
+}
+
+func newSmartList(node smartNode) *SmartList {
+	list := &SmartList{All: node.LogicalOperator != 2}
+	for _, c := range node.Conditions {
+		list.Conditions = append(list.Conditions, SmartCondition{
+			Property: c.PropertyName,
+			Operator: c.Operator,
+			Unit:     c.ValueUnit,
+			Left:     c.ValueLeft,
+			Right:    c.ValueRight,
+		})
+	}
+	for _, n := range node.Nodes {
+		list.Groups = append(list.Groups, newSmartList(n))
+	}
+	return list
+}
+
+// Validate returns an error if l has a condition on a property FullTrack
+// doesn't carry, such as play count or remixer, which Match can't evaluate.
+func (l *SmartList) Validate() error {
+	for _, c := range l.Conditions {
+		if _, ok := smartProperties[c.Property]; !ok {
+			return fmt.Errorf("unsupported smart list property %q", c.Property)
+		}
+		if c.Operator < smartEqual || c.Operator > smartEndsWith {
+			return fmt.Errorf("unsupported smart list operator %d on %q", c.Operator, c.Property)
+		}
+	}
+	for _, g := range l.Groups {
+		if err := g.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// usesMyTags reports whether any condition in l is on My Tags.
+func (l *SmartList) usesMyTags() bool {
+	for _, c := range l.Conditions {
+		if c.Property == "myTag" {
+			return true
+		}
+	}
+	for _, g := range l.Groups {
+		if g.usesMyTags() {
+			return true
+		}
+	}
+	return false
+}
+
+// Match reports whether track satisfies l. tags holds the IDs of the My
+// Tags on the track and now is the time "in the last" rules count back
+// from.
+func (l *SmartList) Match(track FullTrack, tags map[string]bool, now time.Time) bool {
+	n := len(l.Conditions) + len(l.Groups)
+	if n == 0 {
+		return false
+	}
+
+	matched := 0
+	for _, c := range l.Conditions {
+		if c.match(track, tags, now) {
+			matched++
+		} else if l.All {
+			return false
+		}
+	}
+	for _, g := range l.Groups {
+		if g.Match(track, tags, now) {
+			matched++
+		} else if l.All {
+			return false
+		}
+	}
+
+	return matched > 0
+}
+
+func (c SmartCondition) match(track FullTrack, tags map[string]bool, now time.Time) bool {
+	switch smartProperties[c.Property] {
+	case "text":
+		return c.matchText(smartText(track, c.Property))
+	case "number":
+		return c.matchNumber(smartNumber(track, c.Property))
+	case "date":
+		return c.matchDate(track.DateCreated, now)
+	case "tag":
+		switch c.Operator {
+		case smartEqual:
+			return tags[c.Left]
+		case smartNotEqual:
+			return !tags[c.Left]
+		}
+	}
+	return false
+}
+
+func smartText(track FullTrack, property string) string {
+	switch property {
+	case "artist":
+		return track.Artist
+	case "album":
+		return track.Album
+	case "albumArtist":
+		return track.AlbumArtist
+	case "comments":
+		return track.Comments
+	case "genre":
+		return track.Genre
+	case "key":
+		return track.Key
+	case "label":
+		return track.Label
+	case "title":
+		return track.Title
+	case "fileName":
+		return filepath.Base(track.FolderPath)
+	case "fileType":
+		return track.FileType
+	}
+	return ""
+}
+
+func smartNumber(track FullTrack, property string) float64 {
+	switch property {
+	case "bpm":
+		return track.Tempo()
+	case "rating":
+		return float64(track.Rating)
+	case "duration":
+		return float64(track.Length)
+	case "trackNumber":
+		return float64(track.TrackNumber)
+	case "releaseYear", "year":
+		return float64(track.Year)
+	}
+	return 0
+}
+
+func (c SmartCondition) matchText(value string) bool {
+	value = strings.ToLower(value)
+	want := strings.ToLower(c.Left)
+
+	switch c.Operator {
+	case smartEqual:
+		return value == want
+	case smartNotEqual:
+		return value != want
+	case smartContains:
+		return strings.Contains(value, want)
+	case smartNotContains:
+		return !strings.Contains(value, want)
+	case smartStartsWith:
+		return strings.HasPrefix(value, want)
+	case smartEndsWith:
+		return strings.HasSuffix(value, want)
+	}
+	return false
+}
+
+func (c SmartCondition) matchNumber(value float64) bool {
+	left, err := strconv.ParseFloat(c.Left, 64)
+	if err != nil {
+		return false
+	}
+
+	switch c.Operator {
+	case smartEqual:
+		return value == left
+	case smartNotEqual:
+		return value != left
+	case smartGreater:
+		return value > left
+	case smartLess:
+		return value < left
+	case smartInRange:
+		right, err := strconv.ParseFloat(c.Right, 64)
+		return err == nil && value >= left && value <= right
+	}
+	return false
+}
+
+func (c SmartCondition) matchDate(value, now time.Time) bool {
+	if value.IsZero() {
+		return false
+	}
+	day := value.Truncate(24 * time.Hour)
+
+	switch c.Operator {
+	case smartInLast, smartNotInLast:
+		n, err := strconv.Atoi(c.Left)
+		if err != nil {
+			return false
+		}
+		var since time.Time
+		switch c.Unit {
+		case "week":
+			since = now.AddDate(0, 0, -7*n)
+		case "month":
+			since = now.AddDate(0, -n, 0)
+		case "year":
+			since = now.AddDate(-n, 0, 0)
+		default:
+			since = now.AddDate(0, 0, -n)
+		}
+		inLast := !value.Before(since)
+		return inLast == (c.Operator == smartInLast)
+	}
+
+	left, err := time.Parse("2006-01-02", c.Left)
+	if err != nil {
+		return false
+	}
+
+	switch c.Operator {
+	case smartEqual:
+		return day.Equal(left)
+	case smartNotEqual:
+		return !day.Equal(left)
+	case smartGreater:
+		return day.After(left)
+	case smartLess:
+		return day.Before(left)
+	case smartInRange:
+		right, err := time.Parse("2006-01-02", c.Right)
+		return err == nil && !day.Before(left) && !day.After(right)
+	}
+	return false
+}
+
+// GetSmartList calls GetSmartListContext with context.Background().
+func (db *DB) GetSmartList(playlistID string) (*SmartList, error) {
+	return db.GetSmartListContext(context.Background(), playlistID)
+}
+
+// GetSmartListContext retrieves the conditions of a smart playlist.
+func (db *DB) GetSmartListContext(ctx context.Context, playlistID string) (*SmartList, error) {
+	var data sql.NullString
+	p := db.schema.table("djmdPlaylist", "")
+	err := db.queryRow(ctx, `
+		SELECT SmartList
+		FROM djmdPlaylist
+		WHERE ID = ? AND Attribute = 4 AND `+p.Live, playlistID).Scan(&data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get smart playlist %s: %w", playlistID, err)
+	}
+	if !data.Valid || data.String == "" {
+		return nil, fmt.Errorf("smart playlist %s has no conditions", playlistID)
+	}
+	return ParseSmartList(data.String)
+}
+
+// GetSmartPlaylistTracks calls GetSmartPlaylistTracksContext with context.Background().
+func (db *DB) GetSmartPlaylistTracks(playlistID string) ([]FullTrack, error) {
+	return db.GetSmartPlaylistTracksContext(context.Background(), playlistID)
+}
+
+// GetSmartPlaylistTracksContext evaluates a smart playlist against the
+// collection and returns the matching tracks. Rekordbox doesn't store the
+// tracks of smart playlists, so GetPlaylistTracksDetailed returns none for
+// them.
+func (db *DB) GetSmartPlaylistTracksContext(ctx context.Context, playlistID string) ([]FullTrack, error) {
+	list, err := db.GetSmartListContext(ctx, playlistID)
+	if err != nil {
+		return nil, err
+	}
+	if err := list.Validate(); err != nil {
+		return nil, fmt.Errorf("smart playlist %s: %w", playlistID, err)
+	}
+
+	tracks, err := db.GetAllTracksContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tags map[string]map[string]bool
+	if list.usesMyTags() {
+		if tags, err = db.getTrackMyTags(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	var matched []FullTrack
+	for _, track := range tracks {
+		if list.Match(track, tags[track.ID], now) {
+			matched = append(matched, track)
+		}
+	}
+	return matched, nil
+}
+
+// getTrackMyTags maps content IDs to the IDs of their My Tags.
+func (db *DB) getTrackMyTags(ctx context.Context) (map[string]map[string]bool, error) {
+	st := db.schema.table("djmdSongMyTag", "")
+	rows, err := db.query(ctx, `
+		SELECT ContentID, MyTagID
+		FROM djmdSongMyTag
+		WHERE `+st.Live)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get track my tags: %w", err)
+	}
+	defer rows.Close()
+
+	tags := make(map[string]map[string]bool)
+	for rows.Next() {
+		var contentID, tagID string
+		if err := rows.Scan(&contentID, &tagID); err != nil {
+			return nil, fmt.Errorf("failed to scan my tag row: %w", err)
+		}
+		if tags[contentID] == nil {
+			tags[contentID] = make(map[string]bool)
+		}
+		tags[contentID][tagID] = true
+	}
+
+	return tags, rows.Err()
+}
@@ -0,0 +1,37 @@
+package rekordbox
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// WithSnapshot makes New copy the database to a temporary directory and
+// read the copy, so a running Rekordbox can keep writing to the original
+// undisturbed. Close removes the copy.
+func WithSnapshot() Option {
+	return func(db *DB) {
+		db.snapshot = true
+	}
+}
+
+// snapshot copies the database open as sqlDB into a new temporary
+// directory with VACUUM INTO and returns the path of the copy. SQLite
+// reads the database in a single transaction, so the copy is consistent
+// even while Rekordbox writes to it, and includes what is still in the
+// write-ahead log. The copy is encrypted with the same key.
+func snapshot(ctx context.Context, sqlDB *sql.DB, path string) (string, error) {
+	dir, err := os.MkdirTemp("", "rekordbox-snapshot-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+
+	file := filepath.Join(dir, filepath.Base(path))
+	if _, err := sqlDB.ExecContext(ctx, "VACUUM INTO ?", file); err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("failed to snapshot %s: %w", path, err)
+	}
+	return file, nil
+}
@@ -0,0 +1,200 @@
+package rekordbox
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Stats summarizes a set of tracks.
+type Stats struct {
+	Tracks        int         `json:"tracks"`
+	Length        int         `json:"length_seconds"` // Total, in seconds
+	BPM           []BPMBucket `json:"bpm"`
+	NoBPM         int         `json:"no_bpm"` // Tracks that haven't been analyzed
+	Keys          []Count     `json:"keys"`
+	Genres        []Count     `json:"genres"`
+	Labels        []Count     `json:"labels"`
+	Artists       []Count     `json:"artists"`
+	FileTypes     []Count     `json:"file_types"`
+	Ratings       [6]int      `json:"ratings"`         // Tracks with each number of stars, from 0
+	AddedPerMonth []Count     `json:"added_per_month"` // Months as "2006-01", oldest first
+}
+
+// Duration returns the total length of the tracks.
+func (s Stats) Duration() time.Duration {
+	return time.Duration(s.Length) * time.Second
+}
+
+// Count is how many tracks have a value.
+type Count struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// BPMBucket counts tracks with a tempo from Min up to, but not including,
+// Max.
+type BPMBucket struct {
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Count int     `json:"count"`
+}
+
+// StatsOptions configure NewStats.
+type StatsOptions struct {
+	// Top is how many genres, labels and artists are kept. Zero uses
+	// DefaultStatsTop; negative keeps all of them.
+	Top int
+	// BPMStep is the width of the BPM buckets. Zero uses DefaultBPMStep.
+	BPMStep float64
+}
+
+// Defaults for StatsOptions.
+const (
+	DefaultStatsTop = 10
+	DefaultBPMStep  = 5
+)
+
+// NewStats summarizes tracks. Counts are sorted most common first, except
+// for BPM buckets and months, which are in order and include the empty
+// ones in between. Tracks without a value aren't counted for it. Keys are
+// counted in musical notation whatever notation they're stored in.
+func NewStats(tracks []FullTrack, opts StatsOptions) Stats {
+	if opts.Top == 0 {
+		opts.Top = DefaultStatsTop
+	}
+	if opts.BPMStep <= 0 {
+		opts.BPMStep = DefaultBPMStep
+	}
+
+	s := Stats{Tracks: len(tracks), BPM: []BPMBucket{}}
+	keys := make(map[string]int)
+	genres := make(map[string]int)
+	labels := make(map[string]int)
+	artists := make(map[string]int)
+	fileTypes := make(map[string]int)
+	months := make(map[string]int)
+	bpms := make(map[int]int) // Bucket index
+	minBucket, maxBucket := -1, -1
+
+	for _, t := range tracks {
+		s.Length += t.Length
+		if k, ok := t.ParsedKey(); ok {
+			keys[k.String()]++
+		} else {
+			countValue(keys, t.Key)
+		}
+		countValue(genres, t.Genre)
+		countValue(labels, t.Label)
+		countValue(artists, t.Artist)
+		countValue(fileTypes, fileTypeName(t))
+
+		if t.Tempo() > 0 {
+			b := int(t.Tempo() / opts.BPMStep)
+			bpms[b]++
+			if minBucket < 0 || b < minBucket {
+				minBucket = b
+			}
+			if b > maxBucket {
+				maxBucket = b
+			}
+		} else {
+			s.NoBPM++
+		}
+
+		rating := t.Rating
+		if rating < 0 {
+			rating = 0
+		} else if rating > 5 {
+			rating = 5
+		}
+		s.Ratings[rating]++
+
+		if !t.DateCreated.IsZero() {
+			months[t.DateCreated.Format("2006-01")]++
+		}
+	}
+
+	if minBucket >= 0 {
+		for b := minBucket; b <= maxBucket; b++ {
+			s.BPM = append(s.BPM, BPMBucket{
+				Min:   float64(b) * opts.BPMStep,
+				Max:   float64(b+1) * opts.BPMStep,
+				Count: bpms[b],
+			})
+		}
+	}
+
+	s.Keys = sortCounts(keys, -1)
+	s.Genres = sortCounts(genres, opts.Top)
+	s.Labels = sortCounts(labels, opts.Top)
+	s.Artists = sortCounts(artists, opts.Top)
+	s.FileTypes = sortCounts(fileTypes, -1)
+	s.AddedPerMonth = monthCounts(months)
+
+	return s
+}
+
+func countValue(counts map[string]int, value string) {
+	if value = strings.TrimSpace(value); value != "" {
+		counts[value]++
+	}
+}
+
+// fileTypeName names a track's file type by its extension, which is more
+// readable than the FileType code.
+func fileTypeName(t FullTrack) string {
+	if ext := strings.TrimPrefix(filepath.Ext(t.FolderPath), "."); ext != "" {
+		return strings.ToUpper(ext)
+	}
+	return t.FileType
+}
+
+// sortCounts returns the top most common values in counts, or all of them
+// if top is negative.
+func sortCounts(counts map[string]int, top int) []Count {
+	sorted := make([]Count, 0, len(counts))
+	for name, n := range counts {
+		sorted = append(sorted, Count{Name: name, Count: n})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Count != sorted[j].Count {
+			return sorted[i].Count > sorted[j].Count
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	if top >= 0 && len(sorted) > top {
+		sorted = sorted[:top]
+	}
+	return sorted
+}
+
+// monthCounts returns counts of "2006-01" months from the first to the
+// last, including months without any.
+func monthCounts(counts map[string]int) []Count {
+	if len(counts) == 0 {
+		return []Count{}
+	}
+
+	var first, last time.Time
+	for name := range counts {
+		m, err := time.Parse("2006-01", name)
+		if err != nil {
+			continue
+		}
+		if first.IsZero() || m.Before(first) {
+			first = m
+		}
+		if m.After(last) {
+			last = m
+		}
+	}
+
+	months := []Count{}
+	for m := first; !m.After(last); m = m.AddDate(0, 1, 0) {
+		name := m.Format("2006-01")
+		months = append(months, Count{Name: name, Count: counts[name]})
+	}
+	return months
+}
@@ -0,0 +1,104 @@
+package rekordbox
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// GetPlaylistIDsForTracks calls GetPlaylistIDsForTracksContext with
+// context.Background().
+func (db *DB) GetPlaylistIDsForTracks(contentIDs []string) (map[string][]string, error) {
+	return db.GetPlaylistIDsForTracksContext(context.Background(), contentIDs)
+}
+
+// GetPlaylistIDsForTracksContext maps each of contentIDs to the IDs of
+// the playlists containing it. Tracks in no playlist are left out.
+func (db *DB) GetPlaylistIDsForTracksContext(ctx context.Context, contentIDs []string) (map[string][]string, error) {
+	playlists := make(map[string][]string)
+	sp := db.schema.table("djmdSongPlaylist", "sp")
+	p := db.schema.table("djmdPlaylist", "p")
+
+	// Stay well below SQLite's limit on query parameters.
+	const batch = 500
+	for start := 0; start < len(contentIDs); start += batch {
+		ids := contentIDs[start:min(start+batch, len(contentIDs))]
+		args := make([]interface{}, len(ids))
+		for i, id := range ids {
+			args[i] = id
+		}
+
+		query := `
+			SELECT DISTINCT sp.ContentID, sp.PlaylistID
+			FROM djmdSongPlaylist sp
+			JOIN djmdPlaylist p ON sp.PlaylistID = p.ID
+			WHERE sp.ContentID IN (?` + strings.Repeat(", ?", len(ids)-1) + `)
+				AND ` + sp.Live + ` AND ` + p.Live + `
+			ORDER BY sp.ContentID, p.Seq`
+
+		rows, err := db.query(ctx, query, args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get playlists for tracks: %w", err)
+		}
+		for rows.Next() {
+			var contentID, playlistID string
+			if err := rows.Scan(&contentID, &playlistID); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan playlist row: %w", err)
+			}
+			playlists[contentID] = append(playlists[contentID], playlistID)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to get playlists for tracks: %w", err)
+		}
+	}
+
+	return playlists, nil
+}
+
+// GetPlaylistsForTrack calls GetPlaylistsForTrackContext with
+// context.Background().
+func (db *DB) GetPlaylistsForTrack(contentID string) ([]*FullPlaylist, error) {
+	return db.GetPlaylistsForTrackContext(context.Background(), contentID)
+}
+
+// GetPlaylistsForTrackContext returns the playlists containing a track,
+// with their Path set.
+func (db *DB) GetPlaylistsForTrackContext(ctx context.Context, contentID string) ([]*FullPlaylist, error) {
+	playlists, err := db.GetPlaylistsForTracksContext(ctx, []string{contentID})
+	if err != nil {
+		return nil, err
+	}
+	return playlists[contentID], nil
+}
+
+// GetPlaylistsForTracks calls GetPlaylistsForTracksContext with
+// context.Background().
+func (db *DB) GetPlaylistsForTracks(contentIDs []string) (map[string][]*FullPlaylist, error) {
+	return db.GetPlaylistsForTracksContext(context.Background(), contentIDs)
+}
+
+// GetPlaylistsForTracksContext maps each of contentIDs to the playlists
+// containing it, with their Path set. Tracks in no playlist are left out.
+func (db *DB) GetPlaylistsForTracksContext(ctx context.Context, contentIDs []string) (map[string][]*FullPlaylist, error) {
+	ids, err := db.GetPlaylistIDsForTracksContext(ctx, contentIDs)
+	if err != nil {
+		return nil, err
+	}
+	hierarchy, err := db.GetPlaylistHierarchyContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	playlists := make(map[string][]*FullPlaylist)
+	for contentID, playlistIDs := range ids {
+		for _, id := range playlistIDs {
+			// Playlists under a deleted folder aren't in the hierarchy
+			if node := hierarchy.Find(id); node != nil {
+				playlists[contentID] = append(playlists[contentID], node.Playlist)
+			}
+		}
+	}
+	return playlists, nil
+}
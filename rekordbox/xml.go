@@ -0,0 +1,235 @@
+package rekordbox
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type xmlDocument struct {
+	XMLName    xml.Name      `xml:"DJ_PLAYLISTS"`
+	Version    string        `xml:"Version,attr"`
+	Product    xmlProduct    `xml:"PRODUCT"`
+	Collection xmlCollection `xml:"COLLECTION"`
+	Playlists  xmlNode       `xml:"PLAYLISTS>NODE"`
+}
+
+type xmlProduct struct {
+	Name    string `xml:"Name,attr"`
+	Version string `xml:"Version,attr"`
+	Company string `xml:"Company,attr"`
+}
+
+type xmlCollection struct {
+	Entries int        `xml:"Entries,attr"`
+	Tracks  []xmlTrack `xml:"TRACK"`
+}
+
+type xmlTrack struct {
+	TrackID     int               `xml:"TrackID,attr"`
+	Name        string            `xml:"Name,attr"`
+	Artist      string            `xml:"Artist,attr"`
+	Album       string            `xml:"Album,attr"`
+	Genre       string            `xml:"Genre,attr"`
+	Kind        string            `xml:"Kind,attr,omitempty"`
+	TotalTime   int               `xml:"TotalTime,attr"`
+	DiscNumber  int               `xml:"DiscNumber,attr"`
+	TrackNumber int               `xml:"TrackNumber,attr"`
+	Year        int               `xml:"Year,attr,omitempty"`
+	AverageBpm  string            `xml:"AverageBpm,attr"`
+	DateAdded   string            `xml:"DateAdded,attr,omitempty"`
+	Rating      int               `xml:"Rating,attr"`
+	Location    string            `xml:"Location,attr"`
+	Tonality    string            `xml:"Tonality,attr"`
+	Label       string            `xml:"Label,attr"`
+	Marks       []xmlPositionMark `xml:"POSITION_MARK"`
+}
+
+type xmlPositionMark struct {
+	Name  string `xml:"Name,attr"`
+	Type  int    `xml:"Type,attr"`
+	Start string `xml:"Start,attr"`
+	End   string `xml:"End,attr,omitempty"`
+	Num   int    `xml:"Num,attr"`
+}
+
+type xmlNode struct {
+	Type     int           `xml:"Type,attr"`
+	Name     string        `xml:"Name,attr"`
+	Count    *int          `xml:"Count,attr"`
+	KeyType  *int          `xml:"KeyType,attr"`
+	Entries  *int          `xml:"Entries,attr"`
+	Children []*xmlNode    `xml:"NODE"`
+	Tracks   []xmlTrackRef `xml:"TRACK"`
+}
+
+type xmlTrackRef struct {
+	Key int `xml:"Key,attr"`
+}
+
+const (
+	xmlNodeFolder   = 0
+	xmlNodePlaylist = 1
+)
+
+// WriteXML writes playlists as a Rekordbox XML library that can be imported
+// with "Import playlist" in Rekordbox. Each playlist's Path places it in the
+// folder hierarchy; playlists without a Path are placed at the root. Tracks
+// are identified by ID, or by FolderPath when they have no ID.
+func WriteXML(w io.Writer, playlists []*FullPlaylist) error {
+	doc := xmlDocument{
+		Version: "1.0.0",
+		Product: xmlProduct{Name: "rdbs", Version: "1.0.0", Company: "rdbs"},
+	}
+
+	root := &xmlNode{Type: xmlNodeFolder, Name: "ROOT"}
+	trackIDs := make(map[string]int)
+
+	for _, playlist := range playlists {
+		path := playlist.Path
+		if len(path) == 0 {
+			path = []string{playlist.Name}
+		}
+
+		parent := root
+		for _, folder := range path[:len(path)-1] {
+			parent = parent.folder(folder)
+		}
+
+		node := &xmlNode{Type: xmlNodePlaylist, Name: path[len(path)-1], KeyType: new(int)}
+		for _, track := range playlist.Tracks {
+			key := track.ID
+			if key == "" {
+				key = track.FolderPath
+			}
+
+			id, exists := trackIDs[key]
+			if !exists {
+				id = len(doc.Collection.Tracks) + 1
+				trackIDs[key] = id
+				doc.Collection.Tracks = append(doc.Collection.Tracks, newXMLTrack(id, track))
+			}
+			node.Tracks = append(node.Tracks, xmlTrackRef{Key: id})
+		}
+		entries := len(node.Tracks)
+		node.Entries = &entries
+		parent.Children = append(parent.Children, node)
+	}
+
+	root.setCounts()
+	doc.Collection.Entries = len(doc.Collection.Tracks)
+	doc.Playlists = *root
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return fmt.Errorf("failed to write xml header: %w", err)
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("failed to encode rekordbox xml: %w", err)
+	}
+	return enc.Flush()
+}
+
+// folder returns the child folder with the given name, creating it if needed.
+func (n *xmlNode) folder(name string) *xmlNode {
+	for _, child := range n.Children {
+		if child.Type == xmlNodeFolder && child.Name == name {
+			return child
+		}
+	}
+	child := &xmlNode{Type: xmlNodeFolder, Name: name}
+	n.Children = append(n.Children, child)
+	return child
+}
+
+func (n *xmlNode) setCounts() {
+	if n.Type != xmlNodeFolder {
+		return
+	}
+	count := len(n.Children)
+	n.Count = &count
+	for _, child := range n.Children {
+		child.setCounts()
+	}
+}
+
+func newXMLTrack(id int, track FullTrack) xmlTrack {
+	t := xmlTrack{
+		TrackID:     id,
+		Name:        track.Title,
+		Artist:      track.Artist,
+		Album:       track.Album,
+		Genre:       track.Genre,
+		Kind:        fileKind(track.FolderPath),
+		TotalTime:   track.Length,
+		DiscNumber:  track.DiscNumber,
+		TrackNumber: track.TrackNumber,
+		Year:        track.Year,
+		AverageBpm:  strconv.FormatFloat(track.Tempo(), 'f', 2, 64),
+		Rating:      ratingToXML(track.Rating),
+		Location:    fileURL(track.FolderPath),
+		Tonality:    track.Key,
+		Label:       track.Label,
+	}
+	if !track.DateCreated.IsZero() {
+		t.DateAdded = track.DateCreated.Format("2006-01-02")
+	}
+
+	for _, cue := range track.Cues {
+		mark := xmlPositionMark{
+			Name:  cue.Comment,
+			Start: formatSeconds(cue.InMsec),
+			Num:   cue.HotCueIndex(),
+		}
+		if cue.IsLoop() {
+			mark.Type = 4
+			mark.End = formatSeconds(cue.OutMsec)
+		}
+		t.Marks = append(t.Marks, mark)
+	}
+
+	return t
+}
+
+// ratingToXML converts a 0-5 star rating into the 0-255 scale Rekordbox
+// XML uses.
+func ratingToXML(stars int) int {
+	if stars < 0 {
+		return 0
+	}
+	if stars > 5 {
+		stars = 5
+	}
+	return stars * 51
+}
+
+func formatSeconds(msec int) string {
+	return strconv.FormatFloat(float64(msec)/1000, 'f', 3, 64)
+}
+
+// fileURL converts a local path into the file://localhost/ URLs Rekordbox
+// XML uses for track locations.
+func fileURL(path string) string {
+	if path == "" {
+		return ""
+	}
+	path = filepath.ToSlash(path)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path // Windows drive letters
+	}
+	u := url.URL{Scheme: "file", Host: "localhost", Path: path}
+	return u.String()
+}
+
+func fileKind(path string) string {
+	ext := strings.TrimPrefix(strings.ToUpper(filepath.Ext(path)), ".")
+	if ext == "" {
+		return ""
+	}
+	return ext + " File"
+}
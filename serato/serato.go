@@ -0,0 +1,342 @@
+// Package serato reads and writes Serato crate files.
+//
+// A crate is a sequence of tagged fields: a four byte ASCII tag, a big
+// endian uint32 length and the payload. Fields whose tag starts with 'o'
+// contain further fields, fields starting with 't' or 'p' contain UTF-16BE
+// text and fields starting with 'b' contain a single byte.
+package serato
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/r-medina/rdbs/rekordbox"
+)
+
+const (
+	// DirName is the directory Serato keeps its library in at the root of
+	// every drive.
+	DirName = "_Serato_"
+	// SubcratesDir holds the crate files inside DirName.
+	SubcratesDir = "Subcrates"
+	// CrateExt is the file extension of crate files.
+	CrateExt = ".crate"
+
+	crateVersion   = "1.0/Serato ScratchLive Crate"
+	crateSeparator = "%%"
+)
+
+// DefaultColumns are the columns shown in crates written by this package.
+var DefaultColumns = []string{"song", "artist", "album", "length", "bpm", "key"}
+
+// Crate is a Serato crate.
+type Crate struct {
+	Path    []string // Crate names from the top level crate down
+	Columns []string
+	Tracks  []string // Track paths relative to the drive root
+}
+
+// FileName returns the crate's file name, e.g. "House%%Deep.crate".
+func (c *Crate) FileName() string {
+	names := make([]string, len(c.Path))
+	for i, name := range c.Path {
+		// Serato uses %% to separate levels and names become file names,
+		// so no % run may be left next to a separator.
+		for strings.Contains(name, crateSeparator) {
+			name = strings.ReplaceAll(name, crateSeparator, "%")
+		}
+		if i > 0 {
+			name = strings.TrimPrefix(name, "%")
+		}
+		if i < len(c.Path)-1 {
+			name = strings.TrimSuffix(name, "%")
+		}
+		name = strings.ReplaceAll(name, "/", "-")
+		name = strings.ReplaceAll(name, `\`, "-")
+		names[i] = name
+	}
+	return strings.Join(names, crateSeparator) + CrateExt
+}
+
+// CrateFromPlaylist builds a crate from a Rekordbox playlist for a library
+// on volume (see Volume). Tracks without a file location are left out, and
+// tracks on other volumes are returned as skipped since a crate can only
+// reference files on its own drive.
+func CrateFromPlaylist(playlist *rekordbox.FullPlaylist, volume string) (crate *Crate, skipped []rekordbox.FullTrack) {
+	path := playlist.Path
+	if len(path) == 0 {
+		path = []string{playlist.Name}
+	}
+
+	crate = &Crate{Path: path, Columns: DefaultColumns}
+	for _, track := range playlist.Tracks {
+		if track.FolderPath == "" {
+			continue
+		}
+		file, ok := TrackPath(track.FolderPath, volume)
+		if !ok {
+			skipped = append(skipped, track)
+			continue
+		}
+		crate.Tracks = append(crate.Tracks, file)
+	}
+	return crate, skipped
+}
+
+// Volume returns the root of the drive an absolute path is on:
+// "/Volumes/<name>" for other drives on macOS, the drive letter on Windows
+// ("C:") and "/" otherwise.
+func Volume(path string) string {
+	path = strings.ReplaceAll(path, `\`, "/")
+	switch {
+	case len(path) >= 2 && path[1] == ':':
+		return strings.ToUpper(path[:2])
+	case strings.HasPrefix(path, "/Volumes/"):
+		rest := strings.TrimPrefix(path, "/Volumes/")
+		if i := strings.Index(rest, "/"); i >= 0 {
+			rest = rest[:i]
+		}
+		return "/Volumes/" + rest
+	}
+	return "/"
+}
+
+// TrackPath converts an absolute file path into the drive relative form
+// Serato stores in crates on volume: the volume is removed and separators
+// become forward slashes. It is false if file is on another volume.
+func TrackPath(file, volume string) (string, bool) {
+	file = strings.ReplaceAll(file, `\`, "/")
+	if !strings.EqualFold(Volume(file), volume) {
+		return "", false
+	}
+	if volume != "/" {
+		file = file[len(volume):]
+	}
+	return strings.TrimPrefix(file, "/"), true
+}
+
+// Write encodes the crate.
+func (c *Crate) Write(w io.Writer) error {
+	var buf bytes.Buffer
+
+	writeField(&buf, "vrsn", encodeText(crateVersion))
+
+	columns := c.Columns
+	if len(columns) == 0 {
+		columns = DefaultColumns
+	}
+
+	var sort bytes.Buffer
+	writeField(&sort, "tvcn", encodeText(columns[0]))
+	writeField(&sort, "brev", []byte{0})
+	writeField(&buf, "osrt", sort.Bytes())
+
+	for _, column := range columns {
+		var col bytes.Buffer
+		writeField(&col, "tvcn", encodeText(column))
+		writeField(&col, "tvcw", encodeText("0"))
+		writeField(&buf, "ovct", col.Bytes())
+	}
+
+	for _, track := range c.Tracks {
+		var trk bytes.Buffer
+		writeField(&trk, "ptrk", encodeText(track))
+		writeField(&buf, "otrk", trk.Bytes())
+	}
+
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write crate: %w", err)
+	}
+	return nil
+}
+
+// ReadCrate decodes a crate. The returned crate has no Path since crate
+// files do not store their own name; see ReadCrateFile.
+func ReadCrate(r io.Reader) (*Crate, error) {
+	data, err := io.ReadAll(bufio.NewReader(r))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read crate: %w", err)
+	}
+
+	fields, err := readFields(data)
+	if err != nil {
+		return nil, err
+	}
+
+	crate := new(Crate)
+	var version string
+	for _, field := range fields {
+		switch field.tag {
+		case "vrsn":
+			version = decodeText(field.data)
+		case "ovct":
+			children, err := readFields(field.data)
+			if err != nil {
+				return nil, err
+			}
+			for _, child := range children {
+				if child.tag == "tvcn" {
+					crate.Columns = append(crate.Columns, decodeText(child.data))
+				}
+			}
+		case "otrk":
+			children, err := readFields(field.data)
+			if err != nil {
+				return nil, err
+			}
+			for _, child := range children {
+				if child.tag == "ptrk" {
+					crate.Tracks = append(crate.Tracks, decodeText(child.data))
+				}
+			}
+		}
+	}
+
+	if !strings.Contains(version, "Crate") {
+		return nil, fmt.Errorf("not a crate file (version %q)", version)
+	}
+
+	return crate, nil
+}
+
+// ReadCrateFile reads the crate at path, deriving its Path from the file name.
+func ReadCrateFile(path string) (*Crate, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open crate %s: %w", path, err)
+	}
+	defer f.Close()
+
+	crate, err := ReadCrate(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read crate %s: %w", path, err)
+	}
+	crate.Path = strings.Split(strings.TrimSuffix(filepath.Base(path), CrateExt), crateSeparator)
+
+	return crate, nil
+}
+
+// ReadLibrary reads every crate in the _Serato_ directory under root.
+func ReadLibrary(root string) ([]*Crate, error) {
+	matches, err := filepath.Glob(filepath.Join(root, DirName, SubcratesDir, "*"+CrateExt))
+	if err != nil {
+		return nil, err
+	}
+
+	crates := make([]*Crate, 0, len(matches))
+	for _, match := range matches {
+		crate, err := ReadCrateFile(match)
+		if err != nil {
+			return nil, err
+		}
+		crates = append(crates, crate)
+	}
+	return crates, nil
+}
+
+// WriteLibrary writes crates into the _Serato_ directory under root,
+// creating it if needed. Parent crates of nested crates are written empty
+// when they are not part of crates, since Serato only shows children of
+// crates that exist. It returns the paths of the written files.
+func WriteLibrary(root string, crates []*Crate) ([]string, error) {
+	dir := filepath.Join(root, DirName, SubcratesDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+
+	byName := make(map[string]*Crate)
+	var order []string
+	add := func(crate *Crate) {
+		name := crate.FileName()
+		if _, exists := byName[name]; !exists {
+			order = append(order, name)
+		}
+		byName[name] = crate
+	}
+	for _, crate := range crates {
+		for i := 1; i < len(crate.Path); i++ {
+			parent := &Crate{Path: crate.Path[:i], Columns: crate.Columns}
+			if _, exists := byName[parent.FileName()]; !exists {
+				add(parent)
+			}
+		}
+		add(crate)
+	}
+
+	written := make([]string, 0, len(order))
+	for _, name := range order {
+		path := filepath.Join(dir, name)
+		if err := writeCrateFile(path, byName[name]); err != nil {
+			return written, err
+		}
+		written = append(written, path)
+	}
+
+	return written, nil
+}
+
+func writeCrateFile(path string, crate *Crate) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create crate %s: %w", path, err)
+	}
+	if err := crate.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+type field struct {
+	tag  string
+	data []byte
+}
+
+func writeField(buf *bytes.Buffer, tag string, data []byte) {
+	buf.WriteString(tag)
+	buf.Write(binary.BigEndian.AppendUint32(nil, uint32(len(data))))
+	buf.Write(data)
+}
+
+func readFields(data []byte) ([]field, error) {
+	var fields []field
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return nil, errors.New("truncated crate field header")
+		}
+		tag := string(data[:4])
+		size := binary.BigEndian.Uint32(data[4:8])
+		data = data[8:]
+		if uint64(size) > uint64(len(data)) {
+			return nil, fmt.Errorf("crate field %q length %d exceeds remaining %d bytes", tag, size, len(data))
+		}
+		fields = append(fields, field{tag: tag, data: data[:size]})
+		data = data[size:]
+	}
+	return fields, nil
+}
+
+func encodeText(s string) []byte {
+	units := utf16.Encode([]rune(s))
+	out := make([]byte, 2*len(units))
+	for i, u := range units {
+		binary.BigEndian.PutUint16(out[2*i:], u)
+	}
+	return out
+}
+
+func decodeText(data []byte) string {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = binary.BigEndian.Uint16(data[2*i:])
+	}
+	return string(utf16.Decode(units))
+}
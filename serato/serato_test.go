@@ -0,0 +1,180 @@
+package serato
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/r-medina/rdbs/rekordbox"
+)
+
+func TestCrateRoundTrip(t *testing.T) {
+	crate := &Crate{
+		Columns: []string{"song", "artist", "bpm"},
+		Tracks: []string{
+			"Music/Kerri Chandler - Rain.mp3",
+			"Music/Björk - Jóga.flac",
+			"Music/坂本龍一 - 🎹.wav",
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := crate.Write(&buf); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	got, err := ReadCrate(&buf)
+	if err != nil {
+		t.Fatalf("ReadCrate: %v", err)
+	}
+
+	if !reflect.DeepEqual(got.Columns, crate.Columns) {
+		t.Errorf("Columns = %q, want %q", got.Columns, crate.Columns)
+	}
+	if !reflect.DeepEqual(got.Tracks, crate.Tracks) {
+		t.Errorf("Tracks = %q, want %q", got.Tracks, crate.Tracks)
+	}
+}
+
+func TestCrateDefaultColumns(t *testing.T) {
+	var buf bytes.Buffer
+	if err := (&Crate{}).Write(&buf); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	got, err := ReadCrate(&buf)
+	if err != nil {
+		t.Fatalf("ReadCrate: %v", err)
+	}
+	if !reflect.DeepEqual(got.Columns, DefaultColumns) {
+		t.Errorf("Columns = %q, want %q", got.Columns, DefaultColumns)
+	}
+	if len(got.Tracks) != 0 {
+		t.Errorf("Tracks = %q, want none", got.Tracks)
+	}
+}
+
+func TestReadCrateErrors(t *testing.T) {
+	tests := map[string][]byte{
+		"truncated header": []byte("vrsn\x00\x00"),
+		"length overflow":  []byte("vrsn\x00\x00\x00\xff"),
+		"not a crate":      append([]byte("vrsn\x00\x00\x00\x02"), 0, 'x'),
+	}
+	for name, data := range tests {
+		if _, err := ReadCrate(bytes.NewReader(data)); err == nil {
+			t.Errorf("%s: ReadCrate succeeded, want error", name)
+		}
+	}
+}
+
+func TestLibraryRoundTrip(t *testing.T) {
+	root := t.TempDir()
+	crates := []*Crate{
+		{Path: []string{"House", "Deep", "Late Night"}, Tracks: []string{"a.mp3", "b.mp3"}},
+		{Path: []string{"Techno"}, Tracks: []string{"c.wav"}},
+		{Path: []string{"50%%Off / Sale"}, Tracks: []string{"d.aiff"}},
+	}
+
+	written, err := WriteLibrary(root, crates)
+	if err != nil {
+		t.Fatalf("WriteLibrary: %v", err)
+	}
+	// House and House%%Deep are added as empty parents
+	if len(written) != 5 {
+		t.Errorf("wrote %d crates, want 5: %q", len(written), written)
+	}
+
+	read, err := ReadLibrary(root)
+	if err != nil {
+		t.Fatalf("ReadLibrary: %v", err)
+	}
+	byName := make(map[string]*Crate)
+	for _, crate := range read {
+		byName[crate.FileName()] = crate
+	}
+
+	want := map[string][]string{
+		"House.crate":                   nil,
+		"House%%Deep.crate":             nil,
+		"House%%Deep%%Late Night.crate": {"a.mp3", "b.mp3"},
+		"Techno.crate":                  {"c.wav"},
+		"50%Off - Sale.crate":           {"d.aiff"},
+	}
+	for name, tracks := range want {
+		crate, ok := byName[name]
+		if !ok {
+			t.Errorf("crate %s not read back", name)
+			continue
+		}
+		if len(crate.Tracks) != len(tracks) || (len(tracks) > 0 && !reflect.DeepEqual(crate.Tracks, tracks)) {
+			t.Errorf("crate %s tracks = %q, want %q", name, crate.Tracks, tracks)
+		}
+	}
+}
+
+func TestTrackPath(t *testing.T) {
+	tests := []struct {
+		file, volume string
+		want         string
+		ok           bool
+	}{
+		{"/Users/dj/Music/a.mp3", "/", "Users/dj/Music/a.mp3", true},
+		{"/Volumes/USB/Music/a.mp3", "/Volumes/USB", "Music/a.mp3", true},
+		{"/Volumes/USB/Music/a.mp3", "/", "", false},
+		{"/Volumes/Other/a.mp3", "/Volumes/USB", "", false},
+		{"/Users/dj/a.mp3", "/Volumes/USB", "", false},
+		{`D:\Music\a.mp3`, "D:", "Music/a.mp3", true},
+		{`d:\Music\a.mp3`, "D:", "Music/a.mp3", true},
+		{`C:\Music\a.mp3`, "D:", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := TrackPath(tt.file, tt.volume)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("TrackPath(%q, %q) = %q, %v; want %q, %v", tt.file, tt.volume, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestCrateFromPlaylist(t *testing.T) {
+	playlist := &rekordbox.FullPlaylist{
+		Name: "Late Night",
+		Path: []string{"House", "Late Night"},
+		Tracks: []rekordbox.FullTrack{
+			{ID: "1", FolderPath: "/Volumes/USB/Music/a.mp3"},
+			{ID: "2", FolderPath: "/Users/dj/Music/b.mp3"},
+			{ID: "3"},
+		},
+	}
+
+	crate, skipped := CrateFromPlaylist(playlist, Volume("/Volumes/USB/export"))
+	if !reflect.DeepEqual(crate.Tracks, []string{"Music/a.mp3"}) {
+		t.Errorf("Tracks = %q, want [Music/a.mp3]", crate.Tracks)
+	}
+	if len(skipped) != 1 || skipped[0].ID != "2" {
+		t.Errorf("skipped = %v, want track 2", skipped)
+	}
+	if crate.FileName() != "House%%Late Night.crate" {
+		t.Errorf("FileName = %q", crate.FileName())
+	}
+}
+
+func TestCrateFileName(t *testing.T) {
+	tests := []struct {
+		path []string
+		want string
+	}{
+		{[]string{"House", "Deep"}, "House%%Deep.crate"},
+		{[]string{"50%%Off"}, "50%Off.crate"},
+		{[]string{"a%%%b", "c%%%%d"}, "a%b%%c%d.crate"},
+		{[]string{"100%", "%Off", "x%"}, "100%%Off%%x%.crate"},
+		{[]string{"a/b", `c\d`}, "a-b%%c-d.crate"},
+	}
+	for _, tt := range tests {
+		crate := &Crate{Path: tt.path}
+		if got := crate.FileName(); got != tt.want {
+			t.Errorf("FileName of %q = %q, want %q", tt.path, got, tt.want)
+		}
+		if got := strings.Count(crate.FileName(), crateSeparator); got != len(tt.path)-1 {
+			t.Errorf("FileName of %q has %d separators, want %d", tt.path, got, len(tt.path)-1)
+		}
+	}
+}
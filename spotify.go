@@ -1,6 +1,7 @@
 package rdbs
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
@@ -13,7 +14,14 @@ import (
 	"github.com/zmb3/spotify"
 )
 
+// SpotifyOAuthClient calls SpotifyOAuthClientContext with context.Background().
 func SpotifyOAuthClient(clientID, secretKey string) (*spotify.Client, error) {
+	return SpotifyOAuthClientContext(context.Background(), clientID, secretKey)
+}
+
+// SpotifyOAuthClientContext opens the browser to authorize with Spotify
+// and waits up to two minutes for the redirect, or until ctx is done.
+func SpotifyOAuthClientContext(ctx context.Context, clientID, secretKey string) (*spotify.Client, error) {
 	auth := spotify.NewAuthenticator("http://localhost:8666/", spotify.ScopePlaylistModifyPrivate)
 	auth.SetAuthInfo(clientID, secretKey)
 
@@ -45,7 +53,7 @@ func SpotifyOAuthClient(clientID, secretKey string) (*spotify.Client, error) {
 	}()
 
 	// print brower url in case it doesnt open automatically
-	fmt.Printf("opening browser to %s\n", auth.AuthURL(""))
+	log.Printf("opening browser to %s", auth.AuthURL(""))
 	if err := open.Run(auth.AuthURL("")); err != nil {
 		return nil, err
 	}
@@ -55,63 +63,95 @@ func SpotifyOAuthClient(clientID, secretKey string) (*spotify.Client, error) {
 		return client, err
 	case <-time.After(120 * time.Second):
 		return nil, errors.New("timeout waiting for oauth token")
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
 }
 
+// SearchResult is the outcome of searching Spotify for a single track.
+type SearchResult struct {
+	Track Track
+	Match *spotify.FullTrack // nil when nothing was found
+	Err   error
+}
+
 func SpotifySearch(spotifyClient *spotify.Client, tracks []Track) ([]spotify.FullTrack, error) {
+	for _, track := range tracks {
+		log.Printf("searching for '%s - %s'", track.Artist, track.Title)
+	}
+
+	spotifyTracks := []spotify.FullTrack{}
+	for _, result := range SpotifySearchResults(spotifyClient, tracks) {
+		switch {
+		case result.Err != nil:
+			log.Printf("spotify search failed: %+v", result.Err)
+		case result.Match == nil:
+			log.Printf("could not find '%s - %s'", result.Track.Artist, result.Track.Title)
+		default:
+			spotifyTracks = append(spotifyTracks, *result.Match)
+		}
+	}
+
+	return spotifyTracks, nil
+}
+
+// SpotifySearchResults calls SpotifySearchResultsContext with context.Background().
+func SpotifySearchResults(spotifyClient *spotify.Client, tracks []Track) []SearchResult {
+	return SpotifySearchResultsContext(context.Background(), spotifyClient, tracks)
+}
+
+// SpotifySearchResultsContext searches Spotify for every track
+// concurrently and returns one result per track, in the order of tracks.
+// Tracks not yet searched when ctx is done get its error.
+func SpotifySearchResultsContext(ctx context.Context, spotifyClient *spotify.Client, tracks []Track) []SearchResult {
+	results := make([]SearchResult, len(tracks))
 	wg := sync.WaitGroup{}
-	trackCh := make(chan spotify.FullTrack, len(tracks))
-	for _, t := range tracks {
+	for i, t := range tracks {
 		wg.Add(1)
-		go func(track Track) {
+		go func(i int, track Track) {
 			defer wg.Done()
-			artist := track.Artist
-			title := track.Title
+			results[i] = SearchResult{Track: track}
+			if err := ctx.Err(); err != nil {
+				results[i].Err = err
+				return
+			}
 
-			fmt.Printf("\t%s - %s\n", artist, title)
+			results[i].Match, results[i].Err = searchTrack(spotifyClient, track)
+		}(i, t)
+	}
+	wg.Wait()
 
-			// spotify doesnt like the (Original Mix) or (Someone
-			// Remix) that dance music uses
-			// also doesnt like "feat"
+	return results
+}
 
-			title = strings.ToLower(title)
-			title = strings.ReplaceAll(title, "original mix", "")
-			title = strings.ReplaceAll(title, "(", "")
-			title = strings.ReplaceAll(title, ")", "")
-			title = strings.ReplaceAll(title, "feat.", "")
+func searchTrack(spotifyClient *spotify.Client, track Track) (*spotify.FullTrack, error) {
+	artist := track.Artist
+	title := track.Title
 
-			end := len(artist)
-			if i := strings.Index(artist, "("); i > 0 {
-				end = i
-			}
-			artist = artist[0:end]
+	// spotify doesnt like the (Original Mix) or (Someone
+	// Remix) that dance music uses
+	// also doesnt like "feat"
 
-			q := fmt.Sprintf("%s %s", artist, title)
-			results, err := spotifyClient.Search(q, spotify.SearchTypeTrack)
-			if err != nil {
-				log.Printf("spotify search failed: %+v", err)
-				return
-			}
+	title = strings.ToLower(title)
+	title = strings.ReplaceAll(title, "original mix", "")
+	title = strings.ReplaceAll(title, "(", "")
+	title = strings.ReplaceAll(title, ")", "")
+	title = strings.ReplaceAll(title, "feat.", "")
 
-			if results.Tracks != nil {
-				if len(results.Tracks.Tracks) == 0 {
-					log.Printf("could not find '%s - %s'", artist, title)
-					return
-				}
-				trackCh <- results.Tracks.Tracks[0]
-			}
-		}(t)
+	end := len(artist)
+	if i := strings.Index(artist, "("); i > 0 {
+		end = i
 	}
+	artist = artist[0:end]
 
-	go func() {
-		wg.Wait()
-		close(trackCh)
-	}()
-
-	spotifyTracks := []spotify.FullTrack{}
-	for track := range trackCh {
-		spotifyTracks = append(spotifyTracks, track)
+	q := fmt.Sprintf("%s %s", artist, title)
+	results, err := spotifyClient.Search(q, spotify.SearchTypeTrack)
+	if err != nil {
+		return nil, errors.WithStack(err)
 	}
 
-	return spotifyTracks, nil
+	if results.Tracks == nil || len(results.Tracks.Tracks) == 0 {
+		return nil, nil
+	}
+	return &results.Tracks.Tracks[0], nil
 }
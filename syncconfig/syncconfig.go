@@ -0,0 +1,234 @@
+// Package syncconfig loads the YAML or TOML files that describe which
+// Rekordbox playlists regordbox keeps in sync with which Spotify
+// playlists.
+//
+// A config looks like:
+//
+//	spotify:
+//	  client_id: abc123
+//	defaults:
+//	  public: false
+//	  description: Exported from Rekordbox
+//	mappings:
+//	  - playlist: House/Deep/Late Night
+//	    name: Late Night
+//	    prune: true
+//	  - folder: Techno
+//	    name: "RB {{.Name}}"
+//	  - my_tag: Mood/Peak
+//	  - smart_playlist: Fresh House
+//	    public: true
+package syncconfig
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultNameTemplate names destination playlists after their source.
+const DefaultNameTemplate = "{{.Name}}"
+
+// DefaultDescription is used when neither a mapping nor the defaults set
+// a description.
+const DefaultDescription = "Exported from Rekordbox"
+
+// Config is a sync config file.
+type Config struct {
+	Spotify  Spotify   `yaml:"spotify" toml:"spotify"`
+	Defaults Options   `yaml:"defaults" toml:"defaults"`
+	Mappings []Mapping `yaml:"mappings" toml:"mappings"`
+}
+
+// Spotify holds the Spotify app credentials. Flags and the SPOTIFY_ID and
+// SPOTIFY_SECRET environment variables take precedence.
+type Spotify struct {
+	ClientID string `yaml:"client_id" toml:"client_id"`
+	Secret   string `yaml:"secret" toml:"secret"`
+}
+
+// Options control how a destination playlist is written. Unset fields
+// fall back to the config's defaults.
+type Options struct {
+	// Name is a text/template for the destination playlist name. It is
+	// executed with a NameData.
+	Name        string  `yaml:"name" toml:"name"`
+	Description *string `yaml:"description" toml:"description"`
+	Public      *bool   `yaml:"public" toml:"public"`
+	// Prune removes tracks from the destination that aren't in the source.
+	Prune *bool `yaml:"prune" toml:"prune"`
+}
+
+// Mapping maps one Rekordbox source to destination playlists. Exactly one
+// source field is set. Playlists and folders are given by path
+// ("House/Deep"), name or ID; My Tags by name or "Group/Name".
+type Mapping struct {
+	Playlist      string `yaml:"playlist" toml:"playlist"`
+	Folder        string `yaml:"folder" toml:"folder"`
+	MyTag         string `yaml:"my_tag" toml:"my_tag"`
+	SmartPlaylist string `yaml:"smart_playlist" toml:"smart_playlist"`
+	Options       `yaml:",inline"`
+}
+
+// Source kinds.
+const (
+	SourcePlaylist      = "playlist"
+	SourceFolder        = "folder"
+	SourceMyTag         = "my_tag"
+	SourceSmartPlaylist = "smart_playlist"
+)
+
+// Source returns the kind of m's source and its value.
+func (m Mapping) Source() (kind, value string) {
+	switch {
+	case m.Playlist != "":
+		return SourcePlaylist, m.Playlist
+	case m.Folder != "":
+		return SourceFolder, m.Folder
+	case m.MyTag != "":
+		return SourceMyTag, m.MyTag
+	case m.SmartPlaylist != "":
+		return SourceSmartPlaylist, m.SmartPlaylist
+	}
+	return "", ""
+}
+
+// String describes m's source, like `folder "Techno"`.
+func (m Mapping) String() string {
+	kind, value := m.Source()
+	return fmt.Sprintf("%s %q", kind, value)
+}
+
+// NameData is passed to name templates.
+type NameData struct {
+	Name   string // Name of the source playlist or tag
+	Path   string // Full path of the source, like "House/Deep/Late Night"
+	Folder string // Path of the folder holding the source, if any
+}
+
+// Resolved is a mapping with defaults applied.
+type Resolved struct {
+	Mapping
+	Description string
+	Public      bool
+	Prune       bool
+}
+
+// Resolve applies the config's defaults to m.
+func (c *Config) Resolve(m Mapping) Resolved {
+	r := Resolved{Mapping: m, Description: DefaultDescription}
+	if r.Name == "" {
+		r.Name = c.Defaults.Name
+	}
+	if r.Name == "" {
+		r.Name = DefaultNameTemplate
+	}
+
+	for _, o := range []Options{c.Defaults, m.Options} {
+		if o.Description != nil {
+			r.Description = *o.Description
+		}
+		if o.Public != nil {
+			r.Public = *o.Public
+		}
+		if o.Prune != nil {
+			r.Prune = *o.Prune
+		}
+	}
+
+	return r
+}
+
+// DestinationName executes the name template for a source.
+func (r Resolved) DestinationName(data NameData) (string, error) {
+	tmpl, err := template.New("name").Option("missingkey=error").Parse(r.Name)
+	if err != nil {
+		return "", fmt.Errorf("invalid name template %q: %w", r.Name, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to execute name template %q: %w", r.Name, err)
+	}
+
+	name := strings.TrimSpace(buf.String())
+	if name == "" {
+		return "", fmt.Errorf("name template %q produced an empty name", r.Name)
+	}
+	return name, nil
+}
+
+// Load reads a config file. Files ending in .toml are parsed as TOML,
+// anything else as YAML.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	var c Config
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		var md toml.MetaData
+		md, err = toml.Decode(string(data), &c)
+		if err == nil {
+			err = undecodedError(md.Undecoded())
+		}
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(&c)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// undecodedError rejects unknown TOML keys, like KnownFields does for
+// YAML, so a misspelled option isn't silently ignored.
+func undecodedError(keys []toml.Key) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	names := make([]string, len(keys))
+	for i, k := range keys {
+		names[i] = k.String()
+	}
+	return fmt.Errorf("unknown fields %s", strings.Join(names, ", "))
+}
+
+// Validate checks that every mapping has exactly one source and a usable
+// name template.
+func (c *Config) Validate() error {
+	if len(c.Mappings) == 0 {
+		return fmt.Errorf("no mappings")
+	}
+
+	for i, m := range c.Mappings {
+		sources := 0
+		for _, s := range []string{m.Playlist, m.Folder, m.MyTag, m.SmartPlaylist} {
+			if s != "" {
+				sources++
+			}
+		}
+		if sources != 1 {
+			return fmt.Errorf("mapping %d: set exactly one of playlist, folder, my_tag or smart_playlist", i+1)
+		}
+
+		if _, err := c.Resolve(m).DestinationName(NameData{Name: "x", Path: "x"}); err != nil {
+			return fmt.Errorf("mapping %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package syncconfig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name, file, data string
+		err              string // Substring of the error, empty if Load succeeds
+	}{
+		{
+			name: "toml",
+			file: "sync.toml",
+			data: "[defaults]\nprune = true\n\n[[mappings]]\nplaylist = \"House\"\nname = \"RB {{.Name}}\"\nprune = false\n",
+		},
+		{
+			name: "yaml",
+			file: "sync.yaml",
+			data: "defaults:\n  prune: true\nmappings:\n  - playlist: House\n    name: RB {{.Name}}\n    prune: false\n",
+		},
+		{
+			name: "unknown toml key",
+			file: "sync.toml",
+			data: "[[mappings]]\nplaylist = \"House\"\nprnue = true\n",
+			err:  "mappings.prnue",
+		},
+		{
+			name: "unknown toml table",
+			file: "sync.toml",
+			data: "[default]\nprune = true\n\n[[mappings]]\nplaylist = \"House\"\n",
+			err:  "default",
+		},
+		{
+			name: "unknown yaml key",
+			file: "sync.yaml",
+			data: "mappings:\n  - playlist: House\n    prnue: true\n",
+			err:  "prnue",
+		},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), tt.file)
+		if err := os.WriteFile(path, []byte(tt.data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		c, err := Load(path)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: err = %v, want one mentioning %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Load: %v", tt.name, err)
+			continue
+		}
+		m := c.Mappings[0]
+		if m.Playlist != "House" || m.Name != "RB {{.Name}}" || m.Prune == nil || *m.Prune {
+			t.Errorf("%s: mapping = %+v", tt.name, m)
+		}
+		if c.Defaults.Prune == nil || !*c.Defaults.Prune {
+			t.Errorf("%s: defaults = %+v", tt.name, c.Defaults)
+		}
+	}
+}
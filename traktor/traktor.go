@@ -0,0 +1,577 @@
+// Package traktor reads and writes Traktor NML collections.
+package traktor
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/r-medina/rdbs"
+	"github.com/r-medina/rdbs/key"
+	"github.com/r-medina/rdbs/rekordbox"
+)
+
+// DefaultVolume is the volume name Traktor uses for the system disk on macOS.
+const DefaultVolume = "Macintosh HD"
+
+const nmlDateFormat = "2006/1/2"
+
+// Cue types used in CUE_V2 elements.
+const (
+	CueTypeCue  = 0
+	CueTypeFade = 1
+	CueTypeLoad = 3
+	CueTypeGrid = 4
+	CueTypeLoop = 5
+)
+
+// NML is a Traktor collection file.
+type NML struct {
+	XMLName    xml.Name   `xml:"NML"`
+	Version    string     `xml:"VERSION,attr"`
+	Head       Head       `xml:"HEAD"`
+	Collection Collection `xml:"COLLECTION"`
+	Root       Node       `xml:"PLAYLISTS>NODE"` // Root folder of the playlist tree
+
+	// SystemVolume is the volume name that maps to "/" when converting
+	// locations to and from local paths. DefaultVolume is used when empty.
+	SystemVolume string `xml:"-"`
+}
+
+// Head identifies the program that wrote the collection.
+type Head struct {
+	Company string `xml:"COMPANY,attr"`
+	Program string `xml:"PROGRAM,attr"`
+}
+
+// Collection holds every track in the file.
+type Collection struct {
+	Count   int     `xml:"ENTRIES,attr"`
+	Entries []Entry `xml:"ENTRY"`
+}
+
+// Entry is a track in the collection.
+type Entry struct {
+	ModifiedDate string      `xml:"MODIFIED_DATE,attr,omitempty"`
+	Title        string      `xml:"TITLE,attr"`
+	Artist       string      `xml:"ARTIST,attr"`
+	Location     Location    `xml:"LOCATION"`
+	Album        *Album      `xml:"ALBUM"`
+	Info         Info        `xml:"INFO"`
+	Tempo        *Tempo      `xml:"TEMPO"`
+	MusicalKey   *MusicalKey `xml:"MUSICAL_KEY"`
+	Cues         []Cue       `xml:"CUE_V2"`
+}
+
+// Location is a file location split the way Traktor stores it.
+type Location struct {
+	Dir      string `xml:"DIR,attr"`
+	File     string `xml:"FILE,attr"`
+	Volume   string `xml:"VOLUME,attr"`
+	VolumeID string `xml:"VOLUMEID,attr"`
+}
+
+// Album holds album metadata of an entry.
+type Album struct {
+	Track int    `xml:"TRACK,attr,omitempty"`
+	Title string `xml:"TITLE,attr"`
+}
+
+// Info holds the remaining track metadata of an entry.
+type Info struct {
+	Bitrate     int    `xml:"BITRATE,attr,omitempty"`
+	Genre       string `xml:"GENRE,attr,omitempty"`
+	Label       string `xml:"LABEL,attr,omitempty"`
+	Comment     string `xml:"COMMENT,attr,omitempty"`
+	Key         string `xml:"KEY,attr,omitempty"`
+	Playtime    int    `xml:"PLAYTIME,attr,omitempty"` // In seconds
+	Ranking     int    `xml:"RANKING,attr,omitempty"`  // 0-255
+	ImportDate  string `xml:"IMPORT_DATE,attr,omitempty"`
+	ReleaseDate string `xml:"RELEASE_DATE,attr,omitempty"`
+}
+
+// Tempo holds the BPM of an entry.
+type Tempo struct {
+	BPM        float64 `xml:"BPM,attr"`
+	BPMQuality float64 `xml:"BPM_QUALITY,attr"`
+}
+
+// MusicalKey holds Traktor's numeric key of an entry: 0 to 11 for C to B
+// major and 12 to 23 for C to B minor. Traktor shows the key from this
+// rather than from INFO KEY.
+type MusicalKey struct {
+	Value int `xml:"VALUE,attr"`
+}
+
+// NewMusicalKey returns Traktor's numeric key for k.
+func NewMusicalKey(k key.Key) *MusicalKey {
+	value := k.Tonic()
+	if k.Minor() {
+		value += 12
+	}
+	return &MusicalKey{Value: value}
+}
+
+// Key returns the key m stands for.
+func (m MusicalKey) Key() key.Key {
+	return key.New(m.Value%12, m.Value >= 12)
+}
+
+// Cue is a cue point, loop or grid marker of an entry.
+type Cue struct {
+	Name         string  `xml:"NAME,attr"`
+	DisplayOrder int     `xml:"DISPL_ORDER,attr"`
+	Type         int     `xml:"TYPE,attr"`
+	Start        float64 `xml:"START,attr"` // In milliseconds
+	Len          float64 `xml:"LEN,attr"`   // In milliseconds
+	Repeats      int     `xml:"REPEATS,attr"`
+	HotCue       int     `xml:"HOTCUE,attr"` // -1 for memory cues
+}
+
+// Node is a folder or playlist in the playlist tree.
+type Node struct {
+	Type     string         `xml:"TYPE,attr"`
+	Name     string         `xml:"NAME,attr"`
+	Subnodes *Subnodes      `xml:"SUBNODES"`
+	Playlist *PlaylistItems `xml:"PLAYLIST"`
+}
+
+// Subnodes holds the children of a folder node.
+type Subnodes struct {
+	Count int     `xml:"COUNT,attr"`
+	Nodes []*Node `xml:"NODE"`
+}
+
+// PlaylistItems holds the track references of a playlist node.
+type PlaylistItems struct {
+	Count   int             `xml:"ENTRIES,attr"`
+	Type    string          `xml:"TYPE,attr"`
+	UUID    string          `xml:"UUID,attr"`
+	Entries []PlaylistEntry `xml:"ENTRY"`
+}
+
+// PlaylistEntry references a collection entry from a playlist.
+type PlaylistEntry struct {
+	PrimaryKey PrimaryKey `xml:"PRIMARYKEY"`
+}
+
+// PrimaryKey identifies a collection entry by its volume and path.
+type PrimaryKey struct {
+	Type string `xml:"TYPE,attr"`
+	Key  string `xml:"KEY,attr"`
+}
+
+const (
+	nodeTypeFolder   = "FOLDER"
+	nodeTypePlaylist = "PLAYLIST"
+)
+
+// New returns an empty collection.
+func New() *NML {
+	return &NML{
+		Version: "19",
+		Head: Head{
+			Company: "www.native-instruments.com",
+			Program: "Traktor",
+		},
+		Root: Node{
+			Type:     nodeTypeFolder,
+			Name:     "$ROOT",
+			Subnodes: &Subnodes{},
+		},
+	}
+}
+
+// Read parses an NML collection.
+func Read(r io.Reader) (*NML, error) {
+	n := new(NML)
+	if err := xml.NewDecoder(r).Decode(n); err != nil {
+		return nil, fmt.Errorf("failed to decode nml: %w", err)
+	}
+	return n, nil
+}
+
+// ReadFile parses the NML collection at path.
+func ReadFile(path string) (*NML, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open nml %s: %w", path, err)
+	}
+	defer f.Close()
+
+	return Read(f)
+}
+
+// Write encodes the collection as NML.
+func (n *NML) Write(w io.Writer) error {
+	n.Collection.Count = len(n.Collection.Entries)
+
+	if _, err := io.WriteString(w, `<?xml version="1.0" encoding="UTF-8" standalone="no" ?>`+"\n"); err != nil {
+		return fmt.Errorf("failed to write nml header: %w", err)
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(n); err != nil {
+		return fmt.Errorf("failed to encode nml: %w", err)
+	}
+	return enc.Flush()
+}
+
+// WriteFile encodes the collection to path.
+func (n *NML) WriteFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create nml %s: %w", path, err)
+	}
+	if err := n.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (n *NML) systemVolume() string {
+	if n.SystemVolume == "" {
+		return DefaultVolume
+	}
+	return n.SystemVolume
+}
+
+// AddPlaylist adds a Rekordbox playlist and its tracks to the collection.
+// The playlist is placed under folders named after its Path. Tracks already
+// in the collection are referenced rather than added twice; tracks without a
+// file location are skipped since Traktor cannot reference them.
+func (n *NML) AddPlaylist(playlist *rekordbox.FullPlaylist) {
+	if n.Root.Subnodes == nil {
+		n.Root.Subnodes = &Subnodes{}
+	}
+
+	playlistPath := playlist.Path
+	if len(playlistPath) == 0 {
+		playlistPath = []string{playlist.Name}
+	}
+
+	parent := &n.Root
+	for _, folder := range playlistPath[:len(playlistPath)-1] {
+		parent = parent.folder(folder)
+	}
+
+	keys := make(map[string]bool, len(n.Collection.Entries))
+	for _, entry := range n.Collection.Entries {
+		keys[entry.Location.Key()] = true
+	}
+
+	items := &PlaylistItems{Type: "LIST", UUID: playlistUUID(playlistPath)}
+	for _, track := range playlist.Tracks {
+		if track.FolderPath == "" {
+			continue
+		}
+
+		entry := EntryFromTrack(track, n.systemVolume())
+		key := entry.Location.Key()
+		if !keys[key] {
+			keys[key] = true
+			n.Collection.Entries = append(n.Collection.Entries, entry)
+		}
+		items.Entries = append(items.Entries, PlaylistEntry{PrimaryKey: PrimaryKey{Type: "TRACK", Key: key}})
+	}
+	items.Count = len(items.Entries)
+
+	parent.Subnodes.Nodes = append(parent.Subnodes.Nodes, &Node{
+		Type:     nodeTypePlaylist,
+		Name:     playlistPath[len(playlistPath)-1],
+		Playlist: items,
+	})
+	parent.Subnodes.Count = len(parent.Subnodes.Nodes)
+	n.Collection.Count = len(n.Collection.Entries)
+}
+
+// folder returns the child folder with the given name, creating it if needed.
+func (node *Node) folder(name string) *Node {
+	for _, child := range node.Subnodes.Nodes {
+		if child.Type == nodeTypeFolder && child.Name == name {
+			return child
+		}
+	}
+	child := &Node{Type: nodeTypeFolder, Name: name, Subnodes: &Subnodes{}}
+	node.Subnodes.Nodes = append(node.Subnodes.Nodes, child)
+	node.Subnodes.Count = len(node.Subnodes.Nodes)
+	return child
+}
+
+func playlistUUID(playlistPath []string) string {
+	sum := md5.Sum([]byte(strings.Join(playlistPath, "/")))
+	return hex.EncodeToString(sum[:])
+}
+
+// EntryFromTrack converts a Rekordbox track into a collection entry.
+func EntryFromTrack(track rekordbox.FullTrack, systemVolume string) Entry {
+	entry := Entry{
+		ModifiedDate: time.Now().Format(nmlDateFormat),
+		Title:        track.Title,
+		Artist:       track.Artist,
+		Location:     LocationFromPath(track.FolderPath, systemVolume),
+		Info: Info{
+			Genre:    track.Genre,
+			Label:    track.Label,
+			Key:      track.Key,
+			Playtime: track.Length,
+			Ranking:  clampRating(track.Rating) * 51,
+		},
+	}
+	if track.Album != "" || track.TrackNumber > 0 {
+		entry.Album = &Album{Track: track.TrackNumber, Title: track.Album}
+	}
+	if !track.DateCreated.IsZero() {
+		entry.Info.ImportDate = track.DateCreated.Format(nmlDateFormat)
+	}
+	if track.Year > 0 {
+		entry.Info.ReleaseDate = fmt.Sprintf("%d/1/1", track.Year)
+	}
+	if track.BPM > 0 {
+		entry.Tempo = &Tempo{BPM: track.Tempo(), BPMQuality: 100}
+	}
+	if k, ok := track.ParsedKey(); ok {
+		entry.MusicalKey = NewMusicalKey(k)
+	}
+
+	for i, cue := range track.Cues {
+		c := Cue{
+			Name:         cue.Comment,
+			DisplayOrder: i,
+			Type:         CueTypeCue,
+			Start:        float64(cue.InMsec),
+			Repeats:      -1,
+			HotCue:       cue.HotCueIndex(),
+		}
+		if c.Name == "" {
+			c.Name = "n.n."
+		}
+		if cue.IsLoop() {
+			c.Type = CueTypeLoop
+			c.Len = float64(cue.OutMsec - cue.InMsec)
+		}
+		entry.Cues = append(entry.Cues, c)
+	}
+
+	return entry
+}
+
+func clampRating(stars int) int {
+	switch {
+	case stars < 0:
+		return 0
+	case stars > 5:
+		return 5
+	default:
+		return stars
+	}
+}
+
+// LocationFromPath splits a local file path into a Traktor location.
+// Files under /Volumes/<name> on macOS and on Windows drives get that
+// volume; everything else is placed on systemVolume.
+func LocationFromPath(file, systemVolume string) Location {
+	file = strings.ReplaceAll(file, `\`, "/")
+	volume := systemVolume
+
+	switch {
+	case len(file) >= 2 && file[1] == ':':
+		volume = file[:2]
+		file = file[2:]
+	case strings.HasPrefix(file, "/Volumes/"):
+		rest := strings.TrimPrefix(file, "/Volumes/")
+		if i := strings.Index(rest, "/"); i > 0 {
+			volume = rest[:i]
+			file = rest[i:]
+		}
+	}
+
+	dir, name := path.Split(file)
+	var b strings.Builder
+	for _, part := range strings.Split(strings.Trim(dir, "/"), "/") {
+		if part == "" {
+			continue
+		}
+		b.WriteString("/:")
+		b.WriteString(part)
+	}
+	b.WriteString("/:")
+
+	return Location{Dir: b.String(), File: name, Volume: volume, VolumeID: volume}
+}
+
+// Key returns the collection key Traktor uses to reference the location
+// from playlists.
+func (l Location) Key() string {
+	return l.Volume + l.Dir + l.File
+}
+
+// Path converts the location back into a local file path.
+func (l Location) Path(systemVolume string) string {
+	dir := strings.ReplaceAll(l.Dir, "/:", "/")
+	file := path.Join(dir, l.File)
+
+	switch {
+	case len(l.Volume) == 2 && l.Volume[1] == ':':
+		return l.Volume + file
+	case l.Volume == "" || l.Volume == systemVolume:
+		return file
+	default:
+		return path.Join("/Volumes", l.Volume, file)
+	}
+}
+
+// FullTrack converts the entry into a Rekordbox track. The track has no ID
+// since it does not come from a Rekordbox database.
+func (e Entry) FullTrack(systemVolume string) rekordbox.FullTrack {
+	track := rekordbox.FullTrack{
+		Title:      e.Title,
+		Artist:     e.Artist,
+		Genre:      e.Info.Genre,
+		Label:      e.Info.Label,
+		Key:        e.Info.Key,
+		Length:     e.Info.Playtime,
+		Rating:     (e.Info.Ranking + 25) / 51,
+		FolderPath: e.Location.Path(systemVolume),
+	}
+	if e.Album != nil {
+		track.Album = e.Album.Title
+		track.TrackNumber = e.Album.Track
+	}
+	if track.Key == "" && e.MusicalKey != nil {
+		track.Key = e.MusicalKey.Key().String()
+	}
+	if e.Tempo != nil {
+		track.BPM = int(e.Tempo.BPM*100 + 0.5)
+	}
+	if date, err := time.Parse(nmlDateFormat, e.Info.ImportDate); err == nil {
+		track.DateCreated = date
+	}
+	if year, _, found := strings.Cut(e.Info.ReleaseDate, "/"); found {
+		track.Year, _ = strconv.Atoi(year)
+	}
+
+	hotCues := 0
+	for _, cue := range e.Cues {
+		if cue.Type != CueTypeCue && cue.Type != CueTypeLoop {
+			continue
+		}
+		c := rekordbox.Cue{
+			InMsec:  int(cue.Start),
+			OutMsec: -1,
+			Comment: cue.Name,
+		}
+		if c.Comment == "n.n." {
+			c.Comment = ""
+		}
+		if cue.Type == CueTypeLoop {
+			c.OutMsec = int(cue.Start + cue.Len)
+		}
+		if cue.HotCue >= 0 && hotCues < 8 {
+			// Inverse of rekordbox.Cue.HotCueIndex.
+			c.Kind = cue.HotCue + 1
+			if cue.HotCue >= 3 {
+				c.Kind++
+			}
+			hotCues++
+		}
+		track.Cues = append(track.Cues, c)
+	}
+
+	return track
+}
+
+// Playlist is a playlist read from a collection.
+type Playlist struct {
+	Path    []string
+	Entries []Entry
+}
+
+// Playlists returns every playlist in the collection in tree order.
+func (n *NML) Playlists() []Playlist {
+	byKey := make(map[string]Entry, len(n.Collection.Entries))
+	for _, entry := range n.Collection.Entries {
+		byKey[entry.Location.Key()] = entry
+	}
+
+	var playlists []Playlist
+	var walk func(node *Node, parents []string)
+	walk = func(node *Node, parents []string) {
+		if node.Playlist != nil {
+			playlist := Playlist{Path: append(append([]string{}, parents...), node.Name)}
+			for _, item := range node.Playlist.Entries {
+				if entry, ok := byKey[item.PrimaryKey.Key]; ok {
+					playlist.Entries = append(playlist.Entries, entry)
+				}
+			}
+			playlists = append(playlists, playlist)
+		}
+		if node.Subnodes == nil {
+			return
+		}
+		// The root folder is not part of playlist paths.
+		childParents := parents
+		if node != &n.Root {
+			childParents = append(append([]string{}, parents...), node.Name)
+		}
+		for _, child := range node.Subnodes.Nodes {
+			walk(child, childParents)
+		}
+	}
+	walk(&n.Root, nil)
+
+	return playlists
+}
+
+// FindPlaylists returns the playlists whose name or slash separated path
+// equals name.
+func (n *NML) FindPlaylists(name string) []Playlist {
+	var matches []Playlist
+	for _, playlist := range n.Playlists() {
+		if strings.Join(playlist.Path, "/") == name || playlist.Path[len(playlist.Path)-1] == name {
+			matches = append(matches, playlist)
+		}
+	}
+	return matches
+}
+
+// Tracks returns the playlist's tracks for Spotify syncing.
+func (p Playlist) Tracks() []rdbs.Track {
+	tracks := make([]rdbs.Track, 0, len(p.Entries))
+	for _, entry := range p.Entries {
+		tracks = append(tracks, rdbs.Track{Artist: entry.Artist, Title: entry.Title})
+	}
+	return tracks
+}
+
+// FullPlaylist converts the playlist into a Rekordbox playlist, e.g. for
+// rekordbox.WriteXML.
+func (p Playlist) FullPlaylist(systemVolume string) *rekordbox.FullPlaylist {
+	playlist := &rekordbox.FullPlaylist{
+		Name:     p.Path[len(p.Path)-1],
+		Path:     p.Path,
+		Children: make([]*rekordbox.FullPlaylist, 0),
+	}
+	for _, entry := range p.Entries {
+		playlist.Tracks = append(playlist.Tracks, entry.FullTrack(systemVolume))
+	}
+	return playlist
+}
+
+// FullPlaylists converts every playlist in the collection into Rekordbox
+// playlists.
+func (n *NML) FullPlaylists() []*rekordbox.FullPlaylist {
+	var playlists []*rekordbox.FullPlaylist
+	for _, playlist := range n.Playlists() {
+		playlists = append(playlists, playlist.FullPlaylist(n.systemVolume()))
+	}
+	return playlists
+}
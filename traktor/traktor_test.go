@@ -0,0 +1,203 @@
+package traktor
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/r-medina/rdbs/key"
+	"github.com/r-medina/rdbs/rekordbox"
+)
+
+func TestMusicalKey(t *testing.T) {
+	// Traktor numbers major keys C to B as 0 to 11 and minor keys as 12
+	// to 23.
+	names := []string{
+		"C", "Db", "D", "Eb", "E", "F", "F#", "G", "Ab", "A", "Bb", "B",
+		"Cm", "C#m", "Dm", "Ebm", "Em", "Fm", "F#m", "Gm", "G#m", "Am", "Bbm", "Bm",
+	}
+	for value, name := range names {
+		k, err := key.Parse(name)
+		if err != nil {
+			t.Fatalf("key.Parse(%q): %v", name, err)
+		}
+		if got := NewMusicalKey(k).Value; got != value {
+			t.Errorf("NewMusicalKey(%s) = %d, want %d", name, got, value)
+		}
+		if got := (MusicalKey{Value: value}).Key(); got != k {
+			t.Errorf("MusicalKey %d = %s, want %s", value, got, name)
+		}
+	}
+}
+
+func TestLocation(t *testing.T) {
+	tests := []struct {
+		file string
+		want Location
+		key  string
+		back string // Path converts back to this
+	}{
+		{
+			file: "/Users/dj/Music/Rain.mp3",
+			want: Location{Dir: "/:Users/:dj/:Music/:", File: "Rain.mp3", Volume: "Macintosh HD", VolumeID: "Macintosh HD"},
+			key:  "Macintosh HD/:Users/:dj/:Music/:Rain.mp3",
+			back: "/Users/dj/Music/Rain.mp3",
+		},
+		{
+			file: "/Volumes/USB/Music/Rain.mp3",
+			want: Location{Dir: "/:Music/:", File: "Rain.mp3", Volume: "USB", VolumeID: "USB"},
+			key:  "USB/:Music/:Rain.mp3",
+			back: "/Volumes/USB/Music/Rain.mp3",
+		},
+		{
+			file: `C:\Users\dj\Rain.mp3`,
+			want: Location{Dir: "/:Users/:dj/:", File: "Rain.mp3", Volume: "C:", VolumeID: "C:"},
+			key:  "C:/:Users/:dj/:Rain.mp3",
+			back: "C:/Users/dj/Rain.mp3",
+		},
+		{
+			file: "/Rain.mp3",
+			want: Location{Dir: "/:", File: "Rain.mp3", Volume: "Macintosh HD", VolumeID: "Macintosh HD"},
+			key:  "Macintosh HD/:Rain.mp3",
+			back: "/Rain.mp3",
+		},
+	}
+	for _, tt := range tests {
+		got := LocationFromPath(tt.file, DefaultVolume)
+		if got != tt.want {
+			t.Errorf("LocationFromPath(%q) = %+v, want %+v", tt.file, got, tt.want)
+		}
+		if got.Key() != tt.key {
+			t.Errorf("LocationFromPath(%q).Key() = %q, want %q", tt.file, got.Key(), tt.key)
+		}
+		if back := got.Path(DefaultVolume); back != tt.back {
+			t.Errorf("LocationFromPath(%q).Path() = %q, want %q", tt.file, back, tt.back)
+		}
+	}
+}
+
+func TestHotCues(t *testing.T) {
+	// Rekordbox skips kind 4, so kinds 1-3 and 5-9 are hot cues A to H.
+	track := rekordbox.FullTrack{
+		FolderPath: "/Music/Rain.mp3",
+		Cues: []rekordbox.Cue{
+			{Kind: 0, InMsec: 100, OutMsec: -1, Comment: "memory"},
+			{Kind: 1, InMsec: 200, OutMsec: -1},
+			{Kind: 3, InMsec: 300, OutMsec: -1},
+			{Kind: 5, InMsec: 400, OutMsec: -1},
+			{Kind: 9, InMsec: 500, OutMsec: 2500},
+		},
+	}
+
+	entry := EntryFromTrack(track, DefaultVolume)
+	want := []Cue{
+		{Name: "memory", DisplayOrder: 0, Type: CueTypeCue, Start: 100, Repeats: -1, HotCue: -1},
+		{Name: "n.n.", DisplayOrder: 1, Type: CueTypeCue, Start: 200, Repeats: -1, HotCue: 0},
+		{Name: "n.n.", DisplayOrder: 2, Type: CueTypeCue, Start: 300, Repeats: -1, HotCue: 2},
+		{Name: "n.n.", DisplayOrder: 3, Type: CueTypeCue, Start: 400, Repeats: -1, HotCue: 3},
+		{Name: "n.n.", DisplayOrder: 4, Type: CueTypeLoop, Start: 500, Len: 2000, Repeats: -1, HotCue: 7},
+	}
+	if !reflect.DeepEqual(entry.Cues, want) {
+		t.Errorf("cues =\n%+v\nwant\n%+v", entry.Cues, want)
+	}
+
+	if got := entry.FullTrack(DefaultVolume).Cues; !reflect.DeepEqual(got, track.Cues) {
+		t.Errorf("cues back =\n%+v\nwant\n%+v", got, track.Cues)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	rain := rekordbox.FullTrack{
+		Title:       "Rain (Original Mix)",
+		Artist:      "Kerri Chandler",
+		Album:       "Trax",
+		TrackNumber: 1,
+		Genre:       "Deep House",
+		Label:       "Madhouse",
+		Year:        1998,
+		BPM:         12400,
+		Length:      392,
+		Key:         "Am",
+		Rating:      5,
+		FolderPath:  "/Volumes/USB/Music/Rain.mp3",
+		DateCreated: time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC),
+		Cues:        []rekordbox.Cue{{Kind: 1, InMsec: 1000, OutMsec: -1, Comment: "drop"}},
+	}
+	minus := rekordbox.FullTrack{
+		Title:      "Minus",
+		Artist:     "Robert Hood",
+		BPM:        13000,
+		Key:        "11A",
+		Rating:     2,
+		FolderPath: "/Users/dj/Minus.wav",
+	}
+	noFile := rekordbox.FullTrack{Title: "Streamed"}
+
+	nml := New()
+	nml.AddPlaylist(&rekordbox.FullPlaylist{Name: "Late Night", Path: []string{"House", "Deep", "Late Night"}, Tracks: []rekordbox.FullTrack{rain, minus}})
+	nml.AddPlaylist(&rekordbox.FullPlaylist{Name: "Techno", Path: []string{"Techno"}, Tracks: []rekordbox.FullTrack{minus, noFile}})
+
+	path := filepath.Join(t.TempDir(), "collection.nml")
+	if err := nml.WriteFile(path); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	got, err := ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+
+	if got.Collection.Count != 2 || len(got.Collection.Entries) != 2 {
+		t.Errorf("collection has %d entries (ENTRIES=%d), want 2", len(got.Collection.Entries), got.Collection.Count)
+	}
+	if v := got.Collection.Entries[1].MusicalKey; v == nil || v.Value != 18 {
+		t.Errorf("11A MUSICAL_KEY = %+v, want 18 (F#m)", v)
+	}
+
+	playlists := got.FullPlaylists()
+	if len(playlists) != 2 {
+		t.Fatalf("got %d playlists, want 2", len(playlists))
+	}
+	if want := []string{"House", "Deep", "Late Night"}; !reflect.DeepEqual(playlists[0].Path, want) {
+		t.Errorf("first playlist path = %q, want %q", playlists[0].Path, want)
+	}
+	if want := []string{"Techno"}; !reflect.DeepEqual(playlists[1].Path, want) {
+		t.Errorf("second playlist path = %q, want %q", playlists[1].Path, want)
+	}
+
+	wantTracks := [][]rekordbox.FullTrack{{rain, minus}, {minus}}
+	for i, playlist := range playlists {
+		if !reflect.DeepEqual(playlist.Tracks, wantTracks[i]) {
+			t.Errorf("%s tracks =\n%+v\nwant\n%+v", playlist.Name, playlist.Tracks, wantTracks[i])
+		}
+	}
+
+	if matches := got.FindPlaylists("House/Deep/Late Night"); len(matches) != 1 {
+		t.Errorf("FindPlaylists by path found %d playlists, want 1", len(matches))
+	}
+	if matches := got.FindPlaylists("Techno"); len(matches) != 1 || len(matches[0].Tracks()) != 1 {
+		t.Errorf("FindPlaylists by name = %+v, want Techno with 1 track", matches)
+	}
+}
+
+func TestReadMusicalKeyOnly(t *testing.T) {
+	nml := `<?xml version="1.0" encoding="UTF-8" standalone="no" ?>
+<NML VERSION="19"><HEAD COMPANY="www.native-instruments.com" PROGRAM="Traktor"></HEAD>
+<COLLECTION ENTRIES="1">
+<ENTRY TITLE="Minus" ARTIST="Robert Hood">
+<LOCATION DIR="/:Music/:" FILE="Minus.wav" VOLUME="Macintosh HD" VOLUMEID="x"></LOCATION>
+<MUSICAL_KEY VALUE="21"></MUSICAL_KEY>
+</ENTRY>
+</COLLECTION>
+<PLAYLISTS><NODE TYPE="FOLDER" NAME="$ROOT"></NODE></PLAYLISTS>
+</NML>`
+	got, err := Read(bytes.NewReader([]byte(nml)))
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	track := got.Collection.Entries[0].FullTrack(DefaultVolume)
+	if track.Key != "Am" || track.FolderPath != "/Music/Minus.wav" {
+		t.Errorf("track = %+v, want key Am at /Music/Minus.wav", track)
+	}
+}
@@ -0,0 +1,315 @@
+// Package virtualdj writes VirtualDJ database entries and .vdjfolder
+// playlists.
+package virtualdj
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/r-medina/rdbs/rekordbox"
+)
+
+const (
+	// DatabaseName is the file name of a VirtualDJ database.
+	DatabaseName = "database.xml"
+	// FoldersDir is the directory VirtualDJ keeps playlists in.
+	FoldersDir = "Folders"
+	// FolderExt is the file extension of VirtualDJ playlists.
+	FolderExt = ".vdjfolder"
+
+	databaseVersion = "8.5"
+)
+
+// Database is a VirtualDJ database.xml document.
+type Database struct {
+	XMLName xml.Name `xml:"VirtualDJ_Database"`
+	Version string   `xml:"Version,attr"`
+	Songs   []Song   `xml:"Song"`
+}
+
+// Song is a track in the database.
+type Song struct {
+	FilePath string `xml:"FilePath,attr"`
+	FileSize int64  `xml:"FileSize,attr,omitempty"`
+	Tags     Tags   `xml:"Tags"`
+	Infos    Infos  `xml:"Infos"`
+	Comment  string `xml:"Comment,omitempty"`
+	Scan     *Scan  `xml:"Scan"`
+	Pois     []Poi  `xml:"Poi"`
+}
+
+// Tags holds the song's metadata.
+type Tags struct {
+	Author      string `xml:"Author,attr"`
+	Title       string `xml:"Title,attr"`
+	Genre       string `xml:"Genre,attr,omitempty"`
+	Album       string `xml:"Album,attr,omitempty"`
+	Label       string `xml:"Label,attr,omitempty"`
+	TrackNumber string `xml:"TrackNumber,attr,omitempty"`
+	Year        string `xml:"Year,attr,omitempty"`
+	Bpm         string `xml:"Bpm,attr,omitempty"` // Seconds per beat
+	Key         string `xml:"Key,attr,omitempty"`
+	Stars       int    `xml:"Stars,attr,omitempty"`
+}
+
+// Infos holds information VirtualDJ gathers about the file.
+type Infos struct {
+	SongLength string `xml:"SongLength,attr,omitempty"` // In seconds
+	FirstSeen  int64  `xml:"FirstSeen,attr,omitempty"`  // Unix time
+}
+
+// Scan holds analysis results.
+type Scan struct {
+	Bpm string `xml:"Bpm,attr"` // Seconds per beat
+	Key string `xml:"Key,attr,omitempty"`
+}
+
+// Poi is a point of interest: a cue point or saved loop.
+type Poi struct {
+	Name string `xml:"Name,attr,omitempty"`
+	Pos  string `xml:"Pos,attr"`            // In seconds
+	Size string `xml:"Size,attr,omitempty"` // Loop length in seconds
+	Num  int    `xml:"Num,attr,omitempty"`  // Hot cue number starting at 1
+	Type string `xml:"Type,attr"`
+}
+
+// Folder is a .vdjfolder playlist.
+type Folder struct {
+	XMLName xml.Name     `xml:"VirtualFolder"`
+	Songs   []FolderSong `xml:"song"`
+}
+
+// FolderSong is an entry in a .vdjfolder playlist.
+type FolderSong struct {
+	Path       string `xml:"path,attr"`
+	Size       int64  `xml:"size,attr,omitempty"`
+	SongLength string `xml:"songlength,attr,omitempty"`
+	Bpm        string `xml:"bpm,attr,omitempty"` // Beats per minute
+	Key        string `xml:"key,attr,omitempty"`
+	Artist     string `xml:"artist,attr"`
+	Title      string `xml:"title,attr"`
+	Index      int    `xml:"idx,attr"`
+}
+
+// SongFromTrack converts a Rekordbox track, including its Cues, into a
+// database entry.
+func SongFromTrack(track rekordbox.FullTrack) Song {
+	song := Song{
+		FilePath: track.FolderPath,
+		FileSize: track.FileSize,
+		Tags: Tags{
+			Author: track.Artist,
+			Title:  track.Title,
+			Genre:  track.Genre,
+			Album:  track.Album,
+			Label:  track.Label,
+			Key:    track.Key,
+			Stars:  track.Rating,
+		},
+		Comment: track.Comments,
+	}
+	if track.TrackNumber > 0 {
+		song.Tags.TrackNumber = strconv.Itoa(track.TrackNumber)
+	}
+	if track.Year > 0 {
+		song.Tags.Year = strconv.Itoa(track.Year)
+	}
+	if track.Length > 0 {
+		song.Infos.SongLength = formatFloat(float64(track.Length))
+	}
+	if !track.DateCreated.IsZero() {
+		song.Infos.FirstSeen = track.DateCreated.Unix()
+	}
+	if track.BPM > 0 {
+		spb := formatFloat(60 / track.Tempo())
+		song.Tags.Bpm = spb
+		song.Scan = &Scan{Bpm: spb, Key: track.Key}
+	}
+
+	for _, cue := range track.Cues {
+		poi := Poi{
+			Name: cue.Comment,
+			Pos:  formatFloat(float64(cue.InMsec) / 1000),
+			Type: "cue",
+		}
+		if cue.IsHotCue() {
+			poi.Num = cue.HotCueIndex() + 1
+		}
+		if cue.IsLoop() {
+			poi.Type = "loop"
+			poi.Size = formatFloat(float64(cue.OutMsec-cue.InMsec) / 1000)
+		}
+		song.Pois = append(song.Pois, poi)
+	}
+
+	return song
+}
+
+// FolderFromPlaylist converts a Rekordbox playlist into a .vdjfolder
+// playlist. Tracks without a file location are skipped.
+func FolderFromPlaylist(playlist *rekordbox.FullPlaylist) *Folder {
+	folder := new(Folder)
+	for _, track := range playlist.Tracks {
+		if track.FolderPath == "" {
+			continue
+		}
+		song := FolderSong{
+			Path:   track.FolderPath,
+			Size:   track.FileSize,
+			Key:    track.Key,
+			Artist: track.Artist,
+			Title:  track.Title,
+			Index:  len(folder.Songs),
+		}
+		if track.Length > 0 {
+			song.SongLength = formatFloat(float64(track.Length))
+		}
+		if track.BPM > 0 {
+			song.Bpm = formatFloat(track.Tempo())
+		}
+		folder.Songs = append(folder.Songs, song)
+	}
+	return folder
+}
+
+// NewDatabase builds a database containing every track in playlists once.
+func NewDatabase(playlists []*rekordbox.FullPlaylist) *Database {
+	db := &Database{Version: databaseVersion}
+	seen := make(map[string]bool)
+	for _, playlist := range playlists {
+		for _, track := range playlist.Tracks {
+			if track.FolderPath == "" || seen[track.FolderPath] {
+				continue
+			}
+			seen[track.FolderPath] = true
+			db.Songs = append(db.Songs, SongFromTrack(track))
+		}
+	}
+	return db
+}
+
+// Write encodes the database.
+func (db *Database) Write(w io.Writer) error {
+	return writeXML(w, db)
+}
+
+// Write encodes the playlist.
+func (f *Folder) Write(w io.Writer) error {
+	return writeXML(w, f)
+}
+
+// Export writes a database.xml fragment and one .vdjfolder per playlist
+// under dir. Playlists are nested in directories following their Path,
+// the way VirtualDJ lays out its Folders directory. A playlist named like
+// one written before it in the same directory gets its ID added to its
+// file name. It returns the paths of the written files.
+func Export(dir string, playlists []*rekordbox.FullPlaylist) ([]string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+
+	dbPath := filepath.Join(dir, DatabaseName)
+	if err := writeFile(dbPath, NewDatabase(playlists)); err != nil {
+		return nil, err
+	}
+	written := []string{dbPath}
+
+	used := make(map[string]bool) // Lower-cased, for case-insensitive file systems
+	for _, playlist := range playlists {
+		path := playlist.Path
+		if len(path) == 0 {
+			path = []string{playlist.Name}
+		}
+
+		parts := make([]string, 0, len(path)+1)
+		parts = append(parts, dir, FoldersDir)
+		for _, name := range path {
+			parts = append(parts, sanitizeName(name))
+		}
+		file := filepath.Join(parts...) + FolderExt
+		if used[strings.ToLower(file)] {
+			parts[len(parts)-1] += " (" + sanitizeName(playlist.ID) + ")"
+			file = filepath.Join(parts...) + FolderExt
+		}
+		if used[strings.ToLower(file)] {
+			return written, fmt.Errorf("playlist %q would overwrite %s", playlist.Name, file)
+		}
+		used[strings.ToLower(file)] = true
+
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			return written, fmt.Errorf("failed to create %s: %w", filepath.Dir(file), err)
+		}
+		if err := writeFile(file, FolderFromPlaylist(playlist)); err != nil {
+			return written, err
+		}
+		written = append(written, file)
+	}
+
+	return written, nil
+}
+
+func writeFile(path string, doc interface{ Write(io.Writer) error }) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	if err := doc.Write(f); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+func writeXML(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", " ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	return enc.Flush()
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', 6, 64)
+}
+
+// sanitizeName makes a playlist name usable as a file name on any system:
+// path separators, characters Windows reserves and control characters are
+// replaced, trailing dots and spaces are dropped, and names that would
+// still be special, like "..", "" or "CON", are prefixed with "_".
+func sanitizeName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '-'
+		}
+		return r
+	}, name)
+	name = strings.TrimRight(name, ". ")
+
+	base := strings.ToUpper(name)
+	if i := strings.IndexByte(base, '.'); i >= 0 {
+		base = base[:i]
+	}
+	if name == "" || reservedNames[strings.TrimSpace(base)] {
+		name = "_" + name
+	}
+	return name
+}
+
+// reservedNames are the device names Windows doesn't allow as file names,
+// with or without an extension.
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
@@ -0,0 +1,148 @@
+package virtualdj
+
+import (
+	"bytes"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/r-medina/rdbs/rekordbox"
+)
+
+func TestSongFromTrack(t *testing.T) {
+	track := rekordbox.FullTrack{
+		Title:       "Rain",
+		Artist:      "Kerri Chandler",
+		Genre:       "House",
+		TrackNumber: 3,
+		Year:        1998,
+		BPM:         12000,
+		Length:      392,
+		Key:         "Am",
+		Rating:      4,
+		FolderPath:  "/Music/Rain.mp3",
+		FileSize:    1000,
+		DateCreated: time.Unix(1700000000, 0),
+		Cues: []rekordbox.Cue{
+			{Kind: 0, InMsec: 1500, OutMsec: -1, Comment: "intro"},
+			{Kind: 1, InMsec: 2000, OutMsec: -1},
+			// Rekordbox skips kind 4, so 5 is hot cue D
+			{Kind: 5, InMsec: 3000, OutMsec: -1},
+			{Kind: 0, InMsec: 4000, OutMsec: 6500},
+			{Kind: 2, InMsec: 8000, OutMsec: 10000},
+		},
+	}
+
+	want := Song{
+		FilePath: "/Music/Rain.mp3",
+		FileSize: 1000,
+		Tags: Tags{
+			Author:      "Kerri Chandler",
+			Title:       "Rain",
+			Genre:       "House",
+			TrackNumber: "3",
+			Year:        "1998",
+			Bpm:         "0.500000", // Seconds per beat at 120 BPM
+			Key:         "Am",
+			Stars:       4,
+		},
+		Infos: Infos{SongLength: "392.000000", FirstSeen: 1700000000},
+		Scan:  &Scan{Bpm: "0.500000", Key: "Am"},
+		Pois: []Poi{
+			{Name: "intro", Pos: "1.500000", Type: "cue"},
+			{Pos: "2.000000", Num: 1, Type: "cue"},
+			{Pos: "3.000000", Num: 4, Type: "cue"},
+			{Pos: "4.000000", Size: "2.500000", Type: "loop"},
+			{Pos: "8.000000", Size: "2.000000", Num: 2, Type: "loop"},
+		},
+	}
+
+	song := SongFromTrack(track)
+	if !reflect.DeepEqual(song, want) {
+		t.Fatalf("SongFromTrack =\n%+v\nwant\n%+v", song, want)
+	}
+
+	var buf bytes.Buffer
+	if err := (&Database{Version: databaseVersion, Songs: []Song{song}}).Write(&buf); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	var got Database
+	if err := xml.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if len(got.Songs) != 1 || !reflect.DeepEqual(got.Songs[0], want) {
+		t.Errorf("round trip =\n%+v\nwant\n%+v", got.Songs, want)
+	}
+}
+
+func TestSongFromTrackUnanalyzed(t *testing.T) {
+	song := SongFromTrack(rekordbox.FullTrack{Title: "Demo", FolderPath: "/Music/Demo.wav"})
+	if song.Scan != nil || song.Tags.Bpm != "" || len(song.Pois) != 0 {
+		t.Errorf("SongFromTrack = %+v, want no BPM, scan or cues", song)
+	}
+}
+
+func TestExport(t *testing.T) {
+	dir := t.TempDir()
+	track := rekordbox.FullTrack{Title: "Rain", FolderPath: "/Music/Rain.mp3"}
+	playlists := []*rekordbox.FullPlaylist{
+		{ID: "1", Name: "Set", Path: []string{"House", "Set"}, Tracks: []rekordbox.FullTrack{track}},
+		{ID: "42", Name: "Set", Path: []string{"House", "Set"}},
+		{ID: "3", Name: "..", Path: []string{".."}},
+		{ID: "4", Name: `A/B: "C"?`, Path: []string{`A/B: "C"?`}},
+		{ID: "5", Name: "con", Path: []string{"con"}},
+	}
+
+	written, err := Export(dir, playlists)
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+
+	folders := filepath.Join(dir, FoldersDir)
+	want := []string{
+		filepath.Join(dir, DatabaseName),
+		filepath.Join(folders, "House", "Set"+FolderExt),
+		filepath.Join(folders, "House", "Set (42)"+FolderExt),
+		filepath.Join(folders, "_"+FolderExt),
+		filepath.Join(folders, "A-B- -C--"+FolderExt),
+		filepath.Join(folders, "_con"+FolderExt),
+	}
+	if !reflect.DeepEqual(written, want) {
+		t.Fatalf("written =\n%q\nwant\n%q", written, want)
+	}
+
+	data, err := os.ReadFile(want[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var folder Folder
+	if err := xml.Unmarshal(data, &folder); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if len(folder.Songs) != 1 || folder.Songs[0].Path != track.FolderPath {
+		t.Errorf("first Set has %+v, want %s", folder.Songs, track.FolderPath)
+	}
+}
+
+func TestSanitizeName(t *testing.T) {
+	tests := map[string]string{
+		"Deep House": "Deep House",
+		".":          "_",
+		"..":         "_",
+		"":           "_",
+		"Mix...":     "Mix",
+		"a\\b/c":     "a-b-c",
+		"<*|>":       "----",
+		"tab\there":  "tab-here",
+		"NUL.txt":    "_NUL.txt",
+		"Console":    "Console",
+	}
+	for in, want := range tests {
+		if got := sanitizeName(in); got != want {
+			t.Errorf("sanitizeName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}